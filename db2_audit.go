@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"time"
+)
+
+// AuditEvent describes a credential operation. It never carries a password.
+type AuditEvent struct {
+	// Operation is new_user, update_user or delete_user
+	Operation string
+
+	// Username is the user the operation acted on; it is empty if NewUser
+	// failed before generating one
+	Username string
+
+	// Time is when the operation finished
+	Time time.Time
+
+	// Success reports whether the operation succeeded. Error is the reason it
+	// failed, with secret values removed.
+	Success bool
+	Error   string
+}
+
+// AuditHook receives an AuditEvent after each credential operation, for an
+// audit trail separate from Vault's. It is called synchronously and may be
+// called concurrently by operations on different users.
+type AuditHook interface {
+	AuditCredentialOperation(event AuditEvent)
+}
+
+// AuditHookFunc adapts a function to an AuditHook
+type AuditHookFunc func(event AuditEvent)
+
+// AuditCredentialOperation calls f(event)
+func (f AuditHookFunc) AuditCredentialOperation(event AuditEvent) {
+	f(event)
+}
+
+// SetAuditHook sets the hook credential operations are reported to; nil, the
+// default, reports them nowhere
+func (d *db2DB) SetAuditHook(hook AuditHook) {
+	d.auditHook = hook
+}
+
+// auditOperation reports the outcome of operation for username to the audit
+// hook, if one is set. Secret values are removed from err, along with any of
+// the given passwords, as in logOperation.
+func (d *db2DB) auditOperation(operation, username string, err error, passwords ...string) {
+	if d.auditHook == nil {
+		return
+	}
+
+	event := AuditEvent{
+		Operation: operation,
+		Username:  username,
+		Time:      d.timeSource().Now(),
+		Success:   err == nil,
+	}
+	if err != nil {
+		event.Error = maskPasswords(d.sanitize(err).Error(), passwords)
+	}
+
+	d.auditHook.AuditCredentialOperation(event)
+}
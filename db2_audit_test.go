@@ -0,0 +1,108 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// recordingHook is an AuditHook that keeps every event it receives
+type recordingHook struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (h *recordingHook) AuditCredentialOperation(event AuditEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHook) recorded() []AuditEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]AuditEvent(nil), h.events...)
+}
+
+func TestAuditHook(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	hook := &recordingHook{}
+	db.SetAuditHook(hook)
+	start := time.Now()
+
+	newResp, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "app"},
+		Statements:     dbplugin.Statements{Commands: []string{`GRANT CONNECT ON DATABASE TO USER "{{username}}"`}},
+		Password:       "s3cretnewpass",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating user: %v", err)
+	}
+
+	// An error echoing the statement must not leak the new password
+	srv.failOn("ALTER USER", errors.New(`SQL0104N  An unexpected token "'s3cretnewpass'" was found.  SQLSTATE=42601`))
+	if _, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "s3cretnewpass"},
+	}); err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+
+	if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: newResp.Username}); err != nil {
+		t.Fatalf("unexpected error deleting user: %v", err)
+	}
+
+	events := hook.recorded()
+	expected := []AuditEvent{
+		{Operation: opNewUser, Username: newResp.Username, Success: true},
+		{Operation: opUpdateUser, Username: "appuser", Success: false},
+		{Operation: opDeleteUser, Username: newResp.Username, Success: true},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got: %+v", len(expected), events)
+	}
+	for i, event := range events {
+		if event.Operation != expected[i].Operation || event.Username != expected[i].Username || event.Success != expected[i].Success {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], event)
+		}
+		if event.Time.Before(start) || event.Time.After(time.Now()) {
+			t.Errorf("event %d: unexpected time %s", i, event.Time)
+		}
+		if event.Success != (event.Error == "") {
+			t.Errorf("event %d: expected an error only on failure, got %q", i, event.Error)
+		}
+		if strings.Contains(event.Error, "s3cretnewpass") {
+			t.Errorf("event %d: expected the error not to contain the password, got %q", i, event.Error)
+		}
+	}
+}
+
+func TestAuditHook_NoOpUpdate(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+	var events []AuditEvent
+	db.SetAuditHook(AuditHookFunc(func(event AuditEvent) { events = append(events, event) }))
+
+	// Requests that change no password are not audited
+	if _, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{Username: "appuser"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events, got: %+v", events)
+	}
+}
+
+func TestAuditHook_Nil(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+
+	if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST"}); err != nil {
+		t.Fatalf("unexpected error without an audit hook: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+// BulkUpdateResult is the outcome of one request passed to BulkUpdatePasswords
+type BulkUpdateResult struct {
+	Username string
+
+	// Err is why the rotation failed, with secret values removed, or nil if
+	// it succeeded
+	Err error
+}
+
+// BulkUpdatePasswords rotates many users at once, e.g. to force-rotate static
+// roles during incident response. Each request is run as by UpdateUser, in
+// its own transaction on a connection from the shared pool, with as many at
+// once as max_concurrent_rotations allows or, when that is unlimited, as the
+// pool has connections. A failure does not stop the others; the results are
+// in the order of reqs.
+func (d *db2DB) BulkUpdatePasswords(ctx context.Context, reqs []dbplugin.UpdateUserRequest) ([]BulkUpdateResult, error) {
+	if !d.initialized() {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	d.initLock.RLock()
+	workers := d.config.MaxConcurrentRotations
+	if workers <= 0 {
+		workers = d.config.maxOpenConnections()
+	}
+	d.initLock.RUnlock()
+	if workers <= 0 || workers > len(reqs) {
+		workers = len(reqs)
+	}
+
+	results := make([]BulkUpdateResult, len(reqs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				_, err := d.UpdateUser(ctx, reqs[i])
+				results[i] = BulkUpdateResult{Username: reqs[i].Username, Err: d.sanitize(err)}
+			}
+		}()
+	}
+
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results, nil
+}
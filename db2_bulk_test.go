@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+func bulkRequests(usernames ...string) []dbplugin.UpdateUserRequest {
+	reqs := make([]dbplugin.UpdateUserRequest, len(usernames))
+	for i, username := range usernames {
+		reqs[i] = dbplugin.UpdateUserRequest{
+			Username: username,
+			Password: &dbplugin.ChangePassword{NewPassword: "pass-" + username},
+		}
+	}
+	return reqs
+}
+
+func TestBulkUpdatePasswords(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.failOn(`"bob"`, errors.New(`SQL0551N  "ADMIN" does not have the privilege to perform operation "ALTER USER".  SQLSTATE=42501`))
+	srv.failOn(`"dave"`, errors.New("SQL0104N  An unexpected token \"'pass-dave'\" was found.  SQLSTATE=42601"))
+
+	results, err := db.BulkUpdatePasswords(context.Background(), bulkRequests("alice", "bob", "carol", "dave"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	failed := map[string]string{"bob": "SQLCODE=-551", "dave": "SQLCODE=-104"}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got: %+v", results)
+	}
+	for i, username := range []string{"alice", "bob", "carol", "dave"} {
+		result := results[i]
+		if result.Username != username {
+			t.Errorf("result %d: expected username %s, got %s", i, username, result.Username)
+		}
+		if code, ok := failed[username]; ok {
+			if result.Err == nil || !strings.Contains(result.Err.Error(), code) {
+				t.Errorf("expected %s to fail with %s, got: %v", username, code, result.Err)
+			}
+		} else if result.Err != nil {
+			t.Errorf("expected %s to succeed, got: %v", username, result.Err)
+		}
+	}
+
+	applied := strings.Join(srv.statements(), "\n")
+	for _, username := range []string{"alice", "carol"} {
+		if !strings.Contains(applied, `ALTER USER "`+username+`"`) {
+			t.Errorf("expected %s's password to be changed, got:\n%s", username, applied)
+		}
+	}
+	if strings.Contains(applied, "bob") || strings.Contains(applied, "dave") {
+		t.Errorf("expected the failed rotations to be rolled back, got:\n%s", applied)
+	}
+}
+
+func TestBulkUpdatePasswords_ConcurrencyLimit(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "max_concurrent_rotations": 2})
+	srv.delayOn("ALTER USER", 20*time.Millisecond)
+
+	results, err := db.BulkUpdatePasswords(context.Background(), bulkRequests("u1", "u2", "u3", "u4", "u5", "u6"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("unexpected error for %s: %v", result.Username, result.Err)
+		}
+	}
+
+	if peak := srv.peakConcurrency(); peak != 2 {
+		t.Errorf("expected 2 rotations at once, got %d", peak)
+	}
+}
+
+func TestBulkUpdatePasswords_Sanitized(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.failOn("ALTER USER", errors.New("SQL30082N  Security processing failed for user admin with password adminpass.  SQLSTATE=08001"))
+
+	results, err := db.BulkUpdatePasswords(context.Background(), bulkRequests("alice"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err == nil || strings.Contains(results[0].Err.Error(), "adminpass") {
+		t.Errorf("expected a sanitized error, got: %v", results[0].Err)
+	}
+}
+
+func TestBulkUpdatePasswords_NotInitialized(t *testing.T) {
+	if _, err := newDB2().BulkUpdatePasswords(context.Background(), bulkRequests("alice")); !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got: %v", err)
+	}
+}
@@ -6,25 +6,224 @@ package db2
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
 	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 	"github.com/hashicorp/vault/sdk/database/helper/connutil"
 	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+	"github.com/hashicorp/vault/sdk/helper/template"
 	_ "github.com/ibmdb/go_ibm_db"
 )
 
 const (
 	db2TypeName = "db2"
 
-	defaultChangePasswordStatement = `ALTER USER "{{username}}" IDENTIFIED BY "{{password}}"`
+	// db2DriverName is the database/sql driver registered by go_ibm_db
+	db2DriverName = "go_ibm_db"
+
+	// pingQuery is the default DB2 no-op query used to verify a connection
+	pingQuery = "SELECT 1 FROM SYSIBM.SYSDUMMY1"
+
+	// pingFallbackQuery is the default query run when the ping_query is
+	// refused for lack of privilege, e.g. where access to SYSIBM.SYSDUMMY1 is
+	// restricted. It reads no catalog table.
+	pingFallbackQuery = "VALUES 1"
+
+	// validationUsername and validationPassword stand in for the placeholders
+	// of statements checked by ValidateStatements
+	validationUsername = "VAULTCHK"
+	validationPassword = "Validate1234"
+
+	// closeTimeout bounds how long Close waits for in-flight operations
+	closeTimeout = 30 * time.Second
+
+	// pingTimeout bounds health checks made through Ping
+	pingTimeout = 5 * time.Second
+
+	// defaultUsernameTemplate produces names of at most 8 uppercase characters,
+	// since DB2 LUW authorization IDs map to operating system users
+	defaultUsernameTemplate = `{{ printf "V%s%s%s" (.DisplayName | truncate 1) (.RoleName | truncate 2) (random 4) | replace "-" "_" | replace "." "_" | uppercase }}`
+
+	// maxUsernameLength is the longest authorization ID DB2 LUW can map to an
+	// operating system user
+	maxUsernameLength = 8
+
+	// maxIdentifierLength is the longest authorization ID DB2 accepts
+	maxIdentifierLength = 128
+
+	// expirationFormat is the default format of {{expiration}}, a DB2
+	// timestamp string
+	expirationFormat = "2006-01-02-15.04.05.000000"
 )
 
+// defaultRevocationStatements revoke CONNECT and then each database authority
+// the connecting user can revoke without SECADM. They run one at a time, since
+// a REVOKE naming several authorities fails when any one of them is not held;
+// DBADM, DATAACCESS, ACCESSCTRL, SECADM, SQLADM, WLMADM and EXPLAIN need
+// SECADM and are left to revocation_statements.
+var defaultRevocationStatements = []string{
+	`REVOKE CONNECT ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE BINDADD ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE CREATETAB ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE CREATE_EXTERNAL_ROUTINE ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE CREATE_NOT_FENCED_ROUTINE ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE IMPLICIT_SCHEMA ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE LOAD ON DATABASE FROM USER "{{username}}"`,
+	`REVOKE QUIESCE_CONNECT ON DATABASE FROM USER "{{username}}"`,
+}
+
 var _ dbplugin.Database = (*db2DB)(nil)
 
+// errClosing is returned by operations started after Close has begun
+var errClosing = errors.New("connection closing")
+
+// placeholderRegex matches a {{name}} placeholder in a statement
+var placeholderRegex = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// usernameRegex matches uppercase DB2 authorization IDs
+var usernameRegex = regexp.MustCompile(`^[A-Z@#$][A-Z0-9@#$_]*$`)
+
+// identifierRegex matches the characters DB2 allows in an ordinary
+// authorization ID, in either case
+var identifierRegex = regexp.MustCompile(`^[A-Za-z@#$][A-Za-z0-9@#$_]*$`)
+
+// reservedUsernamePrefixes cannot begin a DB2 authorization ID
+var reservedUsernamePrefixes = []string{"SYS", "IBM", "SQL"}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryer is implemented by *sql.DB, *sql.Conn and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// preparer is implemented by *sql.Conn and *sql.Tx
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// txBeginner is implemented by *sql.DB and *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
 // db2DB implements the Database interface for IBM DB2
 type db2DB struct {
 	*db2ConnectionProducer
+
+	config           db2Config
+	usernameProducer template.StringTemplate
+
+	// tempFiles are written for the current connection, e.g. an inline PEM
+	// certificate, and removed on Close
+	tempFiles []string
+
+	// metrics receives the plugin's telemetry; nil uses the go-metrics global
+	metrics metrics.MetricSink
+
+	// logger receives debug logs of each operation; nil discards them
+	logger hclog.Logger
+
+	// clock is the source of the current time; nil uses real time
+	clock Clock
+
+	// auditHook receives an AuditEvent after each credential operation; nil
+	// discards them
+	auditHook AuditHook
+
+	// inFlight tracks running user operations so Close can wait for them.
+	// closing is set under opsLock once Close begins.
+	opsLock  sync.Mutex
+	inFlight sync.WaitGroup
+	closing  bool
+
+	// debug is set when VAULT_DB2_DEBUG is in the environment, and is
+	// required for disable_error_sanitization
+	debug bool
+
+	// keepaliveCancel stops the keepalive goroutine, which closes
+	// keepaliveDone on exit; both are nil when it is not running
+	keepaliveCancel context.CancelFunc
+	keepaliveDone   chan struct{}
+
+	// reloadCancel and reloadDone do the same for the reload_on_change
+	// watcher. Guarded by lifecycleLock.
+	reloadCancel context.CancelFunc
+	reloadDone   chan struct{}
+
+	// resetLock serializes Reset calls
+	resetLock sync.Mutex
+
+	// initLock is held by Initialize while it replaces the config and
+	// connection, and shared by each operation from beginOperation to
+	// endOperation so it sees one consistent config and producer.
+	// lifecycleLock serializes Initialize and Close, which waits for
+	// operations on its own.
+	initLock      sync.RWMutex
+	lifecycleLock sync.Mutex
+
+	// rotationSlots bounds concurrent password changes to
+	// max_concurrent_rotations; nil leaves them unbounded. Guarded by opsLock.
+	rotationSlots chan struct{}
+
+	// urlSecrets are the connection strings and the credentials embedded in
+	// them, masked in errors alongside the producer's secret values
+	urlSecrets map[string]string
+
+	// secrets is what secretValues returns, rebuilt by updateSecrets whenever
+	// the values it is made of change, so the sanitizer can read it while
+	// Initialize or Reset replaces them
+	secrets atomic.Pointer[map[string]string]
+
+	// sessionID names the instance's init_sql to the session driver once
+	// registerSession has set it. Guarded by the producer's lock.
+	sessionID string
+
+	// rootRollback undoes the last root rotation until the next Initialize
+	rootRollback *rootRollback
+
+	// pool is the producer's connection pool once opened, for PoolStats.
+	// Guarded by the producer's lock.
+	pool *sql.DB
+
+	// failoverDSN is the connection string with the failover credentials,
+	// which getConnection switches to, setting failoverActive, when the
+	// server rejects the root credentials. Guarded by the producer's lock
+	// and reset by Initialize.
+	failoverDSN    string
+	failoverActive bool
+
+	// cachedVersion is the server version found by ServerVersion, cleared
+	// when the connection is closed. Guarded by versionLock.
+	versionLock   sync.Mutex
+	cachedVersion string
+}
+
+// rootRollback holds what RollbackRootCredentials needs to restore the root
+// password from before a rotation
+type rootRollback struct {
+	username   string
+	password   string
+	statements []string
+
+	// config and dsn are the plugin config and connection string in use
+	// before the rotation
+	config map[string]interface{}
+	dsn    string
 }
 
 // db2ConnectionProducer implements ConnectionProducer and provides a connection producer for DB2
@@ -37,10 +236,229 @@ func newDB2() *db2DB {
 	connProducer := &db2ConnectionProducer{
 		SQLConnectionProducer: &connutil.SQLConnectionProducer{},
 	}
-	connProducer.Type = db2TypeName
+	connProducer.Type = db2DriverName
 
 	return &db2DB{
 		db2ConnectionProducer: connProducer,
+		debug:                 os.Getenv(debugEnv) != "",
+	}
+}
+
+// Close rejects new operations, waits up to closeTimeout for in-flight ones
+// to finish, then closes the connection pool and removes any temporary files
+// written for it
+func (d *db2DB) Close() error {
+	d.opsLock.Lock()
+	d.closing = true
+	d.opsLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		d.log().Warn("closing connection with operations still in flight", "timeout", closeTimeout)
+	}
+
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+	d.stopReloadWatcher()
+	err := d.closeConnection()
+	d.registerSession(nil)
+	return err
+}
+
+// closeConnection closes the connection pool and removes any temporary files
+// written for it, without coordinating with in-flight operations
+func (d *db2DB) closeConnection() error {
+	d.stopKeepalive()
+	d.clearServerVersion()
+	err := d.closePool()
+	d.removeTempFiles()
+	return err
+}
+
+// Reset closes the connection pool and opens a new one with the current
+// config, to recover from connections the DB2 server dropped, e.g. when it
+// restarted. A connection_url_file or password_file is read again, so the
+// new pool uses its current contents. The new pool is verified with the
+// ping_query. Concurrent calls run one at a time.
+func (d *db2DB) Reset(ctx context.Context) error {
+	if err := d.beginOperation(); err != nil {
+		return err
+	}
+	defer d.endOperation()
+
+	d.resetLock.Lock()
+	defer d.resetLock.Unlock()
+
+	// Closing only the pool keeps the temporary files the connection
+	// string refers to; the producer opens a new pool on next use
+	if err := d.closePool(); err != nil {
+		return fmt.Errorf("failed to close connection pool: %w", err)
+	}
+
+	if d.config.ConnectionURLFile != "" || d.config.PasswordFile != "" {
+		if err := d.reloadCredentialFiles(ctx); err != nil {
+			return err
+		}
+	}
+
+	verifyCtx, cancel := context.WithTimeout(ctx, d.config.ConnectTimeout)
+	defer cancel()
+	if err := d.verifyConnection(verifyCtx); err != nil {
+		return fmt.Errorf("error verifying connection: %w", connectError(err, d.config.ConnectTimeout))
+	}
+
+	return nil
+}
+
+// startKeepalive runs probeIdleConnections every interval until
+// stopKeepalive is called
+func (d *db2DB) startKeepalive(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.keepaliveCancel, d.keepaliveDone = cancel, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := d.probeIdleConnections(ctx); err != nil && ctx.Err() == nil {
+					d.log().Debug("keepalive probe failed", "error", d.sanitize(err).Error())
+				}
+			}
+		}
+	}()
+}
+
+// stopKeepalive stops the keepalive goroutine, if running, and waits for it
+// to exit
+func (d *db2DB) stopKeepalive() {
+	if d.keepaliveCancel == nil {
+		return
+	}
+
+	d.keepaliveCancel()
+	<-d.keepaliveDone
+	d.keepaliveCancel, d.keepaliveDone = nil, nil
+}
+
+// probeIdleConnections runs the ping_query on each idle pooled connection so
+// the DB2 server does not drop it for inactivity. The connections are held
+// together so each one is probed once.
+func (d *db2DB) probeIdleConnections(ctx context.Context) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	idle := db.Stats().Idle
+	for i := 0; i < idle; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := d.runPingQuery(ctx, d.config, conn); err != nil {
+			return fmt.Errorf("keepalive query failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// beginOperation registers an in-flight operation, failing once Close has
+// begun, and waits for any Initialize in progress. Each successful call must
+// be paired with endOperation.
+func (d *db2DB) beginOperation() error {
+	d.initLock.RLock()
+
+	d.opsLock.Lock()
+	defer d.opsLock.Unlock()
+
+	if d.closing {
+		d.initLock.RUnlock()
+		return errClosing
+	}
+	d.inFlight.Add(1)
+	return nil
+}
+
+// endOperation marks an operation registered by beginOperation as finished
+func (d *db2DB) endOperation() {
+	d.inFlight.Done()
+	d.initLock.RUnlock()
+}
+
+// beginRootOperation is beginOperation for root rotations, which
+// re-initialize and so cannot hold initLock while Initialize waits for it.
+// Close still waits for them to finish. Each successful call must be paired
+// with endRootOperation.
+func (d *db2DB) beginRootOperation() error {
+	d.opsLock.Lock()
+	defer d.opsLock.Unlock()
+
+	if d.closing {
+		return errClosing
+	}
+	d.inFlight.Add(1)
+	return nil
+}
+
+// endRootOperation marks a root rotation registered by beginRootOperation as
+// finished
+func (d *db2DB) endRootOperation() {
+	d.inFlight.Done()
+}
+
+// configSnapshot returns a copy of the config, for root rotations to use
+// throughout since Initialize may replace it while they run
+func (d *db2DB) configSnapshot() db2Config {
+	d.initLock.RLock()
+	defer d.initLock.RUnlock()
+	return d.config
+}
+
+// initialized reports whether the producer has been initialized, under its
+// lock since Reset and Close clear it
+func (d *db2DB) initialized() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.Initialized
+}
+
+// acquireRotation waits for one of the max_concurrent_rotations slots, or
+// until ctx is done. The returned function releases the slot.
+func (d *db2DB) acquireRotation(ctx context.Context) (func(), error) {
+	d.opsLock.Lock()
+	slots := d.rotationSlots
+	d.opsLock.Unlock()
+
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("gave up waiting for a rotation slot: %w", ctx.Err())
 	}
 }
 
@@ -51,87 +469,1644 @@ func (d *db2DB) Type() (string, error) {
 
 // Initialize configures the database connection
 func (d *db2DB) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (dbplugin.InitializeResponse, error) {
-	newConf, err := d.db2ConnectionProducer.Init(ctx, req.Config, req.VerifyConnection)
+	config, err := parseConfig(req.Config)
+	if err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	if config.DisableErrorSanitization && !d.debug {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("disable_error_sanitization requires %s to be set in the plugin's environment", debugEnv)
+	}
+	if config.idleExceedsOpen() {
+		d.log().Warn("max_idle_connections exceeds max_open_connections and is clamped to it",
+			"max_idle_connections", config.MaxIdleConnections, "max_open_connections", config.maxOpenConnections())
+	}
+
+	if config.SSLInsecureSkipVerify {
+		d.log().Warn("ssl_insecure_skip_verify is set: the server certificate is not checked against the hostname, so connections can be intercepted; use it only with test servers")
+	}
+
+	// Running operations finish with the previous config and connection
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+	// The watcher resets the pool as an operation, so it must be stopped
+	// before initLock is taken
+	d.stopReloadWatcher()
+	d.initLock.Lock()
+	defer d.initLock.Unlock()
+
+	d.opsLock.Lock()
+	d.closing = false
+	// Rotations holding a slot of the previous semaphore release it there
+	d.rotationSlots = nil
+	if config.MaxConcurrentRotations > 0 {
+		d.rotationSlots = make(chan struct{}, config.MaxConcurrentRotations)
+	}
+	d.opsLock.Unlock()
+
+	// The producer keeps its pool across Init, so close any pool opened with
+	// the previous config rather than leak or keep reusing it
+	if err := d.closeConnection(); err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("failed to close previous connection: %w", err)
+	}
+	d.registerSession(config.InitSQL)
+
+	// The connection is verified below, once the DB2-specific keywords have
+	// been added to the connection string
+	conf := producerConfig(req.Config, config)
+	if config.ConnectionURLFile != "" {
+		if conf["connection_url"], err = readConnectionURLFile(config.ConnectionURLFile); err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+	}
+	if url, _ := conf["connection_url"].(string); url == "" && config.DSNAlias != "" {
+		// The alias is all a catalogued database needs
+		conf["connection_url"] = "DSN=" + config.DSNAlias
+	}
+	if _, err := d.db2ConnectionProducer.Init(ctx, conf, false); err != nil {
+		return dbplugin.InitializeResponse{}, err
+	}
+	dsn, err := d.buildConnectionString(d.ConnectionURL, config)
 	if err != nil {
 		return dbplugin.InitializeResponse{}, err
 	}
 
+	rawURL, _ := conf["connection_url"].(string)
+	failoverDSN := failoverConnectionString(dsn, config)
+	d.urlSecrets = connectionSecrets(rawURL, d.ConnectionURL, dsn, failoverDSN)
+
+	d.Lock()
+	d.rootRollback = nil
+	d.ConnectionURL = dsn
+	d.failoverDSN, d.failoverActive = failoverDSN, false
+	d.RawConfig = req.Config
+	d.Unlock()
+	d.config = config
+	d.updateSecrets()
+	d.log().Debug("built connection string", "dsn", d.RedactedDSN())
+
+	usernameTemplate := config.UsernameTemplate
+	if usernameTemplate == "" {
+		usernameTemplate = defaultUsernameTemplate
+	}
+
+	up, err := template.NewTemplate(template.Template(usernameTemplate))
+	if err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("unable to initialize username template: %w", err)
+	}
+
+	if _, err := up.Generate(dbplugin.UsernameMetadata{}); err != nil {
+		return dbplugin.InitializeResponse{}, fmt.Errorf("invalid username template: %w", err)
+	}
+	d.usernameProducer = up
+
 	resp := dbplugin.InitializeResponse{
-		Config: newConf,
+		Config: config.withDefaults(req.Config),
+	}
+	// Reported for the server verified below; a value saved from an earlier
+	// Initialize may describe a different server
+	delete(resp.Config, defaultStatementConfigKey)
+	redactURLPassword(resp.Config, config)
+
+	if req.VerifyConnection {
+		if err := d.retryVerifyConnection(ctx, config); err != nil {
+			return dbplugin.InitializeResponse{}, fmt.Errorf("error verifying connection: %w", connectError(err, config.ConnectTimeout))
+		}
+
+		if len(config.AlternateHosts) > 0 {
+			verifyCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+			d.logConnectedHost(verifyCtx)
+			cancel()
+		}
+
+		if config.TrustedContext != "" {
+			verifyCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+			defer cancel()
+			if err := d.checkTrustedContext(verifyCtx); err != nil {
+				return dbplugin.InitializeResponse{}, err
+			}
+		}
+
+		if config.ChangePasswordProcedure != "" {
+			verifyCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+			defer cancel()
+			if err := d.checkProcedure(verifyCtx); err != nil {
+				return dbplugin.InitializeResponse{}, err
+			}
+		}
+
+		if config.AuthType != authTypeKerberos {
+			if stmt, ok := d.defaultPasswordStatement(config); ok {
+				resp.Config[defaultStatementConfigKey] = stmt
+			}
+		}
+	}
+
+	if config.WarmupConnections > 0 {
+		warmupCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+		defer cancel()
+		if err := d.warmupPool(warmupCtx, config); err != nil {
+			if req.VerifyConnection {
+				return dbplugin.InitializeResponse{}, fmt.Errorf("error warming up connections: %w", connectError(err, config.ConnectTimeout))
+			}
+			d.log().Warn("failed to warm up connections", "error", d.sanitize(err).Error())
+		}
+	}
+
+	if config.KeepaliveInterval > 0 {
+		d.startKeepalive(config.KeepaliveInterval)
+	}
+	if config.ReloadOnChange {
+		d.startReloadWatcher(config.credentialFiles(), config.ReloadInterval)
 	}
 
 	return resp, nil
 }
 
-// NewUser creates a new user - not supported for static credentials
-func (d *db2DB) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
-	return dbplugin.NewUserResponse{}, fmt.Errorf("NewUser is not supported for DB2 static credentials plugin")
+// connectedHostQuery returns the host name of the server the connection
+// reached, which with alternate_hosts may be a standby
+const connectedHostQuery = "SELECT HOST_NAME FROM TABLE (SYSPROC.ENV_GET_SYS_INFO()) AS T"
+
+// logConnectedHost logs which server the pool connected to. It is only
+// informational, so a failure is logged rather than returned.
+func (d *db2DB) logConnectedHost(ctx context.Context) {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return
+	}
+
+	var host string
+	if err := db.QueryRowContext(ctx, connectedHostQuery).Scan(&host); err != nil {
+		d.log().Debug("failed to look up the connected server", "error", d.sanitize(describeError(err)).Error())
+		return
+	}
+	d.log().Debug("connected to server", "host", strings.TrimSpace(host))
+}
+
+// warmupPool opens warmup_connections connections, up to the number the pool
+// keeps idle, and runs the ping_query on each. They are held together so each
+// one is new, and return to the pool idle. Connections opened before a
+// failure stay in the pool.
+func (d *db2DB) warmupPool(ctx context.Context, config db2Config) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	n := config.WarmupConnections
+	if idle := config.maxIdleConnections(); n > idle {
+		n = idle
+	}
+
+	for i := 0; i < n; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("opened %d of %d connections: %w", i, n, describeError(err))
+		}
+		defer conn.Close()
+
+		if err := d.runPingQuery(ctx, config, conn); err != nil {
+			return fmt.Errorf("opened %d of %d connections: ping query failed: %w", i, n, err)
+		}
+	}
+
+	d.log().Debug("warmed up connections", "connections", n)
+	return nil
+}
+
+// NewUser creates a new dynamic user. DB2 LUW authenticates against the operating
+// system, so the OS user must already exist and the creation statements are
+// expected to grant it access (e.g. GRANT CONNECT ON DATABASE TO USER "{{username}}").
+// All statements run in a single transaction so a failure rolls back earlier ones.
+func (d *db2DB) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (resp dbplugin.NewUserResponse, err error) {
+	var username string
+	defer func() {
+		d.recordOperation(opNewUser, err)
+		d.auditOperation(opNewUser, username, err, req.Password)
+	}()
+
+	if err := d.beginOperation(); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	defer d.endOperation()
+
+	if len(req.Statements.Commands) == 0 {
+		return dbplugin.NewUserResponse{}, dbutil.ErrEmptyCreationStatement
+	}
+
+	username, err = d.usernameProducer.Generate(req.UsernameConfig)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, fmt.Errorf("failed to generate username: %w", err)
+	}
+	defer func() { d.logOperation(opNewUser, username, len(req.Statements.Commands), err, req.Password) }()
+
+	if err := d.validateNewUsername(username); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	generated := username
+	for retry := 1; ; retry++ {
+		err = d.createUser(ctx, db, username, req)
+		if err == nil || !isDuplicateName(err) || d.config.UsernameCollisionRetries == 0 {
+			break
+		}
+		if retry > d.config.UsernameCollisionRetries {
+			return dbplugin.NewUserResponse{}, fmt.Errorf("no unique username found for %s after %d retries: %w", generated, d.config.UsernameCollisionRetries, err)
+		}
+
+		candidate := usernameWithSuffix(generated, retry)
+		if err := d.validateNewUsername(candidate); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+		d.log().Debug("username already exists, retrying with a suffix", "username", username, "retry", candidate)
+		username = candidate
+	}
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	return dbplugin.NewUserResponse{Username: username}, nil
+}
+
+// validateNewUsername checks that username is a valid authorization ID.
+// Unquoted names are folded to uppercase, so only the folded name must be.
+func (d *db2DB) validateNewUsername(username string) error {
+	if d.config.IdentifierQuoting == identifierQuotingNone {
+		username = strings.ToUpper(username)
+	}
+	return validateUsername(username)
+}
+
+// usernameWithSuffix returns username with _n appended, truncated first so
+// the result stays within maxUsernameLength
+func usernameWithSuffix(username string, n int) string {
+	suffix := "_" + strconv.Itoa(n)
+	if len(username)+len(suffix) > maxUsernameLength {
+		username = username[:max(maxUsernameLength-len(suffix), 0)]
+	}
+	return username + suffix
+}
+
+// createUser runs the creation statements for username in one transaction
+func (d *db2DB) createUser(ctx context.Context, db txBeginner, username string, req dbplugin.NewUserRequest) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := d.setCurrentSchema(ctx, d.config, tx); err != nil {
+		return err
+	}
+
+	values := d.config.withLDAPValues(map[string]string{
+		"username":         username,
+		"password":         req.Password,
+		"password_escaped": db2EscapeLiteral(req.Password),
+		"password_quoted":  db2EscapeLiteral(req.Password),
+		"expiration":       req.Expiration.Format(d.config.ExpirationFormat),
+	})
+	for _, stmt := range req.Statements.Commands {
+		stmtCtx, cancel := d.config.statementContext(ctx)
+		_, err := tx.ExecContext(stmtCtx, dbutil.QueryHelper(stmt, values))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to create user %s: %w", username, describeError(err))
+		}
+	}
+
+	// A failed grant rolls back the user's creation with it
+	for i, stmt := range d.config.CreationGrantStatements {
+		stmtCtx, cancel := d.config.statementContext(ctx)
+		_, err := tx.ExecContext(stmtCtx, dbutil.QueryHelper(stmt, values))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("creation_grant_statements statement %d failed for user %s: %w", i+1, username, describeError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user creation for %s: %w", username, err)
+	}
+	return nil
 }
 
-// UpdateUser updates user credentials (password rotation for static roles)
-func (d *db2DB) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+// UpdateUser updates user credentials (password rotation for static roles).
+// Statements from the request take precedence over the configured
+// change_password_statements, which in turn take precedence over the default
+// password change statement. The SDK's UpdateUserResponse has no fields, so
+// a completed rotation is confirmed by a debug log line naming the user and
+// by the audit hook.
+// Rotating the configured admin user, e.g. when it is also a static role,
+// goes through updateRootPassword so the connection uses the new password.
+func (d *db2DB) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (resp dbplugin.UpdateUserResponse, err error) {
+	defer func() { d.recordOperation(opUpdateUser, err) }()
+
+	// Not run under beginOperation, since it re-initializes and Initialize
+	// waits for operations to finish
+	if req.Password != nil && d.isRootUser(req.Username) {
+		defer func() { d.auditOperation(opUpdateUser, req.Username, err, req.Password.NewPassword) }()
+		return dbplugin.UpdateUserResponse{}, d.updateRootPassword(ctx, req.Username, req.Password)
+	}
+
+	if err := d.beginOperation(); err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
+	defer d.endOperation()
+
 	if req.Password == nil {
 		return dbplugin.UpdateUserResponse{}, nil
 	}
 
 	username := req.Username
 	newPassword := req.Password.NewPassword
+	defer func() { d.auditOperation(opUpdateUser, username, err, newPassword, req.SelfManagedPassword) }()
 
 	if username == "" {
 		return dbplugin.UpdateUserResponse{}, fmt.Errorf("username is required")
 	}
 
+	if err := validateIdentifier(username); err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
+
 	if newPassword == "" {
 		return dbplugin.UpdateUserResponse{}, fmt.Errorf("new password is required")
 	}
 
-	// Get connection from the connection producer
-	dbConn, err := d.Connection(ctx)
+	if max := d.config.MaxPasswordLength; max > 0 && len(newPassword) > max {
+		return dbplugin.UpdateUserResponse{}, fmt.Errorf("new password is %d characters, exceeding max_password_length %d", len(newPassword), max)
+	}
+
+	if d.config.SelfManaged && req.SelfManagedPassword == "" {
+		return dbplugin.UpdateUserResponse{}, fmt.Errorf("current password is required in self-managed mode")
+	}
+
+	release, err := d.acquireRotation(ctx)
 	if err != nil {
 		return dbplugin.UpdateUserResponse{}, err
 	}
+	defer release()
 
-	// Type assert to *sql.DB
-	db, ok := dbConn.(*sql.DB)
-	if !ok {
-		return dbplugin.UpdateUserResponse{}, fmt.Errorf("unable to use connection")
-	}
+	defer func() {
+		if err == nil {
+			d.log().Debug("password rotated", "username", username)
+		}
+	}()
 
-	// Get the password change statements
 	statements := req.Password.Statements.Commands
 	if len(statements) == 0 {
-		statements = []string{defaultChangePasswordStatement}
+		statements = d.config.ChangePasswordStatements
 	}
 
-	// Execute password change statements
-	for _, stmt := range statements {
-		// Replace placeholders
-		query := dbutil.QueryHelper(stmt, map[string]string{
-			"username": username,
-			"password": newPassword,
-		})
+	if len(d.config.Databases) > 0 {
+		err := d.changePasswordOnDatabases(ctx, username, newPassword, req.SelfManagedPassword, statements)
+		if err == nil {
+			err = d.verifyRotation(ctx, username, newPassword)
+		}
+		return dbplugin.UpdateUserResponse{}, err
+	}
+
+	db, closeDB, err := d.passwordConnection(ctx, "", username, req.SelfManagedPassword)
+	if err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
+	defer closeDB()
+
+	if err := d.changePassword(ctx, d.config, db, opUpdateUser, username, newPassword, statements); err != nil {
+		return dbplugin.UpdateUserResponse{}, err
+	}
 
-		if _, err := db.ExecContext(ctx, query); err != nil {
-			return dbplugin.UpdateUserResponse{}, fmt.Errorf("failed to update password for user %s: %w", username, err)
+	if err := d.verifyRotation(ctx, username, newPassword); err != nil {
+		// Only in self-managed mode is the previous password known, and the
+		// connection opened with it still usable, to change it back
+		if !d.config.SelfManaged {
+			return dbplugin.UpdateUserResponse{}, err
 		}
+		if restoreErr := d.changePassword(ctx, d.config, db, opUpdateUser, username, req.SelfManagedPassword, statements); restoreErr != nil {
+			return dbplugin.UpdateUserResponse{}, fmt.Errorf("%w; restoring the previous password also failed: %w", err, restoreErr)
+		}
+		return dbplugin.UpdateUserResponse{}, fmt.Errorf("%w; the previous password was restored", err)
 	}
 
 	return dbplugin.UpdateUserResponse{}, nil
 }
 
-// DeleteUser deletes a user - not supported for static credentials
-func (d *db2DB) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
-	return dbplugin.DeleteUserResponse{}, fmt.Errorf("DeleteUser is not supported for DB2 static credentials plugin")
+// verifyRotation, with verify_after_rotation, opens a connection as username
+// with password and runs the ping_query on it, bounded by connect_timeout,
+// to check that the password change took effect
+func (d *db2DB) verifyRotation(ctx context.Context, username, password string) error {
+	if !d.config.VerifyAfterRotation {
+		return nil
+	}
+
+	d.Lock()
+	cs := parseConnectionString(d.ConnectionURL)
+	driverName := d.db2ConnectionProducer.Type
+	d.Unlock()
+	cs.set("UID", username)
+	cs.set("PWD", password)
+
+	db, err := sql.Open(driverName, cs.String())
+	if err != nil {
+		return fmt.Errorf("%w for user %s: %w", errVerifyFailed, username, err)
+	}
+	defer db.Close()
+
+	verifyCtx, cancel := context.WithTimeout(ctx, d.config.ConnectTimeout)
+	defer cancel()
+	if err := runQuery(verifyCtx, db, d.config.PingQuery); err != nil {
+		return fmt.Errorf("%w for user %s: the password was changed but connecting with it failed: %w", errVerifyFailed, username, connectError(describeError(err), d.config.ConnectTimeout))
+	}
+
+	d.log().Debug("verified new password", "username", username)
+	return nil
 }
 
-// secretValues returns the secret values as a map of string to string for error sanitization
-func (d *db2DB) secretValues() map[string]string {
-	secretValuesMap := d.db2ConnectionProducer.SecretValues()
-	result := make(map[string]string)
+// changePasswordOnDatabases applies the password change to each of the
+// configured databases in turn, connecting to each separately. A failure on
+// one database does not stop the others; the returned error lists the
+// databases that were updated and those that failed.
+func (d *db2DB) changePasswordOnDatabases(ctx context.Context, username, password, currentPassword string, statements []string) error {
+	var succeeded []string
+	var failures []error
+	for _, database := range d.config.Databases {
+		err := func() error {
+			db, closeDB, err := d.passwordConnection(ctx, database, username, currentPassword)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+
+			return d.changePassword(ctx, d.config, db, opUpdateUser, username, password, statements)
+		}()
+		if err != nil {
+			failures = append(failures, fmt.Errorf("database %s: %w", database, err))
+			continue
+		}
+		succeeded = append(succeeded, database)
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	if len(succeeded) == 0 {
+		return fmt.Errorf("failed to update password for user %s on all databases: %w", username, errors.Join(failures...))
+	}
+	return fmt.Errorf("updated password for user %s on %s but failed on: %w", username, strings.Join(succeeded, ", "), errors.Join(failures...))
+}
+
+// passwordConnection returns the connection password change statements for
+// username run on, and a function to release it. The pool is used unless a
+// database other than the configured one is named, or in self-managed mode,
+// where the connection authenticates as username with currentPassword.
+func (d *db2DB) passwordConnection(ctx context.Context, database, username, currentPassword string) (*sql.DB, func(), error) {
+	if database == "" && !d.config.SelfManaged {
+		db, err := d.getConnection(ctx)
+		return db, func() {}, err
+	}
+
+	d.Lock()
+	cs := parseConnectionString(d.ConnectionURL)
+	driverName := d.db2ConnectionProducer.Type
+	d.Unlock()
+
+	if database != "" {
+		cs.set("DATABASE", database)
+	}
+	if d.config.SelfManaged {
+		cs.set("UID", username)
+		cs.set("PWD", currentPassword)
+	}
+
+	db, err := sql.Open(driverName, cs.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open connection for user %s: %w", username, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	return db, func() { db.Close() }, nil
+}
+
+// isRootUser reports whether username is the configured admin user. DB2
+// authorization IDs are not case sensitive.
+func (d *db2DB) isRootUser(username string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.Username != "" && strings.EqualFold(username, d.Username)
+}
+
+// updateRootPassword changes the admin user's password to the one Vault
+// chose for its static role, as RotateRootCredentials does, so the pooled
+// connections do not keep the stale password. The request's statements take
+// precedence over the root_rotation_statements, and as for root rotation no
+// rotation_post_statements run and no trusted context switch is made.
+func (d *db2DB) updateRootPassword(ctx context.Context, username string, password *dbplugin.ChangePassword) error {
+	if password.NewPassword == "" {
+		return fmt.Errorf("new password is required")
+	}
+	config := d.configSnapshot()
+	if max := config.MaxPasswordLength; max > 0 && len(password.NewPassword) > max {
+		return fmt.Errorf("new password is %d characters, exceeding max_password_length %d", len(password.NewPassword), max)
+	}
+
+	statements := password.Statements.Commands
+	if len(statements) == 0 {
+		statements = config.RootRotationStatements
+	}
+
+	if _, err := d.rotateRoot(ctx, username, password.NewPassword, statements); err != nil {
+		return err
+	}
+
+	d.log().Debug("password rotated", "username", username, "root", true)
+	return nil
+}
+
+// RotateRootCredentials changes the password of the configured root user and
+// returns the updated config for Vault to persist. The in-memory connection
+// is rebuilt with the new password so subsequent connections authenticate
+// with it; on failure the existing credentials are left untouched. If the
+// rebuild fails after the DB2 password changed, the old password is restored.
+// Until the next Initialize, RollbackRootCredentials can undo the rotation
+// if the returned config cannot be persisted.
+func (d *db2DB) RotateRootCredentials(ctx context.Context, statements []string) (map[string]interface{}, error) {
+	d.Lock()
+	username := d.Username
+	d.Unlock()
+	if username == "" {
+		return nil, fmt.Errorf("unable to rotate root credentials: no username in configuration")
+	}
+
+	d.initLock.RLock()
+	if len(statements) == 0 {
+		statements = d.config.RootRotationStatements
+	}
+	password, err := d.generatePassword(ctx)
+	d.initLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.rotateRoot(ctx, username, password, statements)
+}
+
+// rotateRoot changes the root user's password to password and
+// re-initializes with it, restoring the previous password if that fails. It
+// returns the config for Vault to persist. Like other password changes it
+// fails once Close has begun and takes a max_concurrent_rotations slot.
+func (d *db2DB) rotateRoot(ctx context.Context, username, password string, statements []string) (map[string]interface{}, error) {
+	if err := d.beginRootOperation(); err != nil {
+		return nil, err
+	}
+	defer d.endRootOperation()
+
+	release, err := d.acquireRotation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	config := d.configSnapshot()
+
+	d.Lock()
+	if d.failoverActive {
+		d.Unlock()
+		return nil, fmt.Errorf("unable to rotate root credentials while connected with the failover credentials; fix the root credentials and re-initialize first")
+	}
+	if config.PasswordFile != "" {
+		d.Unlock()
+		return nil, fmt.Errorf("unable to rotate root credentials read from password_file; update the file instead")
+	}
+	rollback := &rootRollback{
+		username:   username,
+		statements: statements,
+		config:     make(map[string]interface{}, len(d.RawConfig)),
+		dsn:        d.ConnectionURL,
+	}
+	for k, v := range d.RawConfig {
+		rollback.config[k] = v
+	}
+	rollback.password, _ = parseConnectionString(d.ConnectionURL).get("PWD")
+	d.Unlock()
+
+	newConf := make(map[string]interface{}, len(rollback.config))
+	for k, v := range rollback.config {
+		newConf[k] = v
+	}
+	newConf["password"] = password
+
+	// Reject a config Initialize would refuse before the DB2 password changes
+	if _, err := parseConfig(newConf); err != nil {
+		return nil, err
+	}
+
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.changePassword(ctx, config, db, opRotateRoot, username, password, statements); err != nil {
+		return nil, err
+	}
+
+	// The pooled connections authenticated with the old password;
+	// re-initializing replaces them with ones using the new one
+	resp, err := d.Initialize(ctx, dbplugin.InitializeRequest{Config: newConf})
+	if err != nil {
+		if rollbackErr := d.restoreRootPassword(ctx, config, rollback, password); rollbackErr != nil {
+			d.log().Error("failed to roll back root rotation, the root password no longer matches the config", "username", username, "error", d.sanitize(rollbackErr).Error())
+			return nil, fmt.Errorf("failed to re-initialize with rotated root credentials: %w (rollback failed: %v)", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("failed to re-initialize with rotated root credentials, the previous password was restored: %w", err)
+	}
+
+	if rollback.password != "" {
+		d.Lock()
+		d.rootRollback = rollback
+		d.Unlock()
+	}
+
+	return resp.Config, nil
+}
+
+// RollbackRootCredentials restores the root password replaced by the last
+// RotateRootCredentials, for when the config it returned could not be
+// persisted, and re-initializes with the previous config. As rotateRoot does,
+// it fails once Close has begun and takes a max_concurrent_rotations slot.
+func (d *db2DB) RollbackRootCredentials(ctx context.Context) error {
+	if err := d.beginRootOperation(); err != nil {
+		return err
+	}
+	defer d.endRootOperation()
+
+	release, err := d.acquireRotation(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	d.Lock()
+	rollback := d.rootRollback
+	current, _ := parseConnectionString(d.ConnectionURL).get("PWD")
+	d.Unlock()
+
+	if rollback == nil {
+		return fmt.Errorf("no root rotation to roll back")
+	}
+
+	return d.restoreRootPassword(ctx, d.configSnapshot(), rollback, current)
+}
+
+// restoreRootPassword changes the root password back to the one in rollback
+// over a dedicated connection authenticated with currentPassword, then
+// re-initializes with the config from before the rotation. The statements run
+// with config, the caller's snapshot.
+func (d *db2DB) restoreRootPassword(ctx context.Context, config db2Config, rollback *rootRollback, currentPassword string) error {
+	if rollback.password == "" {
+		return fmt.Errorf("previous root password is unknown")
+	}
+
+	cs := parseConnectionString(rollback.dsn)
+	cs.set("PWD", currentPassword)
+
+	d.Lock()
+	driverName := d.db2ConnectionProducer.Type
+	d.Unlock()
+
+	db, err := sql.Open(driverName, cs.String())
+	if err != nil {
+		return fmt.Errorf("failed to open connection for user %s: %w", rollback.username, err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := d.changePassword(ctx, config, db, opRollbackRoot, rollback.username, rollback.password, rollback.statements); err != nil {
+		return err
+	}
+
+	if _, err := d.Initialize(ctx, dbplugin.InitializeRequest{Config: rollback.config}); err != nil {
+		return fmt.Errorf("restored previous root password but failed to re-initialize: %w", err)
+	}
+
+	return nil
+}
+
+// defaultPasswordStatement returns the statement changePassword runs when
+// none are given, which depends on change_password_procedure, the auth_type,
+// use_bind_params and the platform
+func (d *db2DB) defaultPasswordStatement(config db2Config) (string, bool) {
+	// The LDAP security plugin checks passwords against the directory, which
+	// no statement DB2 ships changes, and DB2 does not accept parameter
+	// markers in DDL such as ALTER USER, so neither mode has a default
+	switch {
+	case config.ChangePasswordProcedure != "":
+		return procedureCall(config.ChangePasswordProcedure, len(config.ChangePasswordProcedureArgs)), true
+	case config.AuthType == authTypeLDAP, config.UseBindParams:
+		return "", false
+	default:
+		stmt, ok := d.defaultChangePasswordStatement(config)
+		return config.quoteIdentifiers(stmt), ok
+	}
+}
+
+// quoteIdentifiers applies identifier_quoting to a default statement, which
+// double-quotes {{username}} where it is an identifier
+func (c db2Config) quoteIdentifiers(stmt string) string {
+	if c.IdentifierQuoting == identifierQuotingNone {
+		return strings.ReplaceAll(stmt, `"{{username}}"`, "{{username}}")
+	}
+	return stmt
+}
+
+// changePassword executes the password change statements for username,
+// falling back to the platform's default statement when none are given.
+// The whole batch is retried with exponential backoff on transient errors.
+func (d *db2DB) changePassword(ctx context.Context, config db2Config, db *sql.DB, operation, username, password string, statements []string) (err error) {
+	defer func() { d.logOperation(operation, username, len(statements), err, password) }()
+
+	if config.AuthType == authTypeKerberos {
+		return fmt.Errorf("password rotation %w in kerberos mode", ErrOperationNotSupported)
+	}
+
+	statements, err = d.passwordStatements(config, username, statements)
+	if err != nil {
+		return err
+	}
+
+	// Post-statements re-assert a static role's privileges, and a trusted
+	// context switches to the role's user; the root user has neither
+	var post []string
+	asUser := false
+	if operation == opUpdateUser {
+		post = config.RotationPostStatements
+		asUser = config.TrustedContext != ""
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := d.execPasswordStatements(ctx, config, db, username, password, statements, post, asUser)
+		if err == nil || attempt >= config.RotationMaxRetries || !isRetryable(err, config.RotationRetryableErrors) {
+			return err
+		}
+
+		select {
+		case <-d.timeSource().After(config.RotationRetryBackoff << attempt):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry interrupted: %v)", err, ctx.Err())
+		}
+	}
+}
+
+// borrowConnection takes a connection from db. With validate_on_borrow, it
+// first runs the ping_query on it and, if that fails, discards the connection
+// and takes another, once, so a connection the server dropped while idle does
+// not fail the rotation.
+func (d *db2DB) borrowConnection(ctx context.Context, config db2Config, db *sql.DB) (*sql.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := db.Conn(ctx)
+		if err != nil || !config.ValidateOnBorrow {
+			return conn, err
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err = d.runPingQuery(pingCtx, config, conn)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+
+		discardConn(conn)
+		conn.Close()
+		if attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("borrowed connection failed validation: %w", err)
+		}
+		d.log().Debug("borrowed connection failed validation, reconnecting", "error", d.sanitize(err).Error())
+	}
+}
+
+// discardConn has the pool close conn rather than reuse it once it is
+// returned
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+}
+
+// passwordStatements returns statements, or the default password change
+// statement when there are none. With a change_password_procedure there is
+// no default, and execPasswordStatements calls the procedure instead.
+func (d *db2DB) passwordStatements(config db2Config, username string, statements []string) ([]string, error) {
+	if len(statements) > 0 || config.ChangePasswordProcedure != "" {
+		return statements, nil
+	}
+
+	stmt, ok := d.defaultPasswordStatement(config)
+	switch {
+	case !ok && config.AuthType == authTypeLDAP:
+		return nil, fmt.Errorf("%w: DB2 has no statement that changes a directory password, supply password change statements for %s in ldap mode", dbutil.ErrEmptyRotationStatement, username)
+	case !ok && config.UseBindParams:
+		return nil, fmt.Errorf("%w: DB2 does not accept parameter markers in ALTER USER, supply password change statements for %s with use_bind_params", dbutil.ErrEmptyRotationStatement, username)
+	case !ok:
+		return nil, fmt.Errorf("%w: DB2 LUW passwords are managed by the operating system, supply password change statements for %s", dbutil.ErrEmptyRotationStatement, username)
+	}
+	return []string{stmt}, nil
+}
+
+// renderPasswordStatements substitutes the placeholders of statements, or
+// with use_bind_params replaces them with ? markers and returns the values to
+// bind
+func (c db2Config) renderPasswordStatements(username, password string, statements []string) ([]string, [][]interface{}) {
+	queries := make([]string, len(statements))
+	args := make([][]interface{}, len(statements))
+	for i, stmt := range statements {
+		values := c.withLDAPValues(map[string]string{
+			"username":         username,
+			"password":         password,
+			"password_escaped": db2EscapeLiteral(password),
+			"password_quoted":  db2EscapeLiteral(password),
+		})
+		if c.UseBindParams {
+			// Bound values are never parsed as SQL, so need no quoting
+			values["password_escaped"] = password
+			values["password_quoted"] = password
+			queries[i], args[i] = bindPlaceholders(stmt, values)
+			continue
+		}
+		queries[i] = dbutil.QueryHelper(stmt, values)
+	}
+
+	return queries, args
+}
+
+// execPasswordStatements runs one attempt of the password change statements.
+// They run in a single transaction so either all or none apply, unless
+// rotation_non_transactional is set. With asUser, they run as username
+// through the trusted context.
+func (d *db2DB) execPasswordStatements(ctx context.Context, config db2Config, db *sql.DB, username, password string, statements, post []string, asUser bool) error {
+	// The statements share one connection so session settings such as the
+	// current schema apply to all of them
+	conn, err := d.borrowConnection(ctx, config, db)
+	if err != nil {
+		return fmt.Errorf("failed to update password for user %s: %w", username, authError(err))
+	}
+	defer conn.Close()
+
+	// The session user can only change outside a transaction, so it is
+	// switched back once the transaction deferred below has ended
+	if asUser {
+		if err := d.setSessionUser(ctx, config, conn, username); err != nil {
+			return err
+		}
+		defer d.resetSessionUser(config, conn, username)
+	}
+
+	// Set outside the transaction, and reset once it has ended
+	if config.LockTimeout > 0 {
+		if err := d.setLockTimeout(ctx, config, conn); err != nil {
+			return err
+		}
+		defer d.resetLockTimeout(config, conn)
+	}
+
+	// As is the isolation level, when the driver cannot take it from BeginTx
+	var txOptions *sql.TxOptions
+	if config.TransactionIsolation != "" {
+		if supportsTxOptions(conn) {
+			txOptions = &sql.TxOptions{Isolation: isolationLevels[config.TransactionIsolation]}
+		} else {
+			if err := d.setIsolation(ctx, config, conn); err != nil {
+				return err
+			}
+			defer d.resetIsolation(config, conn)
+		}
+	}
+
+	var exec execer = conn
+	var prep preparer = conn
+	var tx *sql.Tx
+	if !config.RotationNonTransactional {
+		tx, err = conn.BeginTx(ctx, txOptions)
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback()
+		exec, prep = tx, tx
+	}
+
+	if err := d.setCurrentSchema(ctx, config, exec); err != nil {
+		return err
+	}
+
+	queries, args := config.renderPasswordStatements(username, password, statements)
+
+	procedure := len(statements) == 0
+	var resultCode sql.NullInt64
+	if procedure {
+		queries = []string{procedureCall(config.ChangePasswordProcedure, len(config.ChangePasswordProcedureArgs))}
+		call := []interface{}{username, password, sql.Out{Dest: &resultCode}}
+		for _, arg := range config.ChangePasswordProcedureArgs {
+			call = append(call, arg)
+		}
+		args = [][]interface{}{call}
+	}
+
+	if config.PreflightPrivilegeCheck {
+		if err := preflightStatements(ctx, prep, username, queries); err != nil {
+			return err
+		}
+	}
+
+	for i, query := range queries {
+		// Stop between statements once the caller gives up, rather than
+		// leave it to the next statement to fail
+		if err := ctx.Err(); err != nil {
+			return canceledUpdateError(username, i, len(queries), tx != nil, false, err)
+		}
+
+		start := d.timeSource().Now()
+		if err := d.execStatement(ctx, config, exec, query, args[i]...); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return canceledUpdateError(username, i, len(queries), tx != nil, true, ctxErr)
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("timed out updating password for user %s after %s: %w", username, d.since(start).Round(time.Millisecond), err)
+			}
+			if isStandby(err) {
+				return fmt.Errorf("%w: failed to update password for user %s: %w", errStandby, username, describeError(err))
+			}
+			if config.LockTimeout > 0 && isLockTimeout(err) {
+				return fmt.Errorf("failed to update password for user %s: waited longer than lock_timeout %s for a lock: %w", username, config.LockTimeout, describeError(err))
+			}
+			return fmt.Errorf("failed to update password for user %s: %w", username, describeError(err))
+		}
+		if procedure {
+			if err := procedureResult(config.ChangePasswordProcedure, username, resultCode); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, stmt := range post {
+		if err := ctx.Err(); err != nil {
+			return canceledUpdateError(username, len(queries), len(queries), tx != nil, false, err)
+		}
+
+		query := dbutil.QueryHelper(stmt, map[string]string{"username": username})
+		if err := d.execStatement(ctx, config, exec, query); err != nil {
+			outcome := "the password change was rolled back"
+			if tx == nil {
+				outcome = "the password change remains applied"
+			}
+			return fmt.Errorf("%w %d for user %s failed and %s: %w", errPostStatement, i+1, username, outcome, describeError(err))
+		}
+	}
+
+	if tx != nil {
+		if err := ctx.Err(); err != nil {
+			return canceledUpdateError(username, len(queries), len(queries), true, false, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit password update for %s: %w", username, err)
+		}
+	}
+
+	return nil
+}
+
+// procedureCall returns the statement calling a change_password_procedure
+// with the username, password and result code as parameters, followed by
+// args more for the change_password_procedure_args
+func procedureCall(procedure string, args int) string {
+	return fmt.Sprintf("CALL %s(?, ?, ?%s)", procedure, strings.Repeat(", ?", args))
+}
+
+// procedureParamCountQueries return the number of parameters of each
+// procedure with the given name, per platform. A schema condition is
+// appended when the name is qualified.
+var procedureParamCountQueries = map[string]struct{ query, schemaColumn string }{
+	platformLUW: {"SELECT PARM_COUNT FROM SYSCAT.ROUTINES WHERE ROUTINETYPE = 'P' AND ROUTINENAME = ?", "ROUTINESCHEMA"},
+	platformZOS: {"SELECT PARM_COUNT FROM SYSIBM.SYSROUTINES WHERE ROUTINETYPE = 'P' AND NAME = ?", "SCHEMA"},
+}
+
+// checkProcedure checks that a change_password_procedure exists taking the
+// username, password, result code and change_password_procedure_args, so a
+// mismatch is reported at Initialize rather than by the first rotation. An
+// unqualified name matches the procedure in any schema.
+func (d *db2DB) checkProcedure(ctx context.Context) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	procedure := d.config.ChangePasswordProcedure
+	lookup := procedureParamCountQueries[d.config.Platform]
+	query, args := lookup.query, []interface{}{procedure}
+	if schema, name, ok := strings.Cut(procedure, "."); ok {
+		query += " AND " + lookup.schemaColumn + " = ?"
+		args = []interface{}{name, schema}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to look up change_password_procedure %s: %w", procedure, describeError(err))
+	}
+	defer rows.Close()
+
+	want := 3 + len(d.config.ChangePasswordProcedureArgs)
+	var counts []string
+	for rows.Next() {
+		var count int
+		if err := rows.Scan(&count); err != nil {
+			return fmt.Errorf("failed to look up change_password_procedure %s: %w", procedure, describeError(err))
+		}
+		if count == want {
+			return nil
+		}
+		counts = append(counts, strconv.Itoa(count))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look up change_password_procedure %s: %w", procedure, describeError(err))
+	}
+
+	if len(counts) == 0 {
+		return fmt.Errorf("change_password_procedure %s does not exist", procedure)
+	}
+	return fmt.Errorf("change_password_procedure %s takes %s parameters, not %d for the username, password, result code and %d change_password_procedure_args", procedure, strings.Join(counts, " or "), want, len(d.config.ChangePasswordProcedureArgs))
+}
+
+// procedureResult returns an error unless a change_password_procedure
+// reported success with a zero result code
+func procedureResult(procedure, username string, code sql.NullInt64) error {
+	switch {
+	case !code.Valid:
+		return fmt.Errorf("%w: %s returned no result code for user %s", errProcedureFailed, procedure, username)
+	case code.Int64 != 0:
+		return fmt.Errorf("%w: %s returned result code %d for user %s", errProcedureFailed, procedure, code.Int64, username)
+	}
+	return nil
+}
+
+// canceledUpdateError describes a password update whose context was done
+// after ran of total statements had run, so operators can tell what state the
+// user was left in. In a transaction, which database/sql rolls back when its
+// context is done, none of them apply; otherwise they stay applied, and an
+// interrupted statement may or may not have taken effect.
+func canceledUpdateError(username string, ran, total int, transactional, interrupted bool, err error) error {
+	if transactional {
+		return fmt.Errorf("password update for user %s canceled after %d of %d statements; the transaction was rolled back, so none were applied: %w", username, ran, total, err)
+	}
+	if interrupted {
+		return fmt.Errorf("password update for user %s canceled after %d of %d statements were applied; statement %d was interrupted and may have been applied: %w", username, ran, total, ran+1, err)
+	}
+	return fmt.Errorf("password update for user %s canceled after %d of %d statements were applied: %w", username, ran, total, err)
+}
+
+// preflightStatements prepares each query without executing it, so a
+// connection lacking the privileges for one of them fails before any of the
+// statements has run
+func preflightStatements(ctx context.Context, prep preparer, username string, queries []string) error {
+	for i, query := range queries {
+		stmt, err := prep.PrepareContext(ctx, query)
+		if err != nil {
+			if isInsufficientPrivilege(err) {
+				return fmt.Errorf("%w to run password change statement %d for user %s: %w", errInsufficientPrivilege, i+1, username, describeError(err))
+			}
+			return fmt.Errorf("preflight check of password change statement %d for user %s failed: %w", i+1, username, describeError(err))
+		}
+		stmt.Close()
+	}
+
+	return nil
+}
+
+// ValidateStatements prepares each statement, rendered with placeholder
+// values, without executing it, so syntax errors in custom statements are
+// found before they are used. The returned error names each statement that
+// failed to prepare by its position.
+func (d *db2DB) ValidateStatements(ctx context.Context, statements []string) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unqualified names resolve against the schema the statements run in
+	if err := d.setCurrentSchema(ctx, d.config, conn); err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, stmt := range statements {
+		query := dbutil.QueryHelper(stmt, d.config.withLDAPValues(map[string]string{
+			"username":         validationUsername,
+			"password":         validationPassword,
+			"password_escaped": db2EscapeLiteral(validationPassword),
+			"password_quoted":  db2EscapeLiteral(validationPassword),
+			"expiration":       d.timeSource().Now().Format(d.config.ExpirationFormat),
+		}))
+
+		prepared, err := conn.PrepareContext(ctx, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("statement %d failed to prepare: %w", i+1, describeError(err)))
+			continue
+		}
+		prepared.Close()
+	}
+
+	return errors.Join(errs...)
+}
+
+// setCurrentSchema runs SET CURRENT SCHEMA for the configured current_schema,
+// if any, on the connection or transaction the user statements will use
+func (d *db2DB) setCurrentSchema(ctx context.Context, config db2Config, db execer) error {
+	if config.CurrentSchema == "" {
+		return nil
+	}
+
+	if err := d.execStatement(ctx, config, db, "SET CURRENT SCHEMA "+config.CurrentSchema); err != nil {
+		if isUndefinedSchema(err) {
+			return fmt.Errorf("current_schema %s does not exist: %w", config.CurrentSchema, describeError(err))
+		}
+		return fmt.Errorf("failed to set current schema %s: %w", config.CurrentSchema, describeError(err))
+	}
+
+	return nil
+}
+
+// resetLockTimeoutStatement returns CURRENT LOCK TIMEOUT to the server's
+// locktimeout
+const resetLockTimeoutStatement = "SET CURRENT LOCK TIMEOUT NULL"
+
+// lockTimeoutStatement sets CURRENT LOCK TIMEOUT to the lock_timeout
+func (c db2Config) lockTimeoutStatement() string {
+	return fmt.Sprintf("SET CURRENT LOCK TIMEOUT %d", int64(c.LockTimeout/time.Second))
+}
+
+// setLockTimeout sets the lock_timeout on conn for the password change
+// statements
+func (d *db2DB) setLockTimeout(ctx context.Context, config db2Config, conn *sql.Conn) error {
+	if err := d.execStatement(ctx, config, conn, config.lockTimeoutStatement()); err != nil {
+		return fmt.Errorf("failed to set lock timeout: %w", describeError(err))
+	}
+	return nil
+}
+
+// resetLockTimeout restores the server's lock timeout on conn before it
+// returns to the pool. As with resetSessionUser, it runs even when ctx is
+// done, and the connection is discarded if it fails.
+func (d *db2DB) resetLockTimeout(config db2Config, conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := d.execStatement(ctx, config, conn, resetLockTimeoutStatement); err != nil {
+		d.log().Warn("failed to reset the lock timeout, discarding the connection", "error", d.sanitize(describeError(err)).Error())
+		discardConn(conn)
+	}
+}
+
+// statementContext bounds a single statement by statement_timeout when one
+// is configured. A deadline already on ctx still applies, so the statement
+// runs until whichever is earlier.
+func (c db2Config) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.StatementTimeout > 0 {
+		return context.WithTimeout(ctx, c.StatementTimeout)
+	}
+	return ctx, func() {}
+}
+
+// execStatement runs a password change query with args bound to its
+// parameter markers, bounded by statement_timeout when one is configured
+func (d *db2DB) execStatement(ctx context.Context, config db2Config, db execer, query string, args ...interface{}) error {
+	ctx, cancel := config.statementContext(ctx)
+	defer cancel()
+
+	defer d.recordStatement(d.timeSource().Now())
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteUser revokes a dynamic user's access. Statements from the request take
+// precedence over the configured revocation_statements, which in turn take
+// precedence over the default REVOKE CONNECT. Privileges that are already gone
+// are not treated as errors so revocation can be safely retried. On DB2 LUW,
+// privileges held through groups can be revoked with
+// revocation_group_statements, and revocation_group_check warns about any
+// that remain.
+func (d *db2DB) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (resp dbplugin.DeleteUserResponse, err error) {
+	defer func() {
+		d.recordOperation(opDeleteUser, err)
+		d.auditOperation(opDeleteUser, req.Username, err)
+	}()
+
+	if err := d.beginOperation(); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+	defer d.endOperation()
+
+	if req.Username == "" {
+		return dbplugin.DeleteUserResponse{}, fmt.Errorf("username is required")
+	}
+
+	if err := validateIdentifier(req.Username); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+
+	statements := req.Statements.Commands
+	if len(statements) == 0 {
+		statements = d.config.RevocationStatements
+	}
+	if len(statements) == 0 {
+		for _, stmt := range defaultRevocationStatements {
+			statements = append(statements, d.config.quoteIdentifiers(stmt))
+		}
+	}
+	defer func() { d.logOperation(opDeleteUser, req.Username, len(statements), err) }()
+
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+
+	if err := d.revokeUser(ctx, db, req.Username, statements); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+
+	if d.config.RevocationGroupCheck {
+		d.checkGroupAccess(ctx, db, req.Username)
+	}
+
+	return dbplugin.DeleteUserResponse{}, nil
+}
+
+// revokeUser runs the revocation statements for username, and any
+// revocation_group_statements, in one transaction
+func (d *db2DB) revokeUser(ctx context.Context, db txBeginner, username string, statements []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := d.setCurrentSchema(ctx, d.config, tx); err != nil {
+		return err
+	}
+
+	if err := d.execRevocationStatements(ctx, tx, statements, map[string]string{"username": username}); err != nil {
+		return fmt.Errorf("failed to revoke user %s: %w", username, describeError(err))
+	}
+
+	if len(d.config.RevocationGroupStatements) > 0 {
+		if err := d.revokeGroupPrivileges(ctx, tx, username); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit revocation for %s: %w", username, err)
+	}
+	return nil
+}
+
+// validateUsername checks a generated username against the DB2 rules for
+// OS-mapped authorization IDs: at most 8 uppercase letters, digits, @, # or $
+// and _, not starting with a digit or a reserved prefix
+func validateUsername(username string) error {
+	if len(username) == 0 {
+		return fmt.Errorf("generated username is empty")
+	}
+
+	if len(username) > maxUsernameLength {
+		return fmt.Errorf("generated username %q exceeds the DB2 maximum of %d characters", username, maxUsernameLength)
+	}
+
+	if !usernameRegex.MatchString(username) {
+		return fmt.Errorf("generated username %q contains characters not allowed in a DB2 authorization ID", username)
+	}
+
+	for _, prefix := range reservedUsernamePrefixes {
+		if strings.HasPrefix(username, prefix) {
+			return fmt.Errorf("generated username %q must not begin with %s", username, prefix)
+		}
+	}
+
+	return nil
+}
+
+// validateIdentifier checks that username is a legal DB2 authorization ID
+// before it is substituted into statements, which do no quoting of their own
+func validateIdentifier(username string) error {
+	if len(username) > maxIdentifierLength {
+		return fmt.Errorf("username %q exceeds the DB2 maximum of %d characters", username, maxIdentifierLength)
+	}
+
+	if !identifierRegex.MatchString(username) {
+		return fmt.Errorf("username %q contains characters not allowed in a DB2 authorization ID", username)
+	}
+
+	return nil
+}
+
+// db2EscapeLiteral escapes s for use within a DB2 string literal, '...', as
+// the {{password_escaped}} placeholder. Single quotes are doubled; DB2 gives
+// backslashes and double quotes no special meaning in a literal, and a
+// semicolon there does not end the statement, so they are left as they are.
+func db2EscapeLiteral(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// bindPlaceholders replaces each placeholder in stmt that has a value with a
+// ? parameter marker, returning the values to bind in marker order.
+// Placeholders without a value are left in place.
+func bindPlaceholders(stmt string, values map[string]string) (string, []interface{}) {
+	var args []interface{}
+	query := placeholderRegex.ReplaceAllStringFunc(stmt, func(placeholder string) string {
+		value, ok := values[placeholder[2:len(placeholder)-2]]
+		if !ok {
+			return placeholder
+		}
+		args = append(args, value)
+		return "?"
+	})
+
+	return query, args
+}
+
+// withLDAPValues adds the {{user_dn}} placeholder, the distinguished name of
+// the user's directory entry, to values in ldap mode
+func (c db2Config) withLDAPValues(values map[string]string) map[string]string {
+	if c.AuthType == authTypeLDAP {
+		values["user_dn"] = ldapUserDN(c.LDAPUserAttribute, values["username"], c.LDAPBaseDN)
+	}
+	return values
+}
+
+// ldapUserDN returns the DN attribute=username,baseDN, escaping the username
+// as an RFC 4514 attribute value
+func ldapUserDN(attribute, username, baseDN string) string {
+	var value strings.Builder
+	for i, r := range username {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(username)-1):
+			value.WriteByte('\\')
+		}
+		value.WriteRune(r)
+	}
+
+	return attribute + "=" + value.String() + "," + baseDN
+}
+
+// Ping checks that the pooled DB2 connection is alive without changing any
+// credentials. It does not open a connection if the plugin has not been
+// initialized, and secret values are removed from any returned error.
+func (d *db2DB) Ping(ctx context.Context) error {
+	d.initLock.RLock()
+	defer d.initLock.RUnlock()
+
+	if !d.initialized() {
+		return connutil.ErrNotInitialized
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	return d.sanitize(d.verifyConnection(ctx))
+}
+
+// verifyConnection runs the ping_query on the pooled connection. Its result
+// is not inspected, so any read-only query may be configured.
+func (d *db2DB) verifyConnection(ctx context.Context) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := d.runPingQuery(ctx, d.config, db); err != nil {
+		return fmt.Errorf("ping query failed: %w", err)
+	}
+
+	return nil
+}
+
+// runPingQuery runs the ping_query, falling back to the ping_fallback_query
+// when the admin user lacks the privilege the ping_query needs
+func (d *db2DB) runPingQuery(ctx context.Context, config db2Config, q queryer) error {
+	err := runQuery(ctx, q, config.PingQuery)
+	if err == nil || !isInsufficientPrivilege(err) || config.PingFallbackQuery == config.PingQuery {
+		return describeError(err)
+	}
+
+	d.log().Debug("ping query not permitted, running the fallback query", "query", config.PingFallbackQuery)
+	if fallbackErr := runQuery(ctx, q, config.PingFallbackQuery); fallbackErr != nil {
+		return fmt.Errorf("%w; fallback query also failed: %v", describeError(err), describeError(fallbackErr))
+	}
+
+	return nil
+}
+
+// runQuery runs query and reads its first row, so errors the server raises
+// while producing results are reported too
+func runQuery(ctx context.Context, q queryer, query string) error {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rows.Next()
+	return rows.Err()
+}
+
+// retryVerifyConnection verifies the connection, retrying up to
+// init_max_retries times with exponential backoff. Each attempt is bounded by
+// connect_timeout. Authentication failures are not retried, since waiting
+// does not fix them.
+func (d *db2DB) retryVerifyConnection(ctx context.Context, config db2Config) error {
+	for attempt := 0; ; attempt++ {
+		verifyCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+		err := d.verifyConnection(verifyCtx)
+		cancel()
+		if err == nil || attempt >= config.InitMaxRetries || sqlCode(err) == sqlCodeSecurityFailure {
+			return err
+		}
+
+		backoff := config.InitRetryBackoff << attempt
+		d.log().Warn("connection verification failed, retrying", "attempt", attempt+1, "backoff", backoff, "error", d.sanitize(err).Error())
+		select {
+		case <-d.timeSource().After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry interrupted: %v)", err, ctx.Err())
+		}
+	}
+}
+
+// getConnection returns the pooled *sql.DB from the connection producer
+func (d *db2DB) getConnection(ctx context.Context) (*sql.DB, error) {
+	// The producer opens its pool lazily and is not safe for concurrent use,
+	// e.g. by an operation and the keepalive goroutine
+	d.Lock()
+	defer d.Unlock()
+
+	dbConn, err := d.Connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := dbConn.(*sql.DB)
+	if !ok {
+		return nil, fmt.Errorf("unable to use connection")
+	}
+	if db != d.pool && d.failoverDSN != "" && !d.failoverActive {
+		if db, err = d.checkRootLogin(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+	d.pool = db
+
+	return db, nil
+}
+
+// checkRootLogin logs in to a newly opened pool when failover credentials are
+// configured, and switches the connection to them if the server rejects the
+// root credentials. Other failures are left for the operation to report.
+// Called with the producer's lock held.
+func (d *db2DB) checkRootLogin(ctx context.Context, db *sql.DB) (*sql.DB, error) {
+	err := db.PingContext(ctx)
+	if sqlCode(err) != sqlCodeSecurityFailure {
+		d.log().Debug("connecting with the root credentials", "username", d.Username)
+		return db, nil
+	}
+
+	// Read from the failover DSN, which unlike the config is guarded by the
+	// producer's lock, since root rotations call here without initLock
+	failoverUsername, _ := parseConnectionString(d.failoverDSN).get("UID")
+	d.log().Warn("root credentials failed authentication, connecting with the failover credentials",
+		"username", d.Username, "failover_username", failoverUsername, "error", d.sanitize(describeError(err)).Error())
+
+	// The producer reopens its pool, now with the failover credentials,
+	// once it finds this one closed
+	db.Close()
+	d.ConnectionURL = d.failoverDSN
+	d.failoverActive = true
+
+	dbConn, err := d.Connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, ok := dbConn.(*sql.DB)
+	if !ok {
+		return nil, fmt.Errorf("unable to use connection")
+	}
+	return db, nil
+}
+
+// closePool closes the producer's connection pool, which it opens again on
+// next use
+func (d *db2DB) closePool() error {
+	err := d.db2ConnectionProducer.Close()
+	d.Lock()
+	d.pool = nil
+	d.Unlock()
+	return err
+}
+
+// PoolStats returns the statistics of the connection pool, such as its open,
+// in-use and idle connections and how long callers waited for one. It does
+// not open the pool, which happens on first use after Initialize, and
+// returns zero values until then.
+func (d *db2DB) PoolStats() sql.DBStats {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.pool == nil {
+		return sql.DBStats{}
+	}
+	return d.pool.Stats()
+}
+
+// sanitize removes secret values from err, as the error sanitizer middleware
+// does for the dbplugin.Database methods
+func (d *db2DB) sanitize(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	for find, replace := range d.secretValues() {
+		if find == "" {
+			continue
+		}
+		msg = strings.ReplaceAll(msg, find, replace)
+	}
+
+	if msg == err.Error() {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// sanitizerSecrets returns the secret values for the error sanitizer, or
+// none when disable_error_sanitization is set, so errors pass through raw
+func (d *db2DB) sanitizerSecrets() map[string]string {
+	d.initLock.RLock()
+	defer d.initLock.RUnlock()
+
+	if d.config.DisableErrorSanitization {
+		return nil
+	}
+	return d.secretValues()
+}
+
+// secretValues returns the secret values as a map of string to string for
+// error sanitization: the producer's password and connection_url, the
+// certificate settings and files, and the credentials and keystore settings
+// in the connection strings, including those set through connection_params.
+// It takes no locks, so it is safe from the sanitizer middleware and from
+// operations alike; the map must not be modified.
+func (d *db2DB) secretValues() map[string]string {
+	if secrets := d.secrets.Load(); secrets != nil {
+		return *secrets
+	}
+	return map[string]string{}
+}
+
+// updateSecrets rebuilds the values secretValues returns. It is called by
+// Initialize and Reset once they have replaced the config, connection
+// strings and files, and must not be called with the producer's lock held.
+func (d *db2DB) updateSecrets() {
+	d.Lock()
+	secretValuesMap := d.db2ConnectionProducer.SecretValues()
+	d.Unlock()
+
+	result := make(map[string]string)
 	for k, v := range secretValuesMap {
-		if str, ok := v.(string); ok {
+		if str, ok := v.(string); ok && k != "" {
 			result[k] = str
 		}
 	}
-	return result
+	if d.config.SSLServerCertificate != "" {
+		result[d.config.SSLServerCertificate] = "[ssl_server_certificate]"
+	}
+	if d.config.SSLCAFile != "" {
+		result[d.config.SSLCAFile] = "[ssl_ca_file]"
+	}
+	if d.config.SSLKeystorePassword != "" {
+		result[d.config.SSLKeystorePassword] = "[ssl_keystore_password]"
+	}
+	for _, path := range d.tempFiles {
+		result[path] = "[ssl_server_certificate]"
+	}
+	for k, v := range d.urlSecrets {
+		result[k] = v
+	}
+	d.secrets.Store(&result)
 }
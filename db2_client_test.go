@@ -4,10 +4,21 @@
 package db2
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
 )
 
 func TestNew(t *testing.T) {
@@ -50,7 +61,7 @@ func TestInitialize_MissingConnectionURL(t *testing.T) {
 	}
 }
 
-func TestNewUser_NotSupported(t *testing.T) {
+func TestNewUser_EmptyStatements(t *testing.T) {
 	db := newDB2()
 
 	req := dbplugin.NewUserRequest{
@@ -60,22 +71,391 @@ func TestNewUser_NotSupported(t *testing.T) {
 		},
 	}
 
+	_, err := db.NewUser(context.Background(), req)
+	if !errors.Is(err, dbutil.ErrEmptyCreationStatement) {
+		t.Fatalf("expected empty creation statement error, got: %v", err)
+	}
+}
+
+func TestNewUser_MultipleStatements(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "token",
+			RoleName:    "readonly",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{
+				`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+				`GRANT SELECT ON TABLE APP.ORDERS TO USER "{{username}}"`,
+			},
+		},
+		Password:   "secretpass",
+		Expiration: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error creating user: %v", err)
+	}
+
+	if len(resp.Username) == 0 || len(resp.Username) > 8 {
+		t.Fatalf("expected username of 1-8 characters, got: %q", resp.Username)
+	}
+	if resp.Username != strings.ToUpper(resp.Username) {
+		t.Errorf("expected uppercase username, got: %q", resp.Username)
+	}
+
+	expected := []string{
+		fmt.Sprintf(`GRANT CONNECT ON DATABASE TO USER "%s"`, resp.Username),
+		fmt.Sprintf(`GRANT SELECT ON TABLE APP.ORDERS TO USER "%s"`, resp.Username),
+	}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+}
+
+func TestNewUser_Expiration(t *testing.T) {
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 678000000, time.UTC)
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "readonly"},
+		Statements: dbplugin.Statements{
+			Commands: []string{`CALL APP.SET_VALIDITY('{{username}}', TIMESTAMP('{{expiration}}'))`},
+		},
+		Password:   "secretpass",
+		Expiration: expiration,
+	}
+
+	tests := map[string]struct {
+		format   interface{}
+		expected string
+	}{
+		"default": {
+			expected: "2030-01-02-03.04.05.678000",
+		},
+		"custom": {
+			format:   "2006-01-02 15:04:05",
+			expected: "2030-01-02 03:04:05",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf := map[string]interface{}{}
+			if tc.format != nil {
+				conf["expiration_format"] = tc.format
+			}
+			db, srv := newTestDB2(t, conf)
+
+			resp, err := db.NewUser(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error creating user: %v", err)
+			}
+
+			expected := []string{fmt.Sprintf(`CALL APP.SET_VALIDITY('%s', TIMESTAMP('%s'))`, resp.Username, tc.expected)}
+			if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected statements %v, got: %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestNewUser_RollbackOnFailure(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.failOn("APP.ORDERS", fmt.Errorf("SQL0204N \"APP.ORDERS\" is an undefined name"))
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "token",
+			RoleName:    "readonly",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{
+				`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+				`GRANT SELECT ON TABLE APP.ORDERS TO USER "{{username}}"`,
+			},
+		},
+	}
+
 	_, err := db.NewUser(context.Background(), req)
 	if err == nil {
-		t.Fatal("expected error for unsupported NewUser operation")
+		t.Fatal("expected error when a creation statement fails")
+	}
+
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to be applied, got: %v", got)
+	}
+	if srv.rollbackCount() != 1 {
+		t.Errorf("expected transaction to be rolled back, got %d rollbacks", srv.rollbackCount())
 	}
 }
 
-func TestDeleteUser_NotSupported(t *testing.T) {
-	db := newDB2()
+func TestNewUser_CreationGrantStatements(t *testing.T) {
+	conf := map[string]interface{}{
+		"username_template": `{{ printf "APP%s" (.RoleName | truncate 5) | uppercase }}`,
+		"creation_grant_statements": []interface{}{
+			`GRANT ROLE "APP_READ" TO USER "{{username}}"`,
+			`GRANT SELECT ON TABLE APP.ORDERS TO GROUP "REPORTS"`,
+		},
+	}
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{RoleName: "reports"},
+		Statements: dbplugin.Statements{
+			Commands: []string{`GRANT CONNECT ON DATABASE TO USER "{{username}}"`},
+		},
+	}
+
+	t.Run("run after the creation statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+
+		if _, err := db.NewUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+
+		expected := []string{
+			`GRANT CONNECT ON DATABASE TO USER "APPREPOR"`,
+			`GRANT ROLE "APP_READ" TO USER "APPREPOR"`,
+			`GRANT SELECT ON TABLE APP.ORDERS TO GROUP "REPORTS"`,
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("failed grant rolls back the user", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("APP_READ", errors.New(`SQL0204N  "APP_READ" is an undefined name.  SQLSTATE=42704`))
+
+		_, err := db.NewUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "creation_grant_statements statement 1 failed for user APPREPOR: SQLCODE=-204") {
+			t.Fatalf("expected a grant error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be applied, got: %v", got)
+		}
+		if srv.rollbackCount() != 1 {
+			t.Errorf("expected transaction to be rolled back, got %d rollbacks", srv.rollbackCount())
+		}
+	})
+
+	t.Run("empty statement", func(t *testing.T) {
+		_, err := parseConfig(map[string]interface{}{"creation_grant_statements": []interface{}{" "}})
+		if err == nil || !strings.Contains(err.Error(), "creation_grant_statements statement 1 is empty") {
+			t.Errorf("expected an empty statement to be rejected, got: %v", err)
+		}
+	})
+}
+
+func TestDeleteUser_DefaultStatement(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
 
 	req := dbplugin.DeleteUserRequest{
-		Username: "testuser",
+		Username: "V1AB2C3D",
 	}
 
 	_, err := db.DeleteUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error deleting user: %v", err)
+	}
+
+	expected := []string{
+		`REVOKE CONNECT ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE BINDADD ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE CREATETAB ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE CREATE_EXTERNAL_ROUTINE ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE CREATE_NOT_FENCED_ROUTINE ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE IMPLICIT_SCHEMA ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE LOAD ON DATABASE FROM USER "V1AB2C3D"`,
+		`REVOKE QUIESCE_CONNECT ON DATABASE FROM USER "V1AB2C3D"`,
+	}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+}
+
+func TestUpdateUser_ConfiguredChangePasswordStatements(t *testing.T) {
+	configured := `ALTER USER "{{username}}" PASSWORD '{{password}}' ACCOUNT UNLOCK`
+	requested := `ALTER USER "{{username}}" PASSWORD '{{password}}'`
+
+	tests := map[string]struct {
+		conf       map[string]interface{}
+		statements []string
+		expected   string
+	}{
+		"request statements": {
+			conf:       map[string]interface{}{"platform": "zos", "change_password_statements": []interface{}{configured}},
+			statements: []string{requested + " REUSE"},
+			expected:   `ALTER USER "appuser" PASSWORD 'newpassword' REUSE`,
+		},
+		"configured statements": {
+			conf:     map[string]interface{}{"platform": "zos", "change_password_statements": []interface{}{configured}},
+			expected: `ALTER USER "appuser" PASSWORD 'newpassword' ACCOUNT UNLOCK`,
+		},
+		"default statement": {
+			conf:     map[string]interface{}{"platform": "zos"},
+			expected: `ALTER USER "appuser" PASSWORD 'newpassword'`,
+		},
+		// No default statement exists for DB2 LUW
+		"configured statements without a default": {
+			conf:     map[string]interface{}{"change_password_statements": []interface{}{requested}},
+			expected: `ALTER USER "appuser" PASSWORD 'newpassword'`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, tc.conf)
+
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{
+					NewPassword: "newpassword",
+					Statements:  dbplugin.Statements{Commands: tc.statements},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := srv.statements(); !reflect.DeepEqual(got, []string{tc.expected}) {
+				t.Errorf("expected statements %v, got: %v", []string{tc.expected}, got)
+			}
+		})
+	}
+}
+
+func TestDeleteUser_ConfiguredRevocationStatements(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"revocation_statements": []interface{}{
+			`REVOKE SELECT ON TABLE APP.ORDERS FROM USER "{{username}}"`,
+			`REVOKE CONNECT ON DATABASE FROM USER "{{username}}"`,
+		},
+	})
+
+	_, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "V1AB2C3D"})
+	if err != nil {
+		t.Fatalf("unexpected error deleting user: %v", err)
+	}
+
+	expected := []string{
+		`REVOKE SELECT ON TABLE APP.ORDERS FROM USER "V1AB2C3D"`,
+		`REVOKE CONNECT ON DATABASE FROM USER "V1AB2C3D"`,
+	}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	// Statements from the request take precedence over the configured ones
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{
+		Username: "V9ZZ8Y7X",
+		Statements: dbplugin.Statements{
+			Commands: []string{`REVOKE DBADM ON DATABASE FROM USER "{{username}}"`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error deleting user: %v", err)
+	}
+
+	got := srv.statements()
+	if last := got[len(got)-1]; last != `REVOKE DBADM ON DATABASE FROM USER "V9ZZ8Y7X"` {
+		t.Errorf("expected request statement to be used, got: %s", last)
+	}
+}
+
+func TestDeleteUser_AlreadyRevoked(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.failOn("REVOKE", errors.New(`SQL0556N  An attempt to revoke a privilege from "V1AB2C3D" was denied because "V1AB2C3D" does not hold this privilege.  SQLSTATE=42504`))
+
+	req := dbplugin.DeleteUserRequest{
+		Username: "V1AB2C3D",
+	}
+
+	if _, err := db.DeleteUser(context.Background(), req); err != nil {
+		t.Fatalf("expected re-delete to succeed, got: %v", err)
+	}
+}
+
+func TestDeleteUser_Failure(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.failOn("REVOKE CONNECT", errors.New(`SQL0551N  "ADMIN" does not have the required authorization.  SQLSTATE=42501`))
+
+	_, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "V1AB2C3D"})
 	if err == nil {
-		t.Fatal("expected error for unsupported DeleteUser operation")
+		t.Fatal("expected error when revocation fails")
+	}
+}
+
+// fakeTxBeginner wraps the pool, recording the transactions begun through it
+// and failing them with beginErr when set
+type fakeTxBeginner struct {
+	txBeginner
+	beginErr error
+	begins   int
+}
+
+func (e *fakeTxBeginner) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	e.begins++
+	if e.beginErr != nil {
+		return nil, e.beginErr
+	}
+	return e.txBeginner.BeginTx(ctx, opts)
+}
+
+func TestTxBeginner_Transactions(t *testing.T) {
+	newUser := dbplugin.NewUserRequest{
+		Statements: dbplugin.Statements{Commands: []string{`GRANT CONNECT ON DATABASE TO USER {{username}}`}},
+		Password:   "password",
+	}
+	tests := map[string]struct {
+		run      func(db *db2DB, exec txBeginner) error
+		expected []string
+	}{
+		"createUser": {
+			run: func(db *db2DB, exec txBeginner) error {
+				return db.createUser(context.Background(), exec, "V1AB2C3D", newUser)
+			},
+			expected: []string{"GRANT CONNECT ON DATABASE TO USER V1AB2C3D"},
+		},
+		"revokeUser": {
+			run: func(db *db2DB, exec txBeginner) error {
+				return db.revokeUser(context.Background(), exec, "V1AB2C3D", []string{`REVOKE CONNECT ON DATABASE FROM USER {{username}}`})
+			},
+			expected: []string{"REVOKE CONNECT ON DATABASE FROM USER V1AB2C3D"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, nil)
+			pool, err := db.getConnection(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			exec := &fakeTxBeginner{txBeginner: pool, beginErr: errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001")}
+			err = tc.run(db, exec)
+			if err == nil || !strings.Contains(err.Error(), "failed to start transaction") {
+				t.Fatalf("expected the transaction error, got: %v", err)
+			}
+			if got := srv.statements(); len(got) != 0 {
+				t.Errorf("expected no statements to run, got: %v", got)
+			}
+
+			exec = &fakeTxBeginner{txBeginner: pool}
+			if err := tc.run(db, exec); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exec.begins != 1 {
+				t.Errorf("expected one transaction, got %d", exec.begins)
+			}
+			if got := srv.statements(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected statements %v, got: %v", tc.expected, got)
+			}
+			if srv.rollbackCount() != 0 {
+				t.Errorf("expected the transaction to commit, got %d rollbacks", srv.rollbackCount())
+			}
+		})
 	}
 }
 
@@ -203,6 +583,33 @@ func TestUpdateUser_EmptyPassword(t *testing.T) {
 	}
 }
 
+func TestUpdateUser_MaxPasswordLength(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "max_password_length": 14})
+
+	update := func(password string) error {
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: password},
+		})
+		return err
+	}
+
+	err := update("abcdefghijklmno")
+	if err == nil || err.Error() != "new password is 15 characters, exceeding max_password_length 14" {
+		t.Fatalf("expected max_password_length error, got: %v", err)
+	}
+	if got := srv.statements(); len(got) != 0 {
+		t.Fatalf("expected no statements for a rejected password, got: %v", got)
+	}
+
+	if err := update("abcdefghijklmn"); err != nil {
+		t.Fatalf("expected a 14 character password to be accepted, got: %v", err)
+	}
+	if got := srv.statements(); len(got) != 1 {
+		t.Errorf("expected the password change to run, got: %v", got)
+	}
+}
+
 func TestSecretValues(t *testing.T) {
 	db := newDB2()
 
@@ -240,7 +647,3226 @@ func TestConnectionProducer_Type(t *testing.T) {
 		t.Fatal("expected connection producer to be initialized")
 	}
 
-	if db.db2ConnectionProducer.Type != "db2" {
-		t.Errorf("expected connection producer type to be 'db2', got: %s", db.db2ConnectionProducer.Type)
+	if db.db2ConnectionProducer.Type != "go_ibm_db" {
+		t.Errorf("expected connection producer type to be the 'go_ibm_db' driver, got: %s", db.db2ConnectionProducer.Type)
+	}
+}
+
+func TestRotateRootCredentials(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+
+	newPassword, ok := newConf["password"].(string)
+	if !ok || newPassword == "" || newPassword == "adminpass" {
+		t.Fatalf("expected a new password in the returned config, got: %v", newConf["password"])
+	}
+
+	expected := []string{fmt.Sprintf(`ALTER USER "admin" PASSWORD '%s'`, newPassword)}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	if db.Password != newPassword {
+		t.Error("expected in-memory credentials to use the new password")
+	}
+	if _, exists := db.SecretValues()[newPassword]; !exists {
+		t.Error("expected new password to be in secret values")
+	}
+}
+
+func TestRotateRootCredentials_ConfiguredStatements(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"root_rotation_statements": []interface{}{
+			`CALL APP.SET_PASSWORD('{{username}}', '{{password}}')`,
+		},
+	})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+
+	expected := []string{fmt.Sprintf(`CALL APP.SET_PASSWORD('admin', '%s')`, newConf["password"])}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	if _, ok := newConf["root_rotation_statements"]; !ok {
+		t.Error("expected returned config to retain root_rotation_statements")
+	}
+}
+
+func TestRotateRootCredentials_Failure(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.failOn("ALTER USER", errors.New(`SQL0551N  "ADMIN" does not have the required authorization.  SQLSTATE=42501`))
+
+	_, err := db.RotateRootCredentials(context.Background(), nil)
+	if err == nil {
+		t.Fatal("expected error when the rotation statement fails")
+	}
+
+	if db.Password != "adminpass" {
+		t.Errorf("expected in-memory password to be unchanged, got: %s", db.Password)
+	}
+	if db.RawConfig["password"] != "adminpass" {
+		t.Errorf("expected config password to be unchanged, got: %v", db.RawConfig["password"])
+	}
+}
+
+func TestUpdateUser_RootUser(t *testing.T) {
+	for _, username := range []string{"admin", "ADMIN"} {
+		t.Run(username, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: username,
+				Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := []string{fmt.Sprintf(`ALTER USER "%s" PASSWORD 'newadminpass'`, username)}
+			if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected statements %v, got: %v", expected, got)
+			}
+
+			if db.Password != "newadminpass" || db.RawConfig["password"] != "newadminpass" {
+				t.Errorf("expected in-memory credentials to use the new password, got %q", db.Password)
+			}
+
+			// New connections authenticate with the new password
+			if err := db.Ping(context.Background()); err != nil {
+				t.Fatalf("unexpected error pinging: %v", err)
+			}
+			conns := srv.connections()
+			if last := conns[len(conns)-1]; !strings.Contains(last, "PWD=newadminpass") {
+				t.Errorf("expected the new password in the connection string, got %q", last)
+			}
+		})
+	}
+
+	t.Run("statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"root_rotation_statements": []interface{}{`CALL APP.SET_PASSWORD('{{username}}', '{{password}}')`},
+		})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{`CALL APP.SET_PASSWORD('admin', 'newadminpass')`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("trusted context", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "trusted_context": "vault_ctx"})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The admin changes its own password without switching users
+		expected := []string{`ALTER USER "admin" PASSWORD 'newadminpass'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+		srv.failOn("ALTER USER", errors.New(`SQL0551N  "ADMIN" does not have the required authorization.  SQLSTATE=42501`))
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+		})
+		if err == nil {
+			t.Fatal("expected error when the password change fails")
+		}
+		if db.Password != "adminpass" {
+			t.Errorf("expected in-memory password to be unchanged, got: %s", db.Password)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+		if err := db.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+		})
+		if !errors.Is(err, errClosing) {
+			t.Fatalf("expected the closing error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to run, got: %v", got)
+		}
+	})
+
+	t.Run("rotation slot", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":                 "zos",
+			"max_concurrent_rotations": 1,
+		})
+		srv.delayOn("ALTER USER", 300*time.Millisecond)
+
+		go db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		})
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+		})
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "rotation slot") {
+			t.Fatalf("expected the admin rotation to wait for a rotation slot, got: %v", err)
+		}
+	})
+}
+
+func TestRollbackRootCredentials(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+	newPassword := newConf["password"].(string)
+
+	if err := db.RollbackRootCredentials(context.Background()); err != nil {
+		t.Fatalf("unexpected error rolling back root credentials: %v", err)
+	}
+
+	expected := []string{
+		fmt.Sprintf(`ALTER USER "admin" PASSWORD '%s'`, newPassword),
+		`ALTER USER "admin" PASSWORD 'adminpass'`,
+	}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	// The rollback must authenticate with the password now set in DB2
+	connections := srv.connections()
+	if last := connections[len(connections)-1]; !strings.Contains(last, "PWD="+newPassword) {
+		t.Errorf("expected rollback to connect with the rotated password, got: %s", last)
+	}
+
+	if db.Password != "adminpass" || db.RawConfig["password"] != "adminpass" {
+		t.Errorf("expected the previous credentials to be restored, got: %s", db.Password)
+	}
+
+	if err := db.RollbackRootCredentials(context.Background()); err == nil {
+		t.Error("expected error rolling back twice")
+	}
+}
+
+func TestRollbackRootCredentials_Operation(t *testing.T) {
+	t.Run("closed", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+		if _, err := db.RotateRootCredentials(context.Background(), nil); err != nil {
+			t.Fatalf("unexpected error rotating root credentials: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+
+		if err := db.RollbackRootCredentials(context.Background()); !errors.Is(err, errClosing) {
+			t.Fatalf("expected the closing error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 1 {
+			t.Errorf("expected only the rotation to run, got: %v", got)
+		}
+	})
+
+	t.Run("rotation slot", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":                 "zos",
+			"max_concurrent_rotations": 1,
+		})
+		if _, err := db.RotateRootCredentials(context.Background(), nil); err != nil {
+			t.Fatalf("unexpected error rotating root credentials: %v", err)
+		}
+		srv.delayOn(`ALTER USER "appuser"`, 300*time.Millisecond)
+
+		go db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		})
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := db.RollbackRootCredentials(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "rotation slot") {
+			t.Fatalf("expected the rollback to wait for a rotation slot, got: %v", err)
+		}
+	})
+}
+
+func TestRollbackRootCredentials_Failure(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+	srv.failTimes("'adminpass'", 1, errors.New(`SQL0551N  "ADMIN" does not have the required authorization.  SQLSTATE=42501`))
+
+	if err := db.RollbackRootCredentials(context.Background()); err == nil {
+		t.Fatal("expected error when the rollback statement fails")
+	}
+
+	// The rotated credentials stay in use, and the rollback can be retried
+	if db.Password != newConf["password"] {
+		t.Errorf("expected the rotated password to remain in use, got: %s", db.Password)
+	}
+	if err := db.RollbackRootCredentials(context.Background()); err != nil {
+		t.Fatalf("unexpected error retrying rollback: %v", err)
+	}
+	if db.Password != "adminpass" {
+		t.Errorf("expected the previous password to be restored, got: %s", db.Password)
+	}
+}
+
+func TestRollbackRootCredentials_ClearedByInitialize(t *testing.T) {
+	db, _ := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+
+	// Vault re-initializing with the returned config means it was persisted
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: newConf}); err != nil {
+		t.Fatalf("unexpected error initializing: %v", err)
+	}
+
+	if err := db.RollbackRootCredentials(context.Background()); err == nil {
+		t.Error("expected no rollback to be available after Initialize")
+	}
+}
+
+func TestNewUser_UsernameTemplate(t *testing.T) {
+	statements := dbplugin.Statements{
+		Commands: []string{`GRANT CONNECT ON DATABASE TO USER "{{username}}"`},
+	}
+	longName := dbplugin.UsernameMetadata{
+		DisplayName: "kubernetes-service-account-with-a-long-name",
+		RoleName:    "a-very-long-role-name-that-exceeds-limits",
+	}
+
+	t.Run("default template truncates long names", func(t *testing.T) {
+		db, _ := newTestDB2(t, nil)
+
+		resp, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+			UsernameConfig: longName,
+			Statements:     statements,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+
+		if len(resp.Username) > 8 {
+			t.Errorf("expected username to be truncated to 8 characters, got: %q", resp.Username)
+		}
+		if !strings.HasPrefix(resp.Username, "VKA_") {
+			t.Errorf("expected username to start with VKA_, got: %q", resp.Username)
+		}
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{
+			"username_template": `{{ printf "APP%s" (.RoleName | truncate 5) | uppercase }}`,
+		})
+
+		resp, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+			UsernameConfig: dbplugin.UsernameMetadata{RoleName: "reports"},
+			Statements:     statements,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+
+		if resp.Username != "APPREPOR" {
+			t.Errorf("expected username APPREPOR, got: %q", resp.Username)
+		}
+	})
+
+	t.Run("custom template exceeding length", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{
+			"username_template": `{{ .RoleName | uppercase }}`,
+		})
+
+		_, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+			UsernameConfig: longName,
+			Statements:     statements,
+		})
+		if err == nil || !strings.Contains(err.Error(), "exceeds the DB2 maximum") {
+			t.Fatalf("expected length validation error, got: %v", err)
+		}
+	})
+
+	t.Run("custom template with invalid characters", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{
+			"username_template": `{{ .RoleName | truncate 8 }}`,
+		})
+
+		_, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+			UsernameConfig: dbplugin.UsernameMetadata{RoleName: "app-role"},
+			Statements:     statements,
+		})
+		if err == nil || !strings.Contains(err.Error(), "characters not allowed") {
+			t.Fatalf("expected charset validation error, got: %v", err)
+		}
+	})
+}
+
+func TestNewUser_UsernameCollision(t *testing.T) {
+	statements := dbplugin.Statements{
+		Commands: []string{`CREATE ROLE "{{username}}"`, `GRANT ROLE "{{username}}" TO USER "{{username}}"`},
+	}
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{RoleName: "reports"},
+		Statements:     statements,
+	}
+	duplicate := errors.New(`SQL0601N  The name of the object to be created is identical to the existing name "APPREPOR" of type "ROLE".  SQLSTATE=42710`)
+	conf := map[string]interface{}{
+		"username_template":          `{{ printf "APP%s" (.RoleName | truncate 5) | uppercase }}`,
+		"username_collision_retries": 2,
+	}
+
+	t.Run("retries with a suffix", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn(`CREATE ROLE "APPREPOR"`, duplicate)
+
+		resp, err := db.NewUser(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		if resp.Username != "APPREP_1" {
+			t.Errorf("expected username APPREP_1, got: %q", resp.Username)
+		}
+
+		expected := []string{`CREATE ROLE "APPREP_1"`, `GRANT ROLE "APPREP_1" TO USER "APPREP_1"`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("no unique name", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("CREATE ROLE", duplicate)
+
+		_, err := db.NewUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "no unique username found for APPREPOR after 2 retries") {
+			t.Fatalf("expected a collision error, got: %v", err)
+		}
+		if got := srv.rollbackCount(); got != 3 {
+			t.Errorf("expected 3 attempts to be rolled back, got %d", got)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be applied, got: %v", got)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"username_template": conf["username_template"]})
+		srv.failOn("CREATE ROLE", duplicate)
+
+		_, err := db.NewUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "failed to create user APPREPOR: SQLCODE=-601") {
+			t.Fatalf("expected the duplicate error, got: %v", err)
+		}
+		if got := srv.rollbackCount(); got != 1 {
+			t.Errorf("expected 1 attempt, got %d", got)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("CREATE ROLE", errors.New("SQL0551N  SQLSTATE=42501"))
+
+		if _, err := db.NewUser(context.Background(), req); err == nil {
+			t.Fatal("expected error creating user")
+		}
+		if got := srv.rollbackCount(); got != 1 {
+			t.Errorf("expected 1 attempt, got %d", got)
+		}
+	})
+}
+
+func TestUsernameWithSuffix(t *testing.T) {
+	tests := map[string]string{
+		"APP":      "APP_1",
+		"APPREP":   "APPREP_1",
+		"APPREPOR": "APPREP_1",
+	}
+	for username, expected := range tests {
+		if got := usernameWithSuffix(username, 1); got != expected {
+			t.Errorf("usernameWithSuffix(%q, 1) = %q, expected %q", username, got, expected)
+		}
+	}
+	if got := usernameWithSuffix("APPREPOR", 12); got != "APPRE_12" {
+		t.Errorf("expected APPRE_12, got %q", got)
+	}
+}
+
+func TestInitialize_InvalidUsernameTemplate(t *testing.T) {
+	db := newDB2()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":    "DATABASE=testdb;HOSTNAME=localhost;PORT=50000",
+			"username_template": "{{ .RoleName | nonexistent }}",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid username template")
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := map[string]bool{
+		"V1AB2C3D":  true,
+		"APP_RO":    true,
+		"$BATCH":    true,
+		"":          false,
+		"TOOLONGID": false,
+		"app":       false,
+		"1APP":      false,
+		"APP-RO":    false,
+		"SYSADM1":   false,
+	}
+
+	for username, valid := range tests {
+		err := validateUsername(username)
+		if valid && err != nil {
+			t.Errorf("expected %q to be valid, got: %v", username, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %q to be invalid", username)
+		}
+	}
+}
+
+func TestInitialize_MaxConnectionLifetime(t *testing.T) {
+	rotate := func(t *testing.T, db *db2DB) {
+		t.Helper()
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+	}
+
+	t.Run("applied to pool", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{
+			"platform":                "zos",
+			"max_connection_lifetime": "10ms",
+		})
+
+		if db.config.MaxConnectionLifetime != 10*time.Millisecond {
+			t.Fatalf("expected parsed lifetime of 10ms, got: %s", db.config.MaxConnectionLifetime)
+		}
+
+		rotate(t, db)
+		time.Sleep(50 * time.Millisecond)
+		rotate(t, db)
+
+		conn, err := db.getConnection(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get connection: %v", err)
+		}
+		if closed := conn.Stats().MaxLifetimeClosed; closed == 0 {
+			t.Error("expected expired connections to be closed")
+		}
+	})
+
+	t.Run("unset keeps connections", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+		if db.config.MaxConnectionLifetime != 0 {
+			t.Fatalf("expected no lifetime by default, got: %s", db.config.MaxConnectionLifetime)
+		}
+
+		rotate(t, db)
+		time.Sleep(50 * time.Millisecond)
+		rotate(t, db)
+
+		conn, err := db.getConnection(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get connection: %v", err)
+		}
+		if closed := conn.Stats().MaxLifetimeClosed; closed != 0 {
+			t.Errorf("expected no connections closed for lifetime, got: %d", closed)
+		}
+	})
+}
+
+func TestKerberos(t *testing.T) {
+	srv, url := newFakeServer(t)
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	conf := map[string]interface{}{
+		"connection_url":    url + ";UID=admin;PWD=adminpass",
+		"auth_type":         "kerberos",
+		"service_principal": "db2/db2.example.com@EXAMPLE.COM",
+	}
+
+	resp, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf})
+	if err != nil {
+		t.Fatalf("unexpected error initializing in kerberos mode: %v", err)
+	}
+	defer db.Close()
+
+	if resp.Config["auth_type"] != "kerberos" {
+		t.Errorf("expected auth_type to be retained in the returned config, got: %v", resp.Config["auth_type"])
+	}
+
+	for _, keyword := range []string{"AUTHENTICATION=KERBEROS", "TargetPrincipal=db2/db2.example.com@EXAMPLE.COM"} {
+		if !strings.Contains(db.ConnectionURL, keyword) {
+			t.Errorf("expected connection string %q to contain %q", db.ConnectionURL, keyword)
+		}
+	}
+	for _, keyword := range []string{"UID=", "PWD="} {
+		if strings.Contains(db.ConnectionURL, keyword) {
+			t.Errorf("expected connection string %q not to contain %q", db.ConnectionURL, keyword)
+		}
+	}
+
+	_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "not supported in kerberos mode") {
+		t.Fatalf("expected kerberos rotation error, got: %v", err)
+	}
+	if !errors.Is(err, ErrOperationNotSupported) {
+		t.Errorf("expected ErrOperationNotSupported, got: %v", err)
+	}
+
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to be executed, got: %v", got)
+	}
+}
+
+func TestUpdateUser_DefaultStatementPerPlatform(t *testing.T) {
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("zos", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("luw", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, dbutil.ErrEmptyRotationStatement) {
+			t.Fatalf("expected empty rotation statement error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "supply password change statements") {
+			t.Errorf("expected error to instruct operators to supply statements, got: %v", err)
+		}
+
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be executed, got: %v", got)
+		}
+	})
+
+	t.Run("luw with custom statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+
+		custom := req
+		custom.Password = &dbplugin.ChangePassword{
+			NewPassword: "newpassword",
+			Statements: dbplugin.Statements{
+				Commands: []string{`CALL APP.SET_PASSWORD('{{username}}', '{{password}}')`},
+			},
+		}
+
+		if _, err := db.UpdateUser(context.Background(), custom); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{`CALL APP.SET_PASSWORD('appuser', 'newpassword')`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+}
+
+func TestUpdateUser_PreflightPrivilegeCheck(t *testing.T) {
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{
+			NewPassword: "newpassword",
+			Statements: dbplugin.Statements{
+				Commands: []string{
+					`CALL APP.SET_PASSWORD('{{username}}', '{{password}}')`,
+					`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+				},
+			},
+		},
+	}
+
+	t.Run("missing privilege", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"preflight_privilege_check": true})
+		srv.failPrepareOn("GRANT CONNECT", errors.New(`SQL0552N  "ADMIN" does not have the privilege to perform operation "GRANT".  SQLSTATE=42502`))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errInsufficientPrivilege) {
+			t.Fatalf("expected insufficient privilege error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "statement 2") {
+			t.Errorf("expected error to name the failing statement, got: %v", err)
+		}
+
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be executed, got: %v", got)
+		}
+	})
+
+	t.Run("other prepare failure", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"preflight_privilege_check": true})
+		srv.failPrepareOn("APP.SET_PASSWORD", errors.New(`SQL0440N  No authorized routine named "SET_PASSWORD" was found.  SQLSTATE=42884`))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || errors.Is(err, errInsufficientPrivilege) {
+			t.Fatalf("expected a preflight failure other than insufficient privilege, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be executed, got: %v", got)
+		}
+	})
+
+	t.Run("privileges held", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"preflight_privilege_check": true})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{
+			`CALL APP.SET_PASSWORD('appuser', 'newpassword')`,
+			`GRANT CONNECT ON DATABASE TO USER "appuser"`,
+		}
+		if got := srv.preparedStatements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected prepared statements %v, got: %v", expected, got)
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+		srv.failPrepareOn("GRANT CONNECT", errors.New(`SQL0552N  "ADMIN" does not have the privilege to perform operation "GRANT".  SQLSTATE=42502`))
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+		if got := srv.preparedStatements(); len(got) != 0 {
+			t.Errorf("expected no statements to be prepared, got: %v", got)
+		}
+	})
+}
+
+func TestUpdateUser_BindParams(t *testing.T) {
+	password := "p'ss\\w0rd;--"
+
+	t.Run("no default statement", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "use_bind_params": true})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: password},
+		})
+		if !errors.Is(err, dbutil.ErrEmptyRotationStatement) || !strings.Contains(err.Error(), "supply password change statements for appuser with use_bind_params") {
+			t.Fatalf("expected statements to be required, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to run, got: %v", got)
+		}
+	})
+
+	t.Run("ldap", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"use_bind_params":            true,
+			"auth_type":                  "ldap",
+			"ldap_base_dn":               "ou=db2users,dc=example,dc=com",
+			"change_password_statements": []interface{}{"CALL APP.SET_LDAP_PASSWORD({{user_dn}}, {{password}})"},
+		})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "APPUSER",
+			Password: &dbplugin.ChangePassword{NewPassword: password},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{"CALL APP.SET_LDAP_PASSWORD(?, ?)"}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+		expectedArgs := [][]driver.Value{{"uid=APPUSER,ou=db2users,dc=example,dc=com", password}}
+		if got := srv.boundArgs(); !reflect.DeepEqual(got, expectedArgs) {
+			t.Errorf("expected bound args %v, got: %v", expectedArgs, got)
+		}
+	})
+
+	t.Run("custom statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"use_bind_params": true})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{
+				NewPassword: password,
+				Statements: dbplugin.Statements{
+					Commands: []string{
+						"CALL APP.SET_PASSWORD({{password}}, {{username}})",
+						`GRANT CONNECT ON DATABASE TO USER "APPUSER"`,
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{"CALL APP.SET_PASSWORD(?, ?)", `GRANT CONNECT ON DATABASE TO USER "APPUSER"`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+		for _, stmt := range srv.statements() {
+			if strings.Contains(stmt, password) {
+				t.Errorf("expected the password not to appear in the SQL text, got: %s", stmt)
+			}
+		}
+		expectedArgs := [][]driver.Value{{password, "appuser"}}
+		if got := srv.boundArgs(); !reflect.DeepEqual(got, expectedArgs) {
+			t.Errorf("expected bound args %v, got: %v", expectedArgs, got)
+		}
+	})
+}
+
+func TestBindPlaceholders(t *testing.T) {
+	query, args := bindPlaceholders(
+		"CALL P({{username}}, {{password}}, {{password_quoted}}, '{{other}}')",
+		map[string]string{"username": "U", "password": "pw", "password_quoted": "pw"},
+	)
+
+	if query != "CALL P(?, ?, ?, '{{other}}')" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if expected := []interface{}{"U", "pw", "pw"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+}
+
+func TestDB2EscapeLiteral(t *testing.T) {
+	tests := map[string]string{
+		"plain":          "plain",
+		"it's":           "it''s",
+		"''":             "''''",
+		`say "hi"`:       `say "hi"`,
+		`back\slash`:     `back\slash`,
+		"semi;colon":     "semi;colon",
+		`'; DROP USER x`: `''; DROP USER x`,
+	}
+	for password, expected := range tests {
+		if got := db2EscapeLiteral(password); got != expected {
+			t.Errorf("db2EscapeLiteral(%q): expected %q, got %q", password, expected, got)
+		}
+	}
+}
+
+func TestUpdateUser_PasswordSpecialCharacters(t *testing.T) {
+	password := `Pa'ss\"word;--`
+	escaped := `Pa''ss\"word;--`
+
+	tests := map[string]struct {
+		conf       map[string]interface{}
+		statements []string
+		expected   string
+	}{
+		"zos default": {
+			conf:     map[string]interface{}{"platform": "zos"},
+			expected: `ALTER USER "appuser" PASSWORD '` + escaped + `'`,
+		},
+		"password_escaped": {
+			conf:       map[string]interface{}{"platform": "zos"},
+			statements: []string{`CALL APP.SET_PASSWORD('{{username}}', '{{password_escaped}}')`},
+			expected:   `CALL APP.SET_PASSWORD('appuser', '` + escaped + `')`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, tc.conf)
+
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{
+					NewPassword: password,
+					Statements:  dbplugin.Statements{Commands: tc.statements},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := srv.statements(); !reflect.DeepEqual(got, []string{tc.expected}) {
+				t.Errorf("expected statements %v, got: %v", []string{tc.expected}, got)
+			}
+		})
+	}
+
+	t.Run("bind params", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "use_bind_params": true})
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{
+				NewPassword: password,
+				Statements:  dbplugin.Statements{Commands: []string{`CALL APP.SET_PASSWORD({{username}}, {{password_escaped}})`}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Bound values are passed as given
+		expectedArgs := [][]driver.Value{{"appuser", password}}
+		if got := srv.boundArgs(); !reflect.DeepEqual(got, expectedArgs) {
+			t.Errorf("expected bound args %v, got: %v", expectedArgs, got)
+		}
+	})
+}
+
+func TestUpdateUser_LockTimeout(t *testing.T) {
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("set before the statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "lock_timeout": "10s"})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"SET CURRENT LOCK TIMEOUT 10",
+			`ALTER USER "appuser" PASSWORD 'newpassword'`,
+			"SET CURRENT LOCK TIMEOUT NULL",
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("lock timeout", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "lock_timeout": "1s"})
+		srv.failOn("ALTER USER", errors.New(`SQL0911N  The current transaction has been rolled back because of a deadlock or timeout.  Reason code "68".  SQLSTATE=40001`))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "waited longer than lock_timeout 1s for a lock") || !strings.Contains(err.Error(), "SQLCODE=-911") {
+			t.Fatalf("expected a lock timeout error, got: %v", err)
+		}
+
+		// The lock timeout is reset even though the rotation failed
+		expected := []string{"SET CURRENT LOCK TIMEOUT 1", "SET CURRENT LOCK TIMEOUT NULL"}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("not set by default", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, stmt := range srv.statements() {
+			if strings.Contains(stmt, "LOCK TIMEOUT") {
+				t.Errorf("expected no lock timeout statement, got %q", stmt)
+			}
+		}
+	})
+}
+
+func TestParseConfig_LockTimeout(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"lock_timeout": "1m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.LockTimeout != time.Minute {
+		t.Errorf("expected 1m, got %s", config.LockTimeout)
+	}
+
+	for _, timeout := range []string{"-1s", "1500ms"} {
+		if _, err := parseConfig(map[string]interface{}{"lock_timeout": timeout}); err == nil {
+			t.Errorf("expected lock_timeout %s to be rejected", timeout)
+		}
+	}
+}
+
+func TestUpdateUser_ChangePasswordProcedure(t *testing.T) {
+	conf := map[string]interface{}{"change_password_procedure": "audit.change_password"}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+	call := "CALL AUDIT.CHANGE_PASSWORD(?, ?, ?)"
+
+	t.Run("success", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.setOutputs("AUDIT.CHANGE_PASSWORD", int64(0))
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		if got := srv.statements(); !reflect.DeepEqual(got, []string{call}) {
+			t.Errorf("expected statements %v, got: %v", []string{call}, got)
+		}
+		if got := srv.boundArgs(); len(got) != 1 || !reflect.DeepEqual(got[0][:2], []driver.Value{"appuser", "newpassword"}) {
+			t.Errorf("expected the username and password to be bound, got: %v", got)
+		}
+		// The procedure replaces the version-dependent LUW default
+		if n := srv.countQueries("ENV_INST_INFO"); n != 0 {
+			t.Errorf("expected no server version query, got %d", n)
+		}
+	})
+
+	t.Run("nonzero result code", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.setOutputs("AUDIT.CHANGE_PASSWORD", int64(3))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errProcedureFailed) {
+			t.Fatalf("expected a procedure error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "AUDIT.CHANGE_PASSWORD returned result code 3 for user appuser") {
+			t.Errorf("expected the result code in %q", err.Error())
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected the call to be rolled back, got: %v", got)
+		}
+	})
+
+	t.Run("no result code", func(t *testing.T) {
+		db, _ := newTestDB2(t, conf)
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errProcedureFailed) || !strings.Contains(err.Error(), "returned no result code") {
+			t.Fatalf("expected a missing result code error, got: %v", err)
+		}
+	})
+
+	t.Run("role statements take precedence", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+
+		_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{
+				NewPassword: "newpassword",
+				Statements:  dbplugin.Statements{Commands: []string{`ALTER USER "{{username}}" PASSWORD '{{password}}'`}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("extra arguments", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"change_password_procedure":      "audit.change_password",
+			"change_password_procedure_args": []interface{}{"STRICT", "90"},
+		})
+		srv.setOutputs("AUDIT.CHANGE_PASSWORD", int64(0))
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+
+		expected := []string{"CALL AUDIT.CHANGE_PASSWORD(?, ?, ?, ?, ?)"}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+		got := srv.boundArgs()
+		if len(got) != 1 || len(got[0]) != 5 || !reflect.DeepEqual(got[0][:2], []driver.Value{"appuser", "newpassword"}) || !reflect.DeepEqual(got[0][3:], []driver.Value{"STRICT", "90"}) {
+			t.Errorf("expected the arguments to be bound after the result code, got: %v", got)
+		}
+	})
+}
+
+func TestInitialize_ChangePasswordProcedure(t *testing.T) {
+	tests := map[string]struct {
+		procedure string
+		platform  string
+		rows      [][]driver.Value
+		fail      error
+		wantQuery string
+		wantErr   string
+	}{
+		"matches": {
+			procedure: "audit.change_password",
+			rows:      [][]driver.Value{{int64(5)}},
+			wantQuery: "ROUTINENAME = ? AND ROUTINESCHEMA = ?",
+		},
+		"matches an overload": {
+			procedure: "audit.change_password",
+			rows:      [][]driver.Value{{int64(3)}, {int64(5)}},
+		},
+		"unqualified": {
+			procedure: "change_password",
+			rows:      [][]driver.Value{{int64(5)}},
+		},
+		"zos": {
+			procedure: "audit.change_password",
+			platform:  "zos",
+			rows:      [][]driver.Value{{int64(5)}},
+			wantQuery: "SYSIBM.SYSROUTINES WHERE ROUTINETYPE = 'P' AND NAME = ? AND SCHEMA = ?",
+		},
+		"wrong argument count": {
+			procedure: "audit.change_password",
+			rows:      [][]driver.Value{{int64(3)}, {int64(4)}},
+			wantErr:   "change_password_procedure AUDIT.CHANGE_PASSWORD takes 3 or 4 parameters, not 5",
+		},
+		"missing": {
+			procedure: "audit.change_password",
+			rows:      [][]driver.Value{},
+			wantErr:   "change_password_procedure AUDIT.CHANGE_PASSWORD does not exist",
+		},
+		"error": {
+			procedure: "audit.change_password",
+			fail:      errors.New("SQL0551N  SQLSTATE=42501"),
+			wantErr:   "failed to look up change_password_procedure AUDIT.CHANGE_PASSWORD: SQLCODE=-551",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, url := newFakeServer(t)
+			srv.respond("ROUTINES", tc.rows...)
+			if tc.fail != nil {
+				srv.failOn("ROUTINES", tc.fail)
+			}
+
+			db := newDB2()
+			db.db2ConnectionProducer.Type = fakeDriverName
+			defer db.Close()
+
+			conf := map[string]interface{}{
+				"connection_url":                 url,
+				"username":                       "admin",
+				"password":                       "adminpass",
+				"change_password_procedure":      tc.procedure,
+				"change_password_procedure_args": []interface{}{"STRICT", "90"},
+			}
+			if tc.platform != "" {
+				conf["platform"] = tc.platform
+			}
+			_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf, VerifyConnection: true})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantQuery != "" && srv.countQueries(tc.wantQuery) != 1 {
+				t.Errorf("expected a query containing %q, got: %v", tc.wantQuery, srv.queryLog())
+			}
+		})
+	}
+}
+
+func TestUpdateUser_LDAP(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"auth_type":                  "ldap",
+		"ldap_base_dn":               "ou=db2users,dc=example,dc=com",
+		"change_password_statements": []interface{}{`CALL APP.SET_LDAP_PASSWORD('{{user_dn}}', '{{password_escaped}}')`},
+	})
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "APPUSER",
+		Password: &dbplugin.ChangePassword{NewPassword: "new'password"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	req.Password.Statements.Commands = []string{`CALL APP.SET_DIRECTORY_PASSWORD('{{user_dn}}', '{{password_quoted}}')`}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	expected := []string{
+		`CALL APP.SET_LDAP_PASSWORD('uid=APPUSER,ou=db2users,dc=example,dc=com', 'new''password')`,
+		`CALL APP.SET_DIRECTORY_PASSWORD('uid=APPUSER,ou=db2users,dc=example,dc=com', 'new''password')`,
+	}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	// Root rotation has no default to fall back on either
+	_, err := db.RotateRootCredentials(context.Background(), nil)
+	if !errors.Is(err, dbutil.ErrEmptyRotationStatement) || !strings.Contains(err.Error(), "in ldap mode") {
+		t.Errorf("expected root rotation to require statements, got: %v", err)
+	}
+}
+
+func TestLDAPUserDN(t *testing.T) {
+	tests := map[string]string{
+		"APPUSER": "uid=APPUSER,dc=example",
+		"#ADMIN":  `uid=\#ADMIN,dc=example`,
+		"A#B":     "uid=A#B,dc=example",
+		"a,b=c":   `uid=a\,b\=c,dc=example`,
+	}
+	for username, expected := range tests {
+		if got := ldapUserDN("uid", username, "dc=example"); got != expected {
+			t.Errorf("expected %q for %q, got %q", expected, username, got)
+		}
+	}
+}
+
+func TestInitialize_VerifyConnection(t *testing.T) {
+	srv, url := newFakeServer(t)
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		},
+		VerifyConnection: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error verifying connection: %v", err)
+	}
+
+	expected := []string{"SELECT 1 FROM SYSIBM.SYSDUMMY1"}
+	if got := srv.queryLog(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected queries %v, got: %v", expected, got)
+	}
+}
+
+func TestInitialize_VerifyConnectionFailure(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.failOn("SYSDUMMY1", errors.New("SQL30082N  Security processing failed for user admin with password adminpass.  SQLSTATE=08001"))
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	sanitized := dbplugin.NewDatabaseErrorSanitizerMiddleware(db, db.secretValues)
+	_, err := sanitized.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		},
+		VerifyConnection: true,
+	})
+	if err == nil {
+		t.Fatal("expected error when the verification query fails")
+	}
+
+	if !strings.Contains(err.Error(), "error verifying connection") {
+		t.Errorf("expected verification error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "adminpass") {
+		t.Errorf("expected password to be sanitized, got: %v", err)
+	}
+}
+
+func TestInitialize_VerifyRetries(t *testing.T) {
+	unavailable := errors.New("SQL30081N  A communication error has been detected. Communication protocol being used: \"TCP/IP\".  SQLSTATE=08001")
+	authFailure := errors.New("SQL30082N  Security processing failed with reason \"24\" (\"USERNAME AND/OR PASSWORD INVALID\").  SQLSTATE=08001")
+
+	tests := map[string]struct {
+		err         error
+		failures    int
+		retries     int
+		backoff     string
+		timeout     time.Duration
+		wantErr     string
+		wantRetries int
+	}{
+		"succeeds within the budget": {err: unavailable, failures: 2, retries: 2, backoff: "1ms", wantRetries: 2},
+		"budget exhausted":           {err: unavailable, failures: 3, retries: 1, backoff: "1ms", wantErr: "SQLCODE=-30081", wantRetries: 1},
+		"no retries by default":      {err: unavailable, failures: 1, wantErr: "SQLCODE=-30081"},
+		"authentication failure":     {err: authFailure, failures: 1, retries: 2, backoff: "1ms", wantErr: "authentication failed"},
+		"canceled during backoff":    {err: unavailable, failures: 1, retries: 1, backoff: "1m", timeout: 50 * time.Millisecond, wantErr: "retry interrupted", wantRetries: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, url := newFakeServer(t)
+			srv.failTimes("SYSDUMMY1", tc.failures, tc.err)
+
+			db := newDB2()
+			db.db2ConnectionProducer.Type = fakeDriverName
+			var buf bytes.Buffer
+			db.logger = newTestLogger(&buf)
+			defer db.Close()
+
+			config := map[string]interface{}{
+				"connection_url":   url,
+				"username":         "admin",
+				"password":         "adminpass",
+				"init_max_retries": tc.retries,
+			}
+			if tc.backoff != "" {
+				config["init_retry_backoff"] = tc.backoff
+			}
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			_, err := db.Initialize(ctx, dbplugin.InitializeRequest{Config: config, VerifyConnection: true})
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+
+			if got := strings.Count(buf.String(), "connection verification failed, retrying"); got != tc.wantRetries {
+				t.Errorf("expected %d retries, got %d", tc.wantRetries, got)
+			}
+			if strings.Contains(buf.String(), "adminpass") {
+				t.Errorf("expected the retry logs to be sanitized, got:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestUpdateUser_StatementTimeout(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"platform":          "zos",
+		"statement_timeout": "50ms",
+	})
+	srv.delayOn("ALTER USER", time.Minute)
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out updating password for user appuser after") {
+		t.Errorf("expected error to name the user and elapsed time, got: %v", err)
+	}
+}
+
+func TestStatementTimeout_Independent(t *testing.T) {
+	tests := map[string]struct {
+		conf        map[string]interface{}
+		delay       time.Duration
+		ctxTimeout  time.Duration
+		expectError bool
+	}{
+		"connect timeout does not bound statements": {
+			conf:  map[string]interface{}{"connect_timeout": "100ms"},
+			delay: 300 * time.Millisecond,
+		},
+		"statement timeout earlier": {
+			conf:        map[string]interface{}{"connect_timeout": "1m", "statement_timeout": "50ms"},
+			delay:       time.Minute,
+			ctxTimeout:  time.Minute,
+			expectError: true,
+		},
+		"request deadline earlier": {
+			conf:        map[string]interface{}{"statement_timeout": "1m"},
+			delay:       time.Minute,
+			ctxTimeout:  50 * time.Millisecond,
+			expectError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.conf["platform"] = "zos"
+			db, srv := newTestDB2(t, tc.conf)
+			srv.delayOn("ALTER USER", tc.delay)
+
+			ctx := context.Background()
+			if tc.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.ctxTimeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			if !tc.expectError {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded error, got: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the earlier deadline to apply, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestStatementTimeout_NewAndDeleteUser(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"statement_timeout": "50ms"})
+	srv.delayOn("GRANT", time.Minute)
+	srv.delayOn("REVOKE", time.Minute)
+
+	_, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "app"},
+		Statements:     dbplugin.Statements{Commands: []string{`GRANT CONNECT ON DATABASE TO USER "{{username}}"`}},
+		Password:       "newpassword",
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected creation to time out, got: %v", err)
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected revocation to time out, got: %v", err)
+	}
+}
+
+func TestUpdateUser_CanceledBetweenStatements(t *testing.T) {
+	statements := []string{
+		`ALTER USER "{{username}}" PASSWORD '{{password}}'`,
+		`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+		`GRANT DATAACCESS ON DATABASE TO USER "{{username}}"`,
+	}
+
+	tests := map[string]struct {
+		conf      map[string]interface{}
+		expected  string
+		applied   int
+		rollbacks int
+	}{
+		"transactional": {
+			expected:  "canceled after 1 of 3 statements; the transaction was rolled back, so none were applied",
+			rollbacks: 1,
+		},
+		"non-transactional": {
+			conf:     map[string]interface{}{"rotation_non_transactional": true},
+			expected: "canceled after 1 of 3 statements were applied",
+			applied:  1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, tc.conf)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			srv.afterExec("ALTER USER", cancel)
+
+			_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{
+					NewPassword: "newpassword",
+					Statements:  dbplugin.Statements{Commands: statements},
+				},
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got: %v", tc.expected, err)
+			}
+
+			if got := srv.statements(); len(got) != tc.applied {
+				t.Errorf("expected %d statements to be applied, got: %v", tc.applied, got)
+			}
+			for _, query := range srv.statements() {
+				if strings.Contains(query, "GRANT") {
+					t.Errorf("expected no statement to run after cancellation, got %q", query)
+				}
+			}
+			if got := srv.rollbackCount(); got < tc.rollbacks {
+				t.Errorf("expected the transaction to be rolled back, got %d rollbacks", got)
+			}
+		})
+	}
+}
+
+func TestUpdateUser_NoStatementTimeout(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.delayOn("ALTER USER", 100*time.Millisecond)
+
+	if db.config.StatementTimeout != 0 {
+		t.Fatalf("expected no statement timeout by default, got: %s", db.config.StatementTimeout)
+	}
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+}
+
+func TestUpdateUser_RetryTransientErrors(t *testing.T) {
+	commErr := errors.New("SQL30081N  A communication error has been detected. Communication protocol being used: \"TCP/IP\".  SQLSTATE=08001")
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("succeeds within retry budget", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":               "zos",
+			"rotation_max_retries":   3,
+			"rotation_retry_backoff": "1ms",
+		})
+		srv.failTimes("ALTER USER", 2, commErr)
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("expected rotation to succeed after retries, got: %v", err)
+		}
+
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("exhausts retry budget", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":               "zos",
+			"rotation_max_retries":   1,
+			"rotation_retry_backoff": "1ms",
+		})
+		srv.failTimes("ALTER USER", 2, commErr)
+
+		if _, err := db.UpdateUser(context.Background(), req); err == nil {
+			t.Fatal("expected rotation to fail once retries are exhausted")
+		}
+	})
+
+	t.Run("non-retryable error fails immediately", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":               "zos",
+			"rotation_max_retries":   3,
+			"rotation_retry_backoff": "1ms",
+		})
+		srv.failTimes("ALTER USER", 1, errors.New(`SQL0104N  An unexpected token "PASSWORD" was found.  SQLSTATE=42601`))
+
+		if _, err := db.UpdateUser(context.Background(), req); err == nil {
+			t.Fatal("expected syntax error to fail without retry")
+		}
+	})
+
+	t.Run("configured SQLCODE", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{
+			"platform":                  "zos",
+			"rotation_max_retries":      1,
+			"rotation_retry_backoff":    "1ms",
+			"rotation_retryable_errors": []interface{}{"-911"},
+		})
+		srv.failTimes("ALTER USER", 1, errors.New("SQL0911N  The current transaction has been rolled back because of a deadlock or timeout.  SQLSTATE=40001"))
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("expected rotation to succeed after retrying a configured SQLCODE, got: %v", err)
+		}
+	})
+}
+
+func TestPing(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+
+	if err := db.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error pinging: %v", err)
+	}
+
+	expected := []string{"SELECT 1 FROM SYSIBM.SYSDUMMY1"}
+	if got := srv.queryLog(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected queries %v, got: %v", expected, got)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	if stats := newDB2().PoolStats(); stats != (sql.DBStats{}) {
+		t.Errorf("expected zero stats when not initialized, got %+v", stats)
+	}
+
+	db, _ := newTestDB2(t, map[string]interface{}{"max_open_connections": 3})
+	if stats := db.PoolStats(); stats.OpenConnections != 0 {
+		t.Errorf("expected no open connections before first use, got %+v", stats)
+	}
+
+	if err := db.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error pinging: %v", err)
+	}
+	stats := db.PoolStats()
+	if stats.MaxOpenConnections != 3 {
+		t.Errorf("expected max open connections 3, got %d", stats.MaxOpenConnections)
+	}
+	if stats.OpenConnections != 1 || stats.Idle != 1 || stats.InUse != 0 {
+		t.Errorf("expected one idle connection, got %+v", stats)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+	if stats := db.PoolStats(); stats != (sql.DBStats{}) {
+		t.Errorf("expected zero stats after Close, got %+v", stats)
+	}
+}
+
+func TestPing_Failure(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.failOn("SYSDUMMY1", errors.New("SQL30082N  Security processing failed for admin/adminpass.  SQLSTATE=08001"))
+
+	err := db.Ping(context.Background())
+	if err == nil {
+		t.Fatal("expected error when the ping query fails")
+	}
+	if strings.Contains(err.Error(), "adminpass") {
+		t.Errorf("expected password to be sanitized, got: %v", err)
+	}
+}
+
+func TestPing_Timeout(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.delayOn("SYSDUMMY1", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := db.Ping(ctx); err == nil {
+		t.Fatal("expected error when the ping query blocks")
+	}
+}
+
+func TestPing_NotInitialized(t *testing.T) {
+	db := newDB2()
+
+	err := db.Ping(context.Background())
+	if !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Fatalf("expected not initialized error, got: %v", err)
+	}
+}
+
+func TestCurrentSchema(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"current_schema": "app"})
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{
+			NewPassword: "newpass",
+			Statements:  dbplugin.Statements{Commands: []string{"CALL SET_PASSWORD('{{username}}', '{{password}}')"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	_, err = db.NewUser(context.Background(), dbplugin.NewUserRequest{
+		Statements: dbplugin.Statements{Commands: []string{`GRANT SELECT ON TABLE ORDERS TO USER "{{username}}"`}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating user: %v", err)
+	}
+
+	got := srv.statements()
+	if len(got) != 4 {
+		t.Fatalf("expected 4 statements, got: %v", got)
+	}
+	for _, i := range []int{0, 2} {
+		if got[i] != "SET CURRENT SCHEMA APP" {
+			t.Errorf("expected SET CURRENT SCHEMA before user statements, got: %v", got)
+		}
+	}
+	if !strings.HasPrefix(got[1], "CALL SET_PASSWORD") || !strings.HasPrefix(got[3], "GRANT SELECT") {
+		t.Errorf("expected user statements after SET CURRENT SCHEMA, got: %v", got)
+	}
+}
+
+func TestCurrentSchema_Undefined(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"current_schema": "MISSING"})
+	srv.failOn("SET CURRENT SCHEMA", errors.New(`SQL0204N  "MISSING" is an undefined name.  SQLSTATE=42704`))
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{
+			NewPassword: "newpass",
+			Statements:  dbplugin.Statements{Commands: []string{"CALL SET_PASSWORD('{{username}}', '{{password}}')"}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "current_schema MISSING does not exist") {
+		t.Fatalf("expected missing schema error, got: %v", err)
+	}
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to run, got: %v", got)
+	}
+}
+
+func TestInitialize_VerifyConnectTimeout(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.delayOn("SYSDUMMY1", time.Minute)
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	start := time.Now()
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":  url,
+			"username":        "admin",
+			"password":        "adminpass",
+			"connect_timeout": "50ms",
+		},
+		VerifyConnection: true,
+	})
+	if err == nil {
+		t.Fatal("expected error when verification exceeds connect_timeout")
+	}
+
+	if !strings.Contains(err.Error(), "timed out connecting after 50ms") {
+		t.Errorf("expected connect timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected verification to stop at connect_timeout, took %s", elapsed)
+	}
+}
+
+func TestInitialize_VerifyAuthenticationFailure(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.failOn("SYSDUMMY1", errors.New("SQL30082N  Security processing failed with reason \"24\" (\"USERNAME AND/OR PASSWORD INVALID\").  SQLSTATE=08001"))
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		},
+		VerifyConnection: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("expected authentication failure, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected authentication failure not to be reported as a timeout, got: %v", err)
+	}
+}
+
+func TestInitialize_VerifyPasswordExpired(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.failOn("SYSDUMMY1", errors.New("SQL30082N  Security processing failed with reason \"1\" (\"PASSWORD EXPIRED\").  SQLSTATE=08001"))
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		},
+		VerifyConnection: true,
+	})
+	if !errors.Is(err, errPasswordExpired) {
+		t.Fatalf("expected password expired error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "admin password expired; rotate root credentials") {
+		t.Errorf("expected an actionable error, got: %v", err)
+	}
+}
+
+func TestUpdateUser_Transaction(t *testing.T) {
+	statements := []string{
+		"CALL SYSPROC.ADMIN_CMD('SET PASSWORD {{username}} {{password}}')",
+		`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+	}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{
+			NewPassword: "newpassword",
+			Statements:  dbplugin.Statements{Commands: statements},
+		},
+	}
+	grantErr := errors.New("SQL0551N  The statement failed because the authorization ID does not have the required privilege.  SQLSTATE=42501")
+
+	t.Run("commits all statements", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := srv.statements(); len(got) != 2 {
+			t.Errorf("expected both statements to be committed, got: %v", got)
+		}
+		if srv.rollbackCount() != 0 {
+			t.Errorf("expected no rollback, got %d", srv.rollbackCount())
+		}
+	})
+
+	t.Run("rolls back on failure", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+		srv.failOn("GRANT CONNECT", grantErr)
+
+		if _, err := db.UpdateUser(context.Background(), req); err == nil {
+			t.Fatal("expected error when a statement fails")
+		}
+
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be applied, got: %v", got)
+		}
+		if srv.rollbackCount() != 1 {
+			t.Errorf("expected one rollback, got %d", srv.rollbackCount())
+		}
+	})
+
+	t.Run("non-transactional", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"rotation_non_transactional": true})
+		srv.failOn("GRANT CONNECT", grantErr)
+
+		if _, err := db.UpdateUser(context.Background(), req); err == nil {
+			t.Fatal("expected error when a statement fails")
+		}
+
+		expected := []string{"CALL SYSPROC.ADMIN_CMD('SET PASSWORD appuser newpassword')"}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+		if srv.rollbackCount() != 0 {
+			t.Errorf("expected no rollback, got %d", srv.rollbackCount())
+		}
+	})
+}
+
+func TestUpdateUser_PostStatements(t *testing.T) {
+	conf := map[string]interface{}{
+		"platform": "zos",
+		"rotation_post_statements": []interface{}{
+			`GRANT ROLE APP_ROLE TO USER "{{username}}"`,
+			`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+		},
+	}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+	grantErr := errors.New("SQL0551N  The statement failed because the authorization ID does not have the required privilege.  SQLSTATE=42501")
+
+	t.Run("run after the password change", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			`ALTER USER "appuser" PASSWORD 'newpassword'`,
+			`GRANT ROLE APP_ROLE TO USER "appuser"`,
+			`GRANT CONNECT ON DATABASE TO USER "appuser"`,
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("failure rolls back the password change", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("GRANT CONNECT", grantErr)
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errPostStatement) {
+			t.Fatalf("expected a post-statement error, got: %v", err)
+		}
+		expected := "rotation post-statement 2 for user appuser failed and the password change was rolled back: SQLCODE=-551 SQLSTATE=42501 (insufficient privilege)"
+		if err.Error() != expected {
+			t.Errorf("expected %q, got %q", expected, err.Error())
+		}
+
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be applied, got: %v", got)
+		}
+		if srv.rollbackCount() != 1 {
+			t.Errorf("expected one rollback, got %d", srv.rollbackCount())
+		}
+	})
+
+	t.Run("password change failure is not a post-statement error", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("ALTER USER", grantErr)
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || errors.Is(err, errPostStatement) {
+			t.Fatalf("expected a password change error, got: %v", err)
+		}
+		if got := srv.countQueries("GRANT"); got != 0 {
+			t.Errorf("expected no post-statements to run, got %d", got)
+		}
+	})
+
+	t.Run("non-transactional", func(t *testing.T) {
+		nonTx := map[string]interface{}{"rotation_non_transactional": true}
+		for k, v := range conf {
+			nonTx[k] = v
+		}
+		db, srv := newTestDB2(t, nonTx)
+		srv.failOn("GRANT ROLE", grantErr)
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errPostStatement) || !strings.Contains(err.Error(), "the password change remains applied") {
+			t.Fatalf("expected a post-statement error, got: %v", err)
+		}
+
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("not run for root rotation", func(t *testing.T) {
+		rootConf := map[string]interface{}{"root_rotation_statements": []interface{}{`ALTER USER "{{username}}" PASSWORD '{{password}}'`}}
+		for k, v := range conf {
+			rootConf[k] = v
+		}
+		db, srv := newTestDB2(t, rootConf)
+
+		if _, err := db.RotateRootCredentials(context.Background(), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := srv.countQueries("GRANT"); got != 0 {
+			t.Errorf("expected no post-statements to run, got %d", got)
+		}
+	})
+}
+
+func TestUpdateUser_ErrorCodes(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.failOn("ALTER USER", errors.New(`SQL0551N  "ADMIN" does not have the privilege to perform operation "ALTER USER" on "'newpassword'".  SQLSTATE=42501`))
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+
+	expected := "failed to update password for user appuser: SQLCODE=-551 SQLSTATE=42501 (insufficient privilege)"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestUpdateUser_Standby(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.failOn("ALTER USER", errors.New(`SQL1773N  The statement or command requires functionality that is not supported on a read-enabled HADR standby database.  Reason code = "1".  SQLSTATE=08004`))
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if !errors.Is(err, errStandby) {
+		t.Fatalf("expected standby error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "SQLCODE=-1773") {
+		t.Errorf("expected the SQLCODE in %q", err.Error())
+	}
+}
+
+func TestValidateStatements(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.failPrepareOn("ALTR", errors.New(`SQL0104N  An unexpected token "ALTR" was found following "BEGIN-OF-STATEMENT".  SQLSTATE=42601`))
+
+	err := db.ValidateStatements(context.Background(), []string{
+		`ALTER USER "{{username}}" PASSWORD '{{password}}'`,
+		`ALTR USER "{{username}}" PASSWORD '{{password}}'`,
+	})
+	if err == nil {
+		t.Fatal("expected error for the malformed statement")
+	}
+
+	if !strings.Contains(err.Error(), "statement 2 failed to prepare: SQLCODE=-104 SQLSTATE=42601") {
+		t.Errorf("expected the second statement to be reported, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "statement 1") {
+		t.Errorf("expected the valid statement not to be reported, got: %v", err)
+	}
+
+	expected := []string{`ALTER USER "VAULTCHK" PASSWORD 'Validate1234'`}
+	if got := srv.preparedStatements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected prepared statements %v, got: %v", expected, got)
+	}
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to be executed, got: %v", got)
+	}
+}
+
+func TestValidateStatements_Valid(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+
+	err := db.ValidateStatements(context.Background(), []string{
+		`GRANT CONNECT ON DATABASE TO USER "{{username}}"`,
+		"CALL SYSPROC.ADMIN_CMD('SET PASSWORD {{username}} {{password}}')",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := srv.preparedStatements(); len(got) != 2 {
+		t.Errorf("expected both statements to be prepared, got: %v", got)
+	}
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to be executed, got: %v", got)
+	}
+}
+
+func TestUpdateUser_MaxConcurrentRotations(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"platform":                 "zos",
+		"max_open_connections":     10,
+		"max_concurrent_rotations": 2,
+	})
+	srv.delayOn("ALTER USER", 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: fmt.Sprintf("APPUSER%d", i),
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error updating user: %v", err)
+		}
+	}
+	if peak := srv.peakConcurrency(); peak > 2 {
+		t.Errorf("expected at most 2 concurrent rotations, got %d", peak)
+	}
+	if got := len(srv.statements()); got != 6 {
+		t.Errorf("expected 6 password changes, got %d", got)
+	}
+}
+
+func TestUpdateUser_MaxConcurrentRotationsCanceled(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"platform":                 "zos",
+		"max_concurrent_rotations": 1,
+	})
+	srv.delayOn("ALTER USER", 300*time.Millisecond)
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	go db.UpdateUser(context.Background(), req)
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := db.UpdateUser(ctx, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the waiting rotation to give up with the context, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "rotation slot") {
+		t.Errorf("expected error to mention the rotation slot, got: %v", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	// The pooled connection still answers pings but every statement fails
+	srv.restart()
+	if _, err := db.UpdateUser(context.Background(), req); err == nil {
+		t.Fatal("expected error using the broken pool")
+	}
+
+	if err := db.Reset(context.Background()); err != nil {
+		t.Fatalf("unexpected error resetting: %v", err)
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("expected the rebuilt pool to work, got: %v", err)
+	}
+	if got := len(srv.statements()); got != 2 {
+		t.Errorf("expected 2 password changes, got %d", got)
+	}
+}
+
+func TestUpdateUser_ValidateOnBorrow(t *testing.T) {
+	conf := map[string]interface{}{"platform": "zos", "validate_on_borrow": true}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("dead connection is replaced", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The idle pooled connection fails every statement from now on
+		srv.restart()
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("expected the rotation to use a new connection, got: %v", err)
+		}
+
+		if got := len(srv.connections()); got != 2 {
+			t.Errorf("expected 2 connections, got %d", got)
+		}
+		if got := len(srv.statements()); got != 2 {
+			t.Errorf("expected 2 password changes, got %d", got)
+		}
+		if got := srv.countQueries(pingQuery); got != 2 {
+			t.Errorf("expected each successful borrow to be validated, got %d pings", got)
+		}
+	})
+
+	t.Run("replacement is dead too", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn(pingQuery, errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "borrowed connection failed validation: SQLCODE=-30081") {
+			t.Fatalf("expected a validation error, got: %v", err)
+		}
+		if got := len(srv.connections()); got != 2 {
+			t.Errorf("expected one reconnect, got %d connections", got)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to run, got: %v", got)
+		}
+	})
+}
+
+func TestReset_Concurrent(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.restart()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Reset(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error resetting: %v", err)
+		}
+	}
+	if err := db.Ping(context.Background()); err != nil {
+		t.Errorf("expected a working pool after concurrent resets, got: %v", err)
+	}
+}
+
+func TestReset_AfterClose(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	if err := db.Reset(context.Background()); !errors.Is(err, errClosing) {
+		t.Errorf("expected Reset to refuse to reopen a closed plugin, got: %v", err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"keepalive_interval": "10ms"})
+
+	// Open a connection for the pool to keep idle
+	if err := db.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error pinging: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.queryLog()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected keepalive probes, got queries: %v", srv.queryLog())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+	if db.keepaliveDone != nil {
+		t.Error("expected the keepalive goroutine to be stopped by Close")
+	}
+
+	probes := len(srv.queryLog())
+	time.Sleep(50 * time.Millisecond)
+	if got := len(srv.queryLog()); got != probes {
+		t.Errorf("expected no probes after Close, got %d more", got-probes)
+	}
+}
+
+func TestKeepalive_StoppedByInitialize(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"keepalive_interval": "10ms"})
+	done := db.keepaliveDone
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: db.RawConfig})
+	if err != nil {
+		t.Fatalf("unexpected error initializing: %v", err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("expected re-initializing to stop the previous keepalive goroutine")
+	}
+	if db.keepaliveDone == nil || db.keepaliveDone == done {
+		t.Error("expected a new keepalive goroutine for the new config")
+	}
+
+	config := db.RawConfig
+	delete(config, "keepalive_interval")
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config}); err != nil {
+		t.Fatalf("unexpected error initializing: %v", err)
+	}
+	if db.keepaliveDone != nil {
+		t.Error("expected no keepalive goroutine without keepalive_interval")
+	}
+	if got := srv.queryLog(); len(got) != 0 {
+		t.Errorf("expected no probes without idle connections, got: %v", got)
+	}
+}
+
+func TestClose_DrainsInFlightOperations(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	srv.delayOn("ALTER USER", 300*time.Millisecond)
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := db.UpdateUser(context.Background(), req)
+		result <- err
+	}()
+
+	// Let the rotation start before closing
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected Close to wait for the in-flight rotation, returned after %s", elapsed)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected in-flight rotation to complete, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the rotation")
+	}
+
+	if got := srv.statements(); len(got) != 1 {
+		t.Errorf("expected the rotation to be applied, got: %v", got)
+	}
+
+	if _, err := db.UpdateUser(context.Background(), req); !errors.Is(err, errClosing) {
+		t.Errorf("expected connection closing error after Close, got: %v", err)
+	}
+	if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST"}); !errors.Is(err, errClosing) {
+		t.Errorf("expected connection closing error after Close, got: %v", err)
+	}
+}
+
+func TestInitialize_ClosesPreviousPool(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+
+	first, err := db.getConnection(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+
+	conf := map[string]interface{}{
+		"connection_url": db.RawConfig["connection_url"],
+		"username":       "admin",
+		"password":       "newpass",
+	}
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf}); err != nil {
+		t.Fatalf("failed to re-initialize: %v", err)
+	}
+
+	if err := first.Ping(); err == nil || !strings.Contains(err.Error(), "database is closed") {
+		t.Errorf("expected the first pool to be closed, got: %v", err)
+	}
+
+	second, err := db.getConnection(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection after re-initializing: %v", err)
+	}
+	if second == first {
+		t.Error("expected a new pool after re-initializing")
+	}
+}
+
+func TestInitialize_ConcurrentWithUpdateUser(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "keepalive_interval": "5ms"})
+	srv.failOn(`"baduser`, errors.New("SQL0551N  SQLSTATE=42501"))
+	config := db.RawConfig
+
+	// Through the error sanitizer, as Vault calls the plugin, which reads the
+	// secret values whenever an operation fails
+	plugin := sanitized(db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			_, err := plugin.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config, VerifyConnection: true})
+			errs <- err
+		}()
+		go func(i int) {
+			defer wg.Done()
+			_, err := plugin.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: fmt.Sprintf("user%d", i),
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			errs <- err
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := plugin.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: fmt.Sprintf("baduser%d", i),
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			if err == nil {
+				t.Errorf("expected the rotation of baduser%d to fail", i)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			errs <- db.Ping(context.Background())
+			db.PoolStats()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if got := len(srv.statements()); got != 10 {
+		t.Errorf("expected every rotation to be applied, got %d", got)
+	}
+
+	// Close while both are still running leaves no goroutine behind
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		plugin.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config})
+	}()
+	go func() {
+		defer wg.Done()
+		plugin.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "appuser",
+			Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		})
+	}()
+	if err := plugin.Close(); err != nil {
+		t.Errorf("unexpected error closing: %v", err)
+	}
+	wg.Wait()
+}
+
+func TestInitialize_ConcurrentWithRootUpdateUser(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "statement_timeout": "5s"})
+	srv.delayOn("ALTER USER", 20*time.Millisecond)
+	config := db.RawConfig
+
+	// Rotating the admin re-initializes, so it runs without initLock and
+	// must not read the config Initialize replaces
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "admin",
+				Password: &dbplugin.ChangePassword{NewPassword: "newadminpass"},
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if got := len(srv.statements()); got != 20 {
+		t.Errorf("expected every rotation to be applied, got %d", got)
+	}
+}
+
+func TestInitialize_FailoverCredentials(t *testing.T) {
+	tests := map[string]struct {
+		rejectRoot bool
+		uid        string
+		logged     string
+	}{
+		"root credentials work": {uid: "UID=admin", logged: "connecting with the root credentials: username=admin"},
+		"root credentials rejected": {
+			rejectRoot: true,
+			uid:        "UID=vaultbak",
+			logged:     "[WARN]  root credentials failed authentication, connecting with the failover credentials: username=admin failover_username=vaultbak",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, url := newFakeServer(t)
+			if tc.rejectRoot {
+				srv.rejectLogin("admin")
+			}
+
+			db := newDB2()
+			db.db2ConnectionProducer.Type = fakeDriverName
+			var buf bytes.Buffer
+			db.logger = newTestLogger(&buf)
+			defer db.Close()
+
+			_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+				Config: map[string]interface{}{
+					"connection_url":    url,
+					"username":          "admin",
+					"password":          "adminpass",
+					"platform":          "zos",
+					"failover_username": "vaultbak",
+					"failover_password": "backuppass",
+				},
+				VerifyConnection: true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error rotating: %v", err)
+			}
+			if got := srv.statements(); len(got) != 1 {
+				t.Errorf("expected the rotation to be applied, got: %v", got)
+			}
+
+			for _, dsn := range srv.connections() {
+				if !strings.Contains(dsn, tc.uid+";") {
+					t.Errorf("expected connections with %s, got %q", tc.uid, dsn)
+				}
+			}
+			if out := buf.String(); !strings.Contains(out, tc.logged) {
+				t.Errorf("expected log to contain %q, got:\n%s", tc.logged, out)
+			}
+			if _, ok := db.secretValues()["backuppass"]; !ok {
+				t.Error("expected the failover password to be a secret value")
+			}
+
+			_, err = db.RotateRootCredentials(context.Background(), nil)
+			if tc.rejectRoot && (err == nil || !strings.Contains(err.Error(), "while connected with the failover credentials")) {
+				t.Errorf("expected root rotation to be refused, got: %v", err)
+			}
+			if !tc.rejectRoot && err != nil {
+				t.Errorf("unexpected error rotating root credentials: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_FailoverCredentials(t *testing.T) {
+	t.Setenv("DB2_FAILOVER_PASSWORD", "backuppass")
+	config, err := parseConfig(map[string]interface{}{
+		"username":          "admin",
+		"failover_username": "vaultbak",
+		"failover_password": "env:DB2_FAILOVER_PASSWORD",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.FailoverPassword != "backuppass" {
+		t.Errorf("expected the failover password from the environment, got %q", config.FailoverPassword)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"username only":   {"failover_username": "vaultbak"},
+		"password only":   {"failover_password": "backuppass"},
+		"same as root":    {"username": "admin", "failover_username": "ADMIN", "failover_password": "backuppass"},
+		"invalid name":    {"failover_username": "vault bak", "failover_password": "backuppass"},
+		"self managed":    {"self_managed": true, "failover_username": "vaultbak", "failover_password": "backuppass"},
+		"kerberos":        {"auth_type": "kerberos", "service_principal": "db2/host@EXAMPLE.COM", "failover_username": "vaultbak", "failover_password": "backuppass"},
+		"missing env var": {"failover_username": "vaultbak", "failover_password": "env:DB2_UNSET_FAILOVER_PASSWORD"},
+	}
+	for name, conf := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(conf); err == nil {
+				t.Errorf("expected %v to be rejected", conf)
+			}
+		})
+	}
+}
+
+func TestAccountLocked(t *testing.T) {
+	t.Run("connecting", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.rejectLogin("admin")
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		defer db.Close()
+
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+			Config: map[string]interface{}{
+				"connection_url": url,
+				"username":       "admin",
+				"password":       "adminpass",
+			},
+			VerifyConnection: true,
+		})
+		if !errors.Is(err, errAccountLocked) || !strings.Contains(err.Error(), "account locked; contact your DBA to unlock it") {
+			t.Fatalf("expected an account locked error, got: %v", err)
+		}
+	})
+
+	t.Run("rotating", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.rejectLogin("appuser")
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		defer db.Close()
+
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+			Config: map[string]interface{}{
+				"connection_url": url,
+				"platform":       "zos",
+				"self_managed":   true,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to initialize: %v", err)
+		}
+
+		_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username:            "appuser",
+			Password:            &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			SelfManagedPassword: "oldpassword",
+		})
+		if !errors.Is(err, errAccountLocked) || !strings.Contains(err.Error(), "failed to update password for user appuser: account locked") {
+			t.Fatalf("expected an account locked error, got: %v", err)
+		}
+	})
+}
+
+func TestUpdateUser_VerifyAfterRotation(t *testing.T) {
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("new password works", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "verify_after_rotation": true})
+		srv.setPassword("appuser", "newpassword")
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var verified bool
+		for _, dsn := range srv.connections() {
+			cs := parseConnectionString(dsn)
+			uid, _ := cs.get("UID")
+			pwd, _ := cs.get("PWD")
+			verified = verified || (uid == "appuser" && pwd == "newpassword")
+		}
+		if !verified {
+			t.Errorf("expected a connection as the user with the new password, got: %v", srv.connections())
+		}
+	})
+
+	t.Run("new password rejected", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "verify_after_rotation": true})
+		srv.setPassword("appuser", "oldpassword")
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if !errors.Is(err, errVerifyFailed) || !strings.Contains(err.Error(), "authentication failed") {
+			t.Fatalf("expected a verification error, got: %v", err)
+		}
+		if strings.Contains(err.Error(), "restored") {
+			t.Errorf("expected no restore without the previous password, got: %v", err)
+		}
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("restores the previous password when self-managed", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.setPassword("appuser", "oldpassword")
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		defer db.Close()
+
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+			Config: map[string]interface{}{
+				"connection_url":        url,
+				"platform":              "zos",
+				"self_managed":          true,
+				"verify_after_rotation": true,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to initialize: %v", err)
+		}
+
+		_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username:            "appuser",
+			Password:            &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			SelfManagedPassword: "oldpassword",
+		})
+		if !errors.Is(err, errVerifyFailed) || !strings.Contains(err.Error(), "the previous password was restored") {
+			t.Fatalf("expected a verification error after restoring, got: %v", err)
+		}
+
+		expected := []string{
+			`ALTER USER "appuser" PASSWORD 'newpassword'`,
+			`ALTER USER "appuser" PASSWORD 'oldpassword'`,
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+		srv.setPassword("appuser", "oldpassword")
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, dsn := range srv.connections() {
+			if strings.Contains(dsn, "UID=appuser") {
+				t.Errorf("expected no connection as the user, got %q", dsn)
+			}
+		}
+	})
+
+	t.Run("rejected with kerberos", func(t *testing.T) {
+		_, err := parseConfig(map[string]interface{}{
+			"auth_type":             "kerberos",
+			"service_principal":     "db2/host@EXAMPLE.COM",
+			"verify_after_rotation": true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "verify_after_rotation cannot be used") {
+			t.Errorf("expected verify_after_rotation to be rejected, got: %v", err)
+		}
+	})
+}
+
+func TestUpdateUser_SelfManaged(t *testing.T) {
+	srv, url := newFakeServer(t)
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"platform":       "zos",
+			"self_managed":   true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize without admin credentials: %v", err)
+	}
+
+	req := dbplugin.UpdateUserRequest{
+		Username:            "appuser",
+		Password:            &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		SelfManagedPassword: "oldpassword",
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	conns := srv.connections()
+	if len(conns) != 1 || !strings.HasSuffix(conns[0], ";UID=appuser;PWD=oldpassword") {
+		t.Errorf("expected a connection authenticated as the user, got: %v", conns)
+	}
+
+	req.SelfManagedPassword = ""
+	if _, err := db.UpdateUser(context.Background(), req); err == nil || err.Error() != "current password is required in self-managed mode" {
+		t.Errorf("expected current password error, got: %v", err)
+	}
+}
+
+func TestUpdateUser_AdminConnection(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	req := dbplugin.UpdateUserRequest{
+		Username:            "appuser",
+		Password:            &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		SelfManagedPassword: "oldpassword",
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, dsn := range srv.connections() {
+		if !strings.Contains(dsn, "UID=admin;PWD=adminpass") {
+			t.Errorf("expected connections to authenticate as the admin user, got: %q", dsn)
+		}
+	}
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	valid := []string{"appuser", "APP_USER", "db2inst1", "$SVC#1", strings.Repeat("a", 128)}
+	for _, username := range valid {
+		if err := validateIdentifier(username); err != nil {
+			t.Errorf("expected %q to be valid, got: %v", username, err)
+		}
+	}
+
+	invalid := []string{
+		`appuser" PASSWORD 'x'; DROP TABLE ORDERS; --`,
+		"app user",
+		"app'user",
+		"app;user",
+		"1appuser",
+		strings.Repeat("a", 129),
+	}
+	for _, username := range invalid {
+		if err := validateIdentifier(username); err == nil {
+			t.Errorf("expected %q to be rejected", username)
+		}
+	}
+}
+
+func TestUpdateUser_RejectsInjectedUsername(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: `appuser" PASSWORD 'x'; GRANT DBADM ON DATABASE TO USER "mallory`,
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err == nil {
+		t.Fatal("expected injection-style username to be rejected")
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST; DROP TABLE ORDERS"})
+	if err == nil {
+		t.Fatal("expected injection-style username to be rejected")
+	}
+
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to run, got: %v", got)
+	}
+}
+
+func TestUpdateUser_PasswordQuoted(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{
+			NewPassword: "it's-new",
+			Statements:  dbplugin.Statements{Commands: []string{`ALTER USER "{{username}}" PASSWORD '{{password_quoted}}'`}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{`ALTER USER "appuser" PASSWORD 'it''s-new'`}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+}
+
+func TestIdentifierQuoting(t *testing.T) {
+	tests := map[string]struct {
+		quoting        string
+		password       string
+		revocation     string
+		lowercaseValid bool
+	}{
+		"double": {
+			quoting:    "double",
+			password:   `ALTER USER "AppUser" PASSWORD 'newpassword'`,
+			revocation: `REVOKE CONNECT ON DATABASE FROM USER "AppUser"`,
+		},
+		"none": {
+			quoting:        "none",
+			password:       `ALTER USER AppUser PASSWORD 'newpassword'`,
+			revocation:     `REVOKE CONNECT ON DATABASE FROM USER AppUser`,
+			lowercaseValid: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{
+				"platform":           "zos",
+				"identifier_quoting": tc.quoting,
+				"username_template":  `{{ printf "app%s" (.RoleName | truncate 5) }}`,
+			})
+
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "AppUser",
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error updating user: %v", err)
+			}
+			if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "AppUser"}); err != nil {
+				t.Fatalf("unexpected error deleting user: %v", err)
+			}
+
+			expected := []string{tc.password, tc.revocation}
+			if got := srv.statements(); len(got) < 2 || !reflect.DeepEqual(got[:2], expected) {
+				t.Errorf("expected statements %v, got: %v", expected, got)
+			}
+
+			// A lowercase name is only a valid authorization ID once folded
+			_, err = db.NewUser(context.Background(), dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{RoleName: "web"},
+				Statements:     dbplugin.Statements{Commands: []string{`GRANT CONNECT ON DATABASE TO USER "{{username}}"`}},
+				Password:       "newpassword",
+			})
+			if tc.lowercaseValid && err != nil {
+				t.Errorf("expected the folded username to be accepted, got: %v", err)
+			}
+			if !tc.lowercaseValid && (err == nil || !strings.Contains(err.Error(), "characters not allowed")) {
+				t.Errorf("expected the lowercase username to be rejected, got: %v", err)
+			}
+		})
+	}
+
+	if _, err := parseConfig(map[string]interface{}{"identifier_quoting": "single"}); err == nil {
+		t.Error("expected an invalid identifier_quoting to be rejected")
+	}
+}
+
+func TestUpdateUser_Databases(t *testing.T) {
+	prefix := strings.ReplaceAll(t.Name(), "/", "_")
+	sales := newNamedFakeServer(t, prefix+"_SALES")
+	hr := newNamedFakeServer(t, prefix+"_HR")
+	ops := newNamedFakeServer(t, prefix+"_OPS")
+
+	db, primary := newTestDB2(t, map[string]interface{}{
+		"platform":  "zos",
+		"databases": []interface{}{prefix + "_SALES", prefix + "_HR", prefix + "_OPS"},
+	})
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("all succeed", func(t *testing.T) {
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+		for name, srv := range map[string]*fakeServer{"SALES": sales, "HR": hr, "OPS": ops} {
+			if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected statements %v on %s, got: %v", expected, name, got)
+			}
+			for _, dsn := range srv.connections() {
+				if !strings.Contains(dsn, "UID=admin;PWD=adminpass") {
+					t.Errorf("expected %s to be connected to as the admin user, got: %q", name, dsn)
+				}
+			}
+		}
+		if got := primary.statements(); len(got) != 0 {
+			t.Errorf("expected no statements on the configured database, got: %v", got)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		hr.failOn("ALTER USER", errors.New("SQL0551N  The statement failed.  SQLSTATE=42501"))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil {
+			t.Fatal("expected error when a database fails")
+		}
+
+		msg := err.Error()
+		if !strings.Contains(msg, "on "+prefix+"_SALES, "+prefix+"_OPS but failed on") {
+			t.Errorf("expected the succeeded databases to be reported, got: %v", err)
+		}
+		if !strings.Contains(msg, "database "+prefix+"_HR: failed to update password for user appuser: SQLCODE=-551") {
+			t.Errorf("expected the failed database to be reported, got: %v", err)
+		}
+	})
+}
+
+func TestInitialize_ResponseConfigDefaults(t *testing.T) {
+	_, url := newFakeServer(t)
+	conf := map[string]interface{}{
+		"connection_url":    url,
+		"username":          "admin",
+		"password":          "adminpass",
+		"statement_timeout": "45",
+	}
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	resp, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"platform":                  "luw",
+		"auth_type":                 "password",
+		"connect_timeout":           "30s",
+		"ping_query":                "SELECT 1 FROM SYSIBM.SYSDUMMY1",
+		"ping_fallback_query":       "VALUES 1",
+		"application_name":          "vault-db2-plugin",
+		"expiration_format":         "2006-01-02-15.04.05.000000",
+		"statement_timeout":         "45",
+		"max_connection_lifetime":   "0s",
+		"rotation_max_retries":      0,
+		"rotation_retry_backoff":    "1s",
+		"rotation_retryable_errors": []string{"-30081", "08S01", "40003"},
+	}
+	for k, v := range expected {
+		if got := resp.Config[k]; !reflect.DeepEqual(got, v) {
+			t.Errorf("expected %s to be %v, got: %v", k, v, got)
+		}
+	}
+
+	for k := range resp.Config {
+		if _, ok := conf[k]; !ok {
+			if _, ok := expected[k]; !ok {
+				t.Errorf("unexpected key %q in response config", k)
+			}
+		}
+	}
+	if resp.Config["password"] != "adminpass" {
+		t.Errorf("expected the password to be returned unchanged, got: %v", resp.Config["password"])
+	}
+	if _, ok := conf["platform"]; ok {
+		t.Error("expected the request config not to be modified")
+	}
+
+	// The returned config must be accepted when Vault replays it
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: resp.Config}); err != nil {
+		t.Fatalf("failed to re-initialize with the returned config: %v", err)
+	}
+}
+
+func TestInitialize_WarmupConnections(t *testing.T) {
+	initialize := func(t *testing.T, url string, conf map[string]interface{}, verify bool) (*db2DB, error) {
+		config := map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		}
+		for k, v := range conf {
+			config[k] = v
+		}
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		t.Cleanup(func() { db.Close() })
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config, VerifyConnection: verify})
+		return db, err
+	}
+
+	t.Run("opens connections", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		db, err := initialize(t, url, map[string]interface{}{"warmup_connections": 3}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(srv.connections()); got != 3 {
+			t.Errorf("expected 3 connections, got %d", got)
+		}
+		if got := srv.countQueries(pingQuery); got != 3 {
+			t.Errorf("expected each connection to be pinged, got %d pings", got)
+		}
+		sqlDB, _ := db.getConnection(context.Background())
+		if idle := sqlDB.Stats().Idle; idle != 3 {
+			t.Errorf("expected 3 idle connections, got %d", idle)
+		}
+	})
+
+	t.Run("capped at max_idle_connections", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		if _, err := initialize(t, url, map[string]interface{}{"warmup_connections": 5, "max_idle_connections": 2}, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(srv.connections()); got != 2 {
+			t.Errorf("expected 2 connections, got %d", got)
+		}
+	})
+
+	t.Run("reuses the verified connection", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.5.8.0"})
+		if _, err := initialize(t, url, map[string]interface{}{"warmup_connections": 2}, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := len(srv.connections()); got != 2 {
+			t.Errorf("expected 2 connections, got %d", got)
+		}
+	})
+
+	t.Run("partial failure is logged", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.limitConnections(2)
+
+		var buf bytes.Buffer
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		db.logger = newTestLogger(&buf)
+		defer db.Close()
+
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: map[string]interface{}{
+			"connection_url":     url,
+			"username":           "admin",
+			"password":           "adminpass",
+			"warmup_connections": 3,
+		}})
+		if err != nil {
+			t.Fatalf("expected the failure not to abort Initialize, got: %v", err)
+		}
+
+		logs := buf.String()
+		if !strings.Contains(logs, "failed to warm up connections") || !strings.Contains(logs, "opened 2 of 3 connections") {
+			t.Errorf("expected the failure to be logged, got:\n%s", logs)
+		}
+		if strings.Contains(logs, "adminpass") {
+			t.Errorf("expected the logged error to be sanitized, got:\n%s", logs)
+		}
+	})
+
+	t.Run("partial failure with verification", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.5.8.0"})
+		srv.limitConnections(2)
+
+		_, err := initialize(t, url, map[string]interface{}{"warmup_connections": 3}, true)
+		if err == nil || !strings.Contains(err.Error(), "error warming up connections: opened 2 of 3 connections: SQLCODE=-1040") {
+			t.Fatalf("expected Initialize to fail, got: %v", err)
+		}
+	})
+}
+
+func TestPing_FallbackQuery(t *testing.T) {
+	notPermitted := errors.New(`SQL0551N  "ADMIN" does not have the required authorization or privilege to perform operation "SELECT" on object "SYSIBM.SYSDUMMY1".  SQLSTATE=42501`)
+
+	t.Run("primary not permitted", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+		srv.failOn(pingQuery, notPermitted)
+
+		if err := db.Ping(context.Background()); err != nil {
+			t.Fatalf("expected the fallback query to succeed, got: %v", err)
+		}
+		if got := srv.queryLog(); !reflect.DeepEqual(got, []string{"VALUES 1"}) {
+			t.Errorf("expected the default fallback query to run, got: %v", got)
+		}
+	})
+
+	t.Run("custom fallback", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"ping_fallback_query": "VALUES CURRENT SERVER"})
+		srv.failOn(pingQuery, notPermitted)
+
+		if err := db.Ping(context.Background()); err != nil {
+			t.Fatalf("expected the fallback query to succeed, got: %v", err)
+		}
+		if got := srv.queryLog(); !reflect.DeepEqual(got, []string{"VALUES CURRENT SERVER"}) {
+			t.Errorf("expected the configured fallback query to run, got: %v", got)
+		}
+	})
+
+	t.Run("both fail", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+		srv.failOn(pingQuery, notPermitted)
+		srv.failOn("VALUES 1", errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+
+		err := db.Ping(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "SQLCODE=-551") || !strings.Contains(err.Error(), "fallback query also failed: SQLCODE=-30081") {
+			t.Fatalf("expected both failures to be reported, got: %v", err)
+		}
+	})
+
+	t.Run("other errors do not fall back", func(t *testing.T) {
+		db, srv := newTestDB2(t, nil)
+		srv.failOn(pingQuery, errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+
+		if err := db.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "SQLCODE=-30081") {
+			t.Fatalf("expected the ping error, got: %v", err)
+		}
+		if got := srv.queryLog(); len(got) != 0 {
+			t.Errorf("expected no fallback query, got: %v", got)
+		}
+	})
+
+	t.Run("initialize", func(t *testing.T) {
+		srv, url := newFakeServer(t)
+		srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.5.8.0"})
+		srv.failOn(pingQuery, notPermitted)
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		defer db.Close()
+
+		_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+			Config: map[string]interface{}{
+				"connection_url": url,
+				"username":       "admin",
+				"password":       "adminpass",
+			},
+			VerifyConnection: true,
+		})
+		if err != nil {
+			t.Fatalf("expected verification to succeed with the fallback query, got: %v", err)
+		}
+	})
+}
+
+func TestPing_CustomQuery(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"ping_query": "VALUES CURRENT TIMESTAMP"})
+	srv.respond("CURRENT TIMESTAMP", []driver.Value{time.Now(), "extra column"})
+
+	if err := db.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error pinging: %v", err)
+	}
+
+	expected := []string{"VALUES CURRENT TIMESTAMP"}
+	if got := srv.queryLog(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected queries %v, got: %v", expected, got)
 	}
 }
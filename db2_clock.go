@@ -0,0 +1,40 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import "time"
+
+// Clock is the plugin's source of the current time, used for {{expiration}}
+// in validated statements, audit event times, statement durations and retry
+// backoff
+type Clock interface {
+	Now() time.Time
+
+	// After returns a channel that receives the time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// timeSource returns the configured Clock, or real time if none is set
+func (d *db2DB) timeSource() Clock {
+	if d.clock != nil {
+		return d.clock
+	}
+	return realClock{}
+}
+
+// since returns the time elapsed since start by the plugin's Clock
+func (d *db2DB) since(start time.Time) time.Duration {
+	return d.timeSource().Now().Sub(start)
+}
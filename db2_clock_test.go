@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// fakeClock is a Clock whose time only moves when After is called, which
+// records the duration and fires at once
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waited []time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waited = append(c.waited, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waited...)
+}
+
+var fakeNow = time.Date(2026, time.March, 14, 9, 26, 53, 589793000, time.UTC)
+
+func TestClock_RotationRetryBackoff(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"platform":               "zos",
+		"rotation_max_retries":   3,
+		"rotation_retry_backoff": "1m",
+	})
+	clock := newFakeClock(fakeNow)
+	db.clock = clock
+	srv.failTimes("ALTER USER", 3, errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err != nil {
+		t.Fatalf("expected rotation to succeed after retries, got: %v", err)
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}
+	if got := clock.waits(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected backoffs %v, got: %v", expected, got)
+	}
+}
+
+func TestClock_InitRetryBackoff(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.failTimes("SYSDUMMY1", 2, errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	clock := newFakeClock(fakeNow)
+	db.clock = clock
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":     url,
+			"username":           "admin",
+			"password":           "adminpass",
+			"init_max_retries":   2,
+			"init_retry_backoff": "30s",
+		},
+		VerifyConnection: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []time.Duration{30 * time.Second, time.Minute}
+	if got := clock.waits(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected backoffs %v, got: %v", expected, got)
+	}
+}
+
+func TestClock_Expiration(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	db.clock = newFakeClock(fakeNow)
+
+	err := db.ValidateStatements(context.Background(), []string{
+		`CREATE ROLE "{{username}}" COMMENT 'expires {{expiration}}'`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{`CREATE ROLE "VAULTCHK" COMMENT 'expires 2026-03-14-09.26.53.589793'`}
+	if got := srv.preparedStatements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected prepared statements %v, got: %v", expected, got)
+	}
+}
+
+func TestClock_AuditTime(t *testing.T) {
+	db, _ := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	db.clock = newFakeClock(fakeNow)
+	hook := &recordingHook{}
+	db.SetAuditHook(hook)
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	events := hook.recorded()
+	if len(events) != 1 || !events[0].Time.Equal(fakeNow) {
+		t.Errorf("expected one event at %s, got: %+v", fakeNow, events)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	clock := newFakeClock(fakeNow)
+	db := newDB2()
+	WithClock(clock)(db)
+
+	if got := db.timeSource().Now(); !got.Equal(fakeNow) {
+		t.Errorf("expected the injected clock, got %s", got)
+	}
+	if _, ok := newDB2().timeSource().(realClock); !ok {
+		t.Error("expected real time by default")
+	}
+}
@@ -0,0 +1,1099 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	authTypePassword = "password"
+	authTypeKerberos = "kerberos"
+	authTypeLDAP     = "ldap"
+
+	defaultLDAPAuthentication = "SERVER_ENCRYPT"
+	defaultLDAPUserAttribute  = "uid"
+
+	platformLUW = "luw"
+	platformZOS = "zos"
+
+	identifierQuotingDouble = "double"
+	identifierQuotingNone   = "none"
+
+	productDB2       = "db2"
+	productWarehouse = "warehouse"
+
+	maxSchemaLength = 128
+
+	// maxProcedureArgs is the most parameters DB2 allows a procedure, less
+	// the username, password and result code
+	maxProcedureArgs = 32767 - 3
+
+	// envReferencePrefix marks a username or password to be read from the
+	// named environment variable, e.g. env:DB2_PASSWORD
+	envReferencePrefix = "env:"
+
+	// maxTargetMember is the highest member or partition number ConnectNode
+	// accepts
+	maxTargetMember = 999
+
+	// defaultApplicationName identifies the plugin's connections in DB2's
+	// monitoring views, such as APPLICATION_NAME in MON_GET_CONNECTION
+	defaultApplicationName = "vault-db2-plugin"
+
+	// maxApplicationNameLength is the longest program name the DB2 client
+	// sends to the server, in bytes
+	maxApplicationNameLength = 20
+
+	// defaultMaxOpenConnections is the SQL connection producer's default
+	// for max_open_connections
+	defaultMaxOpenConnections = 4
+
+	defaultRotationRetryBackoff = time.Second
+	defaultInitRetryBackoff     = time.Second
+	defaultConnectTimeout       = 30 * time.Second
+	defaultReloadInterval       = 30 * time.Second
+)
+
+// knownCodePages are the code page numbers DB2 clients support for character
+// data: Unicode, the ISO 8859 and Windows single-byte sets, the common EBCDIC
+// CCSIDs of DB2 for z/OS and the double-byte Asian sets
+var knownCodePages = map[int]bool{
+	// Unicode
+	1200: true, 1208: true,
+	// ISO 8859, Windows and PC ASCII
+	437: true, 819: true, 850: true, 852: true, 855: true, 857: true, 862: true, 864: true, 866: true,
+	874: true, 912: true, 915: true, 916: true, 920: true, 923: true,
+	1250: true, 1251: true, 1252: true, 1253: true, 1254: true, 1255: true, 1256: true, 1257: true,
+	// EBCDIC
+	37: true, 273: true, 277: true, 278: true, 280: true, 284: true, 285: true, 297: true, 500: true, 871: true, 875: true,
+	1047: true, 1140: true, 1141: true, 1142: true, 1143: true, 1144: true, 1145: true, 1146: true, 1147: true, 1148: true, 1149: true,
+	930: true, 933: true, 935: true, 937: true, 939: true, 1390: true, 1399: true,
+	// Double-byte and EUC
+	932: true, 943: true, 949: true, 950: true, 954: true, 964: true, 970: true, 1363: true, 1370: true, 1381: true, 1383: true, 1386: true, 1392: true, 5488: true,
+}
+
+// dsnAliasRegex matches DB2 database aliases, which are at most 8 characters
+var dsnAliasRegex = regexp.MustCompile(`^[A-Za-z@#$][A-Za-z0-9@#$_]{0,7}$`)
+
+// pingQueryRegex matches the statements accepted as ping_query and
+// ping_fallback_query
+var pingQueryRegex = regexp.MustCompile(`(?i)^\s*(SELECT|VALUES)\b`)
+
+// writeKeywordRegex matches keywords that modify data or objects, which a
+// ping_query must not contain
+var writeKeywordRegex = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE|TRUNCATE|CREATE|ALTER|DROP|RENAME|GRANT|REVOKE|CALL|SET|LOCK)\b`)
+
+// initSQLRegex matches the statements accepted as init_sql
+var initSQLRegex = regexp.MustCompile(`(?i)^\s*SET\b`)
+
+// ddlKeywordRegex matches keywords that define or change objects or
+// privileges, which init_sql must not contain
+var ddlKeywordRegex = regexp.MustCompile(`(?i)\b(CREATE|ALTER|DROP|RENAME|GRANT|REVOKE|TRUNCATE|COMMENT)\b`)
+
+// sessionUserRegex matches switches of the session user, which would leave
+// the pool connected as someone other than the admin
+var sessionUserRegex = regexp.MustCompile(`(?i)^\s*SET\s+(SESSION\s+AUTHORIZATION|SESSION_USER)\b`)
+
+// ldapAuthentications are the Authentication mechanisms the DB2 LDAP
+// security plugin can validate a password with
+var ldapAuthentications = map[string]struct{}{
+	"SERVER":             {},
+	"SERVER_ENCRYPT":     {},
+	"SERVER_ENCRYPT_AES": {},
+	"DATA_ENCRYPT":       {},
+}
+
+// authentications are the Authentication mechanisms accepted in password mode
+var authentications = map[string]struct{}{
+	"SERVER":             {},
+	"SERVER_ENCRYPT":     {},
+	"SERVER_ENCRYPT_AES": {},
+	"DATA_ENCRYPT":       {},
+	"GSSPLUGIN":          {},
+}
+
+// ldapAttributeRegex matches an LDAP attribute type name
+var ldapAttributeRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// schemaRegex matches an ordinary (unquoted) DB2 schema name once uppercased
+var schemaRegex = regexp.MustCompile(`^[A-Z@#$][A-Z0-9@#$_]*$`)
+
+// defaultStatementConfigKey reports the default password change statement
+// for the verified server in the Initialize response config. It is output
+// only and ignored when read back.
+const defaultStatementConfigKey = "default_rotation_statement"
+
+// db2Config holds the DB2-specific configuration parsed during Initialize
+type db2Config struct {
+	// URLEncoded percent-decodes each value in the connection_url, e.g. a
+	// password written as p%3Bss, before the connection string is built
+	URLEncoded bool `mapstructure:"url_encoded"`
+
+	// ConnectionURLFile is a path to a file holding the connection_url, e.g.
+	// a mounted secret, read in its place at Initialize and Reset
+	ConnectionURLFile string `mapstructure:"connection_url_file"`
+
+	// PasswordFile is a path to a file holding the root password, read in
+	// place of password at Initialize and Reset
+	PasswordFile string `mapstructure:"password_file"`
+
+	// ReloadOnChange polls the connection_url_file and password_file every
+	// ReloadInterval and resets the pool when either changes, so the next
+	// connection uses the new credentials
+	ReloadOnChange bool          `mapstructure:"reload_on_change"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+
+	// Platform is the DB2 server platform: luw (the default) or zos
+	Platform string `mapstructure:"platform"`
+
+	// Product is the DB2 product served at the connection_url: db2 (the
+	// default) or warehouse, for Db2 Warehouse, which applies its SSL
+	// defaults
+	Product string `mapstructure:"product"`
+
+	// AlternateHosts are host:port addresses of DB2 LUW HADR standbys the
+	// driver reroutes connections to when the primary is unavailable
+	AlternateHosts []string `mapstructure:"alternate_hosts"`
+
+	// DSNAlias is a database alias catalogued in the DB2 client, connected
+	// to as DSN=<alias> in place of the host, port and database name
+	DSNAlias string `mapstructure:"dsn_alias"`
+
+	// Location is the DB2 for z/OS location name, which takes the place of
+	// the database name in the connection string
+	Location string `mapstructure:"location"`
+
+	// TargetMember pins connections to a pureScale member or partition by
+	// number, so password changes reach the node that applies them; nil lets
+	// the driver choose
+	TargetMember *int `mapstructure:"target_member"`
+
+	// CodePage is the application code page the driver converts character
+	// data to and from, set as the CODEPAGE keyword, so usernames and
+	// passwords outside ASCII survive EBCDIC and other non-UTF-8 servers;
+	// zero leaves the driver's default
+	CodePage int `mapstructure:"code_page"`
+
+	// ApplicationName is sent as the ProgramName keyword so DBAs can tell the
+	// plugin's connections apart in DB2's monitoring views
+	ApplicationName string `mapstructure:"application_name"`
+
+	// Username and Password are the root credentials, which are also consumed
+	// by the SQL connection producer. Either may be given as env:NAME to read
+	// it from the environment variable NAME.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// FailoverUsername and FailoverPassword are a second admin credential the
+	// plugin connects with when the server rejects the root credentials,
+	// e.g. because the account is locked. Either may be given as env:NAME.
+	FailoverUsername string `mapstructure:"failover_username"`
+	FailoverPassword string `mapstructure:"failover_password"`
+
+	// AuthType selects password (the default), kerberos or ldap
+	// authentication. In kerberos mode ServicePrincipal names the DB2
+	// server's principal.
+	AuthType         string `mapstructure:"auth_type"`
+	ServicePrincipal string `mapstructure:"service_principal"`
+
+	// Authentication is the mechanism passed to the driver as Authentication
+	// in password mode, e.g. SERVER_ENCRYPT to require encrypted credentials;
+	// empty leaves it to the connection_url and the server
+	Authentication string `mapstructure:"authentication"`
+
+	// In ldap mode, users are entries named LDAPUserAttribute=<username>
+	// under LDAPBaseDN, and LDAPAuthentication is the mechanism passed to
+	// the driver as Authentication
+	LDAPBaseDN         string `mapstructure:"ldap_base_dn"`
+	LDAPUserAttribute  string `mapstructure:"ldap_user_attribute"`
+	LDAPAuthentication string `mapstructure:"ldap_authentication"`
+
+	// CurrentSchema is set on the connection before user statements run, so
+	// they may refer to unqualified objects in it
+	CurrentSchema string `mapstructure:"current_schema"`
+
+	// InitSQL are SET statements run on each new connection, e.g. SET
+	// CURRENT DEGREE = 'ANY', so every connection has the same session state
+	InitSQL []string `mapstructure:"init_sql"`
+
+	// IdentifierQuoting is double (the default) to double-quote {{username}}
+	// in the default statements, so it is used exactly as given, or none to
+	// leave it unquoted, so DB2 folds it to uppercase
+	IdentifierQuoting string `mapstructure:"identifier_quoting"`
+
+	// ChangePasswordProcedure is an optionally schema-qualified stored
+	// procedure called instead of the default password change statement,
+	// with the username and password bound to its first two parameters. It
+	// must report its outcome in an INTEGER OUT third parameter, where 0 is
+	// success.
+	ChangePasswordProcedure string `mapstructure:"change_password_procedure"`
+
+	// ChangePasswordProcedureArgs are static values, e.g. a policy code,
+	// bound to the change_password_procedure's parameters after the result
+	// code
+	ChangePasswordProcedureArgs []string `mapstructure:"change_password_procedure_args"`
+
+	// ChangePasswordStatements are run by UpdateUser when the request
+	// supplies none, in place of the default password change statement
+	ChangePasswordStatements []string `mapstructure:"change_password_statements"`
+
+	// CreationGrantStatements are run by NewUser after the role's creation
+	// statements, in the same transaction, e.g. to grant the user a role
+	CreationGrantStatements []string `mapstructure:"creation_grant_statements"`
+
+	// RevocationStatements are run by DeleteUser when the request supplies none
+	RevocationStatements []string `mapstructure:"revocation_statements"`
+
+	// RevocationGroupStatements are run by DeleteUser on DB2 LUW for each
+	// group the user belongs to, with {{group}} set to the group, to revoke
+	// privileges REVOKE ... FROM USER leaves in place
+	RevocationGroupStatements []string `mapstructure:"revocation_group_statements"`
+
+	// RevocationGroupCheck has DeleteUser on DB2 LUW warn when the user still
+	// holds database authorities through a group after revocation
+	RevocationGroupCheck bool `mapstructure:"revocation_group_check"`
+
+	// UsernameTemplate renders usernames for NewUser
+	UsernameTemplate string `mapstructure:"username_template"`
+
+	// UsernameCollisionRetries is how many times NewUser retries with a
+	// numbered suffix on the generated username when a creation statement
+	// fails because the name already exists; zero does not retry
+	UsernameCollisionRetries int `mapstructure:"username_collision_retries"`
+
+	// RootRotationStatements are run by RotateRootCredentials when none are given
+	RootRotationStatements []string `mapstructure:"root_rotation_statements"`
+
+	// PasswordPolicy constrains the passwords generated by the plugin itself,
+	// such as the new root password; nil uses Vault's default format
+	PasswordPolicy *passwordPolicy `mapstructure:"password_policy"`
+
+	// MaxPasswordLength caps the length of new passwords, for operating
+	// systems that would otherwise truncate them; 0 leaves only DB2's limit
+	MaxPasswordLength int `mapstructure:"max_password_length"`
+
+	// MaxOpenConnections and MaxIdleConnections size the pool, which the SQL
+	// connection producer configures; they are decoded here to be checked
+	MaxOpenConnections int `mapstructure:"max_open_connections"`
+	MaxIdleConnections int `mapstructure:"max_idle_connections"`
+
+	// ValidateOnBorrow runs the ping_query on each connection a password
+	// change borrows from the pool, replacing it once if it is dead
+	ValidateOnBorrow bool `mapstructure:"validate_on_borrow"`
+
+	// WarmupConnections is how many connections Initialize opens and pings
+	// so the first rotations do not wait on new connections, up to the
+	// number the pool keeps idle; zero leaves the pool to fill lazily
+	WarmupConnections int `mapstructure:"warmup_connections"`
+
+	// StrictPoolLimits rejects a max_idle_connections above
+	// max_open_connections instead of letting the pool clamp it
+	StrictPoolLimits bool `mapstructure:"strict_pool_limits"`
+
+	// MaxConnectionLifetime bounds how long a pooled connection is reused. The
+	// SQL connection producer applies it through sql.DB.SetConnMaxLifetime so
+	// connections the DB2 server has dropped get recycled; zero disables it.
+	MaxConnectionLifetime time.Duration `mapstructure:"max_connection_lifetime"`
+
+	// ConnectTimeout bounds establishing a connection, both through the
+	// driver's ConnectTimeout keyword and when verifying the connection
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	// ExpirationFormat is the Go time layout {{expiration}} is rendered with
+	ExpirationFormat string `mapstructure:"expiration_format"`
+
+	// KeepaliveInterval is how often idle pooled connections are probed with
+	// the ping_query so the server does not drop them; zero disables it
+	KeepaliveInterval time.Duration `mapstructure:"keepalive_interval"`
+
+	// PingQuery is run to verify the connection and by Ping, and must be a
+	// read-only SELECT or VALUES statement
+	PingQuery string `mapstructure:"ping_query"`
+
+	// PingFallbackQuery is run in place of the ping_query when the admin user
+	// lacks the privilege to run it, under the same rules
+	PingFallbackQuery string `mapstructure:"ping_fallback_query"`
+
+	// StatementTimeout bounds each password change, creation and revocation
+	// statement, independently of ConnectTimeout; zero leaves only the
+	// request context's deadline in effect
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+
+	// LockTimeout sets CURRENT LOCK TIMEOUT, in whole seconds, while the
+	// password change statements run, so one blocked on a lock fails rather
+	// than waits for the server's locktimeout; zero leaves it unchanged
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+
+	// TransactionIsolation is the DB2 isolation level password change
+	// transactions run at: UR, CS, RS or RR; empty leaves the server default
+	TransactionIsolation string `mapstructure:"transaction_isolation"`
+
+	// RotationMaxRetries is how many times a password change batch is retried
+	// after failing with one of RotationRetryableErrors (SQLSTATEs or
+	// SQLCODEs), waiting RotationRetryBackoff before the first retry and
+	// doubling it for each one after
+	RotationMaxRetries      int           `mapstructure:"rotation_max_retries"`
+	RotationRetryBackoff    time.Duration `mapstructure:"rotation_retry_backoff"`
+	RotationRetryableErrors []string      `mapstructure:"rotation_retryable_errors"`
+
+	// InitMaxRetries is how many times Initialize retries a failed connection
+	// verification, e.g. while DB2 is still starting, waiting InitRetryBackoff
+	// before the first retry and doubling it for each one after. Each attempt
+	// is bounded by ConnectTimeout.
+	InitMaxRetries   int           `mapstructure:"init_max_retries"`
+	InitRetryBackoff time.Duration `mapstructure:"init_retry_backoff"`
+
+	// MaxConcurrentRotations bounds how many UpdateUser password changes run
+	// at once, independently of the connection pool size; zero is unbounded
+	MaxConcurrentRotations int `mapstructure:"max_concurrent_rotations"`
+
+	// Databases, when set, are each connected to in turn by UpdateUser so the
+	// password change is applied to every database in the list
+	Databases []string `mapstructure:"databases"`
+
+	// SelfManaged has UpdateUser connect as the user being rotated, using the
+	// current password from the request, instead of as the admin user
+	SelfManaged bool `mapstructure:"self_managed"`
+
+	// TrustedContext names the DB2 trusted context the admin connection is
+	// established through. When set, UpdateUser runs the password change
+	// statements as the user being rotated, switching to it with SET SESSION
+	// AUTHORIZATION and back to the admin afterward.
+	TrustedContext string `mapstructure:"trusted_context"`
+
+	// RotationPostStatements run after the password change statements of a
+	// static role rotation, on the same connection and in the same
+	// transaction, e.g. to re-assert the user's group memberships
+	RotationPostStatements []string `mapstructure:"rotation_post_statements"`
+
+	// VerifyAfterRotation connects as the user with the new password after
+	// each static role rotation and runs the ping_query, failing the
+	// rotation if the password does not authenticate
+	VerifyAfterRotation bool `mapstructure:"verify_after_rotation"`
+
+	// RotationNonTransactional runs password change statements outside a
+	// transaction, for admin commands DB2 does not allow inside one
+	RotationNonTransactional bool `mapstructure:"rotation_non_transactional"`
+
+	// UseBindParams passes the values of placeholders in password change
+	// statements as bound parameters, replacing each with a ? marker,
+	// instead of substituting them into the SQL text
+	UseBindParams bool `mapstructure:"use_bind_params"`
+
+	// PreflightPrivilegeCheck prepares every password change statement
+	// before running any, so missing privileges are reported up front
+	// instead of after part of the batch has run
+	PreflightPrivilegeCheck bool `mapstructure:"preflight_privilege_check"`
+
+	// Cloud applies the Db2 on Cloud defaults, SSL on port 50001, to the
+	// connection_url. When unset they are applied if the HOSTNAME is in a
+	// Db2 on Cloud domain.
+	Cloud *bool `mapstructure:"cloud"`
+
+	// SSL enables encrypted connections using SSLServerCertificate, which may
+	// be a file path or an inline PEM certificate
+	SSL                  bool   `mapstructure:"ssl"`
+	SSLServerCertificate string `mapstructure:"ssl_server_certificate"`
+
+	// SSLCAFile is a path to a PEM bundle of CA certificates to trust in
+	// place of SSLServerCertificate
+	SSLCAFile string `mapstructure:"ssl_ca_file"`
+
+	// SSLKeystore is a path to a GSKit keystore (.kdb) holding the
+	// certificates to trust, and any client certificate, in place of
+	// SSLServerCertificate. It is unlocked by the stash file at SSLStash or
+	// by SSLKeystorePassword.
+	SSLKeystore         string `mapstructure:"ssl_keystore"`
+	SSLStash            string `mapstructure:"ssl_stash"`
+	SSLKeystorePassword string `mapstructure:"ssl_keystore_password"`
+
+	// Security selects the SSL/TLS level: ssl (the driver default), tlsv12 or tlsv13
+	Security string `mapstructure:"security"`
+
+	// SSLInsecureSkipVerify turns off the driver's check that the server
+	// certificate was issued for the HOSTNAME, for test servers with
+	// self-signed certificates. The certificate must still be trusted
+	// through ssl_server_certificate, ssl_ca_file or ssl_keystore.
+	SSLInsecureSkipVerify bool `mapstructure:"ssl_insecure_skip_verify"`
+
+	// DisableErrorSanitization returns errors with secrets left in, for
+	// debugging against a throwaway database. Only accepted when the plugin
+	// runs with VAULT_DB2_DEBUG set.
+	DisableErrorSanitization bool `mapstructure:"disable_error_sanitization"`
+
+	// AllowPasswordReturn enables RotatePassword, which returns the password
+	// it generates to the caller
+	AllowPasswordReturn bool `mapstructure:"allow_password_return"`
+
+	// ConnectionParams are extra CLI keywords added to the connection string,
+	// e.g. CurrentSchema or QueryTimeout
+	ConnectionParams map[string]string `mapstructure:"connection_params"`
+}
+
+// parseConfig decodes the DB2-specific keys from the raw plugin configuration
+func parseConfig(conf map[string]interface{}) (db2Config, error) {
+	var config db2Config
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		DecodeHook:       durationHook,
+		Result:           &config,
+	})
+	if err != nil {
+		return db2Config{}, err
+	}
+
+	if err := decoder.Decode(conf); err != nil {
+		return db2Config{}, err
+	}
+
+	if url, _ := conf["connection_url"].(string); url != "" && config.ConnectionURLFile != "" {
+		return db2Config{}, fmt.Errorf("connection_url and connection_url_file cannot both be set")
+	}
+
+	if config.Username, err = resolveEnvReference("username", config.Username); err != nil {
+		return db2Config{}, err
+	}
+	if config.Password, err = resolveEnvReference("password", config.Password); err != nil {
+		return db2Config{}, err
+	}
+	if config.FailoverUsername, err = resolveEnvReference("failover_username", config.FailoverUsername); err != nil {
+		return db2Config{}, err
+	}
+	if config.FailoverPassword, err = resolveEnvReference("failover_password", config.FailoverPassword); err != nil {
+		return db2Config{}, err
+	}
+
+	if config.PasswordFile != "" {
+		if config.Password != "" {
+			return db2Config{}, fmt.Errorf("password and password_file cannot both be set")
+		}
+		if config.Password, err = readPasswordFile(config.PasswordFile); err != nil {
+			return db2Config{}, err
+		}
+	}
+
+	switch {
+	case config.ReloadOnChange && config.ConnectionURLFile == "" && config.PasswordFile == "":
+		return db2Config{}, fmt.Errorf("reload_on_change requires connection_url_file or password_file")
+	case config.ReloadInterval < 0:
+		return db2Config{}, fmt.Errorf("reload_interval cannot be negative")
+	case config.ReloadInterval == 0:
+		config.ReloadInterval = defaultReloadInterval
+	}
+
+	if config.StrictPoolLimits && config.idleExceedsOpen() {
+		return db2Config{}, fmt.Errorf("max_idle_connections (%d) cannot exceed max_open_connections (%d)", config.MaxIdleConnections, config.maxOpenConnections())
+	}
+
+	if config.WarmupConnections < 0 {
+		return db2Config{}, fmt.Errorf("warmup_connections cannot be negative")
+	}
+
+	if config.MaxConnectionLifetime < 0 {
+		return db2Config{}, fmt.Errorf("max_connection_lifetime cannot be negative")
+	}
+
+	switch {
+	case config.ConnectTimeout < 0:
+		return db2Config{}, fmt.Errorf("connect_timeout cannot be negative")
+	case config.ConnectTimeout == 0:
+		config.ConnectTimeout = defaultConnectTimeout
+	}
+
+	if config.KeepaliveInterval < 0 {
+		return db2Config{}, fmt.Errorf("keepalive_interval cannot be negative")
+	}
+
+	if config.StatementTimeout < 0 {
+		return db2Config{}, fmt.Errorf("statement_timeout cannot be negative")
+	}
+
+	if config.LockTimeout < 0 || config.LockTimeout%time.Second != 0 {
+		return db2Config{}, fmt.Errorf("invalid lock_timeout %s: must be a whole number of seconds", config.LockTimeout)
+	}
+
+	config.TransactionIsolation = strings.ToUpper(config.TransactionIsolation)
+	if config.TransactionIsolation != "" {
+		if _, ok := isolationLevels[config.TransactionIsolation]; !ok {
+			return db2Config{}, fmt.Errorf("invalid transaction_isolation %q: must be UR, CS, RS or RR", config.TransactionIsolation)
+		}
+		if config.RotationNonTransactional {
+			return db2Config{}, fmt.Errorf("transaction_isolation cannot be used with rotation_non_transactional")
+		}
+	}
+
+	for i, stmt := range config.CreationGrantStatements {
+		if strings.TrimSpace(stmt) == "" {
+			return db2Config{}, fmt.Errorf("creation_grant_statements statement %d is empty", i+1)
+		}
+	}
+
+	if config.UsernameCollisionRetries < 0 {
+		return db2Config{}, fmt.Errorf("username_collision_retries cannot be negative")
+	}
+
+	if config.RotationMaxRetries < 0 {
+		return db2Config{}, fmt.Errorf("rotation_max_retries cannot be negative")
+	}
+
+	if config.InitMaxRetries < 0 {
+		return db2Config{}, fmt.Errorf("init_max_retries cannot be negative")
+	}
+
+	switch {
+	case config.InitRetryBackoff < 0:
+		return db2Config{}, fmt.Errorf("init_retry_backoff cannot be negative")
+	case config.InitRetryBackoff == 0:
+		config.InitRetryBackoff = defaultInitRetryBackoff
+	}
+
+	if config.MaxConcurrentRotations < 0 {
+		return db2Config{}, fmt.Errorf("max_concurrent_rotations cannot be negative")
+	}
+
+	switch {
+	case config.RotationRetryBackoff < 0:
+		return db2Config{}, fmt.Errorf("rotation_retry_backoff cannot be negative")
+	case config.RotationRetryBackoff == 0:
+		config.RotationRetryBackoff = defaultRotationRetryBackoff
+	}
+
+	if len(config.RotationRetryableErrors) == 0 {
+		config.RotationRetryableErrors = defaultRetryableErrors
+	}
+
+	config.Platform = strings.ToLower(config.Platform)
+	switch config.Platform {
+	case "":
+		config.Platform = platformLUW
+	case platformLUW, platformZOS:
+	default:
+		return db2Config{}, fmt.Errorf("invalid platform %q: must be %q or %q", config.Platform, platformLUW, platformZOS)
+	}
+
+	config.IdentifierQuoting = strings.ToLower(config.IdentifierQuoting)
+	switch config.IdentifierQuoting {
+	case "":
+		config.IdentifierQuoting = identifierQuotingDouble
+	case identifierQuotingDouble, identifierQuotingNone:
+	default:
+		return db2Config{}, fmt.Errorf("invalid identifier_quoting %q: must be %q or %q", config.IdentifierQuoting, identifierQuotingDouble, identifierQuotingNone)
+	}
+
+	config.Product = strings.ToLower(config.Product)
+	switch config.Product {
+	case "":
+		config.Product = productDB2
+	case productDB2:
+	case productWarehouse:
+		// Db2 Warehouse is built on DB2 LUW
+		if config.Platform != platformLUW {
+			return db2Config{}, fmt.Errorf("product %q requires platform %q", productWarehouse, platformLUW)
+		}
+	default:
+		return db2Config{}, fmt.Errorf("invalid product %q: must be %q or %q", config.Product, productDB2, productWarehouse)
+	}
+
+	if err := config.validatePingQuery(); err != nil {
+		return db2Config{}, err
+	}
+
+	if config.ExpirationFormat == "" {
+		config.ExpirationFormat = expirationFormat
+	}
+	// A layout without any time elements renders as itself; quotes and
+	// semicolons would break out of the statement's string literal
+	sample := time.Date(1999, 12, 31, 23, 59, 58, 0, time.UTC)
+	if sample.Format(config.ExpirationFormat) == config.ExpirationFormat || strings.ContainsAny(config.ExpirationFormat, `'";`) {
+		return db2Config{}, fmt.Errorf("invalid expiration_format %q: must be a Go time layout such as %q", config.ExpirationFormat, expirationFormat)
+	}
+
+	config.CurrentSchema = strings.ToUpper(config.CurrentSchema)
+	if config.CurrentSchema != "" && (len(config.CurrentSchema) > maxSchemaLength || !schemaRegex.MatchString(config.CurrentSchema)) {
+		return db2Config{}, fmt.Errorf("invalid current_schema %q", config.CurrentSchema)
+	}
+
+	config.TrustedContext = strings.ToUpper(config.TrustedContext)
+	if config.TrustedContext != "" {
+		if len(config.TrustedContext) > maxSchemaLength || !schemaRegex.MatchString(config.TrustedContext) {
+			return db2Config{}, fmt.Errorf("invalid trusted_context %q", config.TrustedContext)
+		}
+		// Self-managed connections are opened as the rotated user already
+		if config.SelfManaged {
+			return db2Config{}, fmt.Errorf("trusted_context cannot be used with self_managed")
+		}
+	}
+
+	config.ChangePasswordProcedure = strings.ToUpper(config.ChangePasswordProcedure)
+	if config.ChangePasswordProcedure != "" && !validProcedureName(config.ChangePasswordProcedure) {
+		return db2Config{}, fmt.Errorf("invalid change_password_procedure %q: must be a procedure name, optionally qualified by its schema", config.ChangePasswordProcedure)
+	}
+	if err := validateInitSQL(config.InitSQL); err != nil {
+		return db2Config{}, err
+	}
+
+	if config.ChangePasswordProcedure != "" && len(config.ChangePasswordStatements) > 0 {
+		return db2Config{}, fmt.Errorf("change_password_procedure and change_password_statements cannot both be set")
+	}
+	if len(config.ChangePasswordProcedureArgs) > 0 {
+		if config.ChangePasswordProcedure == "" {
+			return db2Config{}, fmt.Errorf("change_password_procedure_args requires change_password_procedure")
+		}
+		if len(config.ChangePasswordProcedureArgs) > maxProcedureArgs {
+			return db2Config{}, fmt.Errorf("change_password_procedure_args can have at most %d values", maxProcedureArgs)
+		}
+	}
+
+	if config.MaxPasswordLength != 0 && (config.MaxPasswordLength < minPasswordLength || config.MaxPasswordLength > maxPasswordLength) {
+		return db2Config{}, fmt.Errorf("max_password_length must be between %d and %d", minPasswordLength, maxPasswordLength)
+	}
+
+	if config.PasswordPolicy != nil {
+		if err := config.PasswordPolicy.validate(); err != nil {
+			return db2Config{}, err
+		}
+		if config.MaxPasswordLength != 0 && config.PasswordPolicy.Length > config.MaxPasswordLength {
+			return db2Config{}, fmt.Errorf("password_policy length %d exceeds max_password_length %d", config.PasswordPolicy.Length, config.MaxPasswordLength)
+		}
+	}
+
+	if config.Location != "" && config.Platform != platformZOS {
+		return db2Config{}, fmt.Errorf("location requires platform %q", platformZOS)
+	}
+
+	if (len(config.RevocationGroupStatements) > 0 || config.RevocationGroupCheck) && config.Platform != platformLUW {
+		return db2Config{}, fmt.Errorf("revocation_group_statements and revocation_group_check require platform %q", platformLUW)
+	}
+
+	if len(config.AlternateHosts) > 0 {
+		switch {
+		case config.Platform != platformLUW:
+			return db2Config{}, fmt.Errorf("alternate_hosts requires platform %q", platformLUW)
+		case config.DSNAlias != "":
+			return db2Config{}, fmt.Errorf("dsn_alias and alternate_hosts cannot both be set; catalog the alternate server with the alias")
+		}
+		for _, entry := range config.AlternateHosts {
+			if _, _, err := parseAlternateHost(entry); err != nil {
+				return db2Config{}, err
+			}
+		}
+	}
+
+	if config.DSNAlias != "" {
+		switch {
+		case !dsnAliasRegex.MatchString(config.DSNAlias):
+			return db2Config{}, fmt.Errorf("invalid dsn_alias %q: must be a database alias of at most 8 characters", config.DSNAlias)
+		case config.Location != "":
+			return db2Config{}, fmt.Errorf("dsn_alias and location cannot both be set; the catalog entry names the location")
+		case config.Cloud != nil && *config.Cloud:
+			return db2Config{}, fmt.Errorf("dsn_alias cannot be combined with cloud; the catalog entry supplies the port and security")
+		}
+	}
+
+	if member := config.TargetMember; member != nil {
+		if config.Platform != platformLUW {
+			return db2Config{}, fmt.Errorf("target_member requires platform %q", platformLUW)
+		}
+		if *member < 0 || *member > maxTargetMember {
+			return db2Config{}, fmt.Errorf("target_member must be between 0 and %d", maxTargetMember)
+		}
+	}
+
+	if config.CodePage != 0 && !knownCodePages[config.CodePage] {
+		return db2Config{}, fmt.Errorf("unknown code_page %d: must be a DB2 code page number such as 1208 (UTF-8)", config.CodePage)
+	}
+
+	if err := config.validateApplicationName(); err != nil {
+		return db2Config{}, err
+	}
+
+	if err := config.validateAuth(); err != nil {
+		return db2Config{}, err
+	}
+
+	if err := config.validateFailover(); err != nil {
+		return db2Config{}, err
+	}
+
+	if err := config.validateSSL(); err != nil {
+		return db2Config{}, err
+	}
+
+	if err := config.validateConnectionParams(); err != nil {
+		return db2Config{}, err
+	}
+
+	for _, database := range config.Databases {
+		if database == "" || strings.ContainsAny(database, ";={} ") {
+			return db2Config{}, fmt.Errorf("invalid database name %q in databases", database)
+		}
+	}
+
+	return config, nil
+}
+
+// maxOpenConnections returns the effective max_open_connections, where zero
+// means the producer's default and a negative value means unlimited
+func (c db2Config) maxOpenConnections() int {
+	if c.MaxOpenConnections == 0 {
+		return defaultMaxOpenConnections
+	}
+	return c.MaxOpenConnections
+}
+
+// maxIdleConnections returns how many connections the pool keeps idle, as
+// the SQL connection producer configures it
+func (c db2Config) maxIdleConnections() int {
+	open := c.maxOpenConnections()
+	if c.MaxIdleConnections == 0 || c.MaxIdleConnections > open {
+		return open
+	}
+	return c.MaxIdleConnections
+}
+
+// idleExceedsOpen reports whether max_idle_connections is above a limited
+// max_open_connections, in which case the pool clamps it
+func (c db2Config) idleExceedsOpen() bool {
+	open := c.maxOpenConnections()
+	return open > 0 && c.MaxIdleConnections > open
+}
+
+// validateAuth checks the authentication settings for the selected auth_type
+func (c *db2Config) validateAuth() error {
+	c.AuthType = strings.ToLower(c.AuthType)
+	if c.AuthType == "" {
+		c.AuthType = authTypePassword
+	}
+
+	if c.ServicePrincipal != "" && c.AuthType != authTypeKerberos {
+		return fmt.Errorf("service_principal requires auth_type %q", authTypeKerberos)
+	}
+	if c.AuthType != authTypeLDAP && (c.LDAPBaseDN != "" || c.LDAPUserAttribute != "" || c.LDAPAuthentication != "") {
+		return fmt.Errorf("ldap_base_dn, ldap_user_attribute and ldap_authentication require auth_type %q", authTypeLDAP)
+	}
+
+	c.Authentication = strings.ToUpper(c.Authentication)
+	if c.Authentication != "" {
+		if c.AuthType != authTypePassword {
+			return fmt.Errorf("authentication requires auth_type %q; use ldap_authentication in ldap mode", authTypePassword)
+		}
+		if _, ok := authentications[c.Authentication]; !ok {
+			return fmt.Errorf("invalid authentication %q: must be one of SERVER, SERVER_ENCRYPT, SERVER_ENCRYPT_AES, DATA_ENCRYPT, GSSPLUGIN", c.Authentication)
+		}
+	}
+
+	switch c.AuthType {
+	case authTypePassword:
+	case authTypeLDAP:
+		return c.validateLDAP()
+	case authTypeKerberos:
+		if c.SelfManaged {
+			return fmt.Errorf("self_managed cannot be used when auth_type is %q", authTypeKerberos)
+		}
+		if c.ServicePrincipal == "" {
+			return fmt.Errorf("service_principal is required when auth_type is %q", authTypeKerberos)
+		}
+		if c.Password != "" {
+			return fmt.Errorf("password cannot be used when auth_type is %q", authTypeKerberos)
+		}
+		// Users are verified by password, which Kerberos connections do not use
+		if c.VerifyAfterRotation {
+			return fmt.Errorf("verify_after_rotation cannot be used when auth_type is %q", authTypeKerberos)
+		}
+	default:
+		return fmt.Errorf("invalid auth_type %q: must be %q, %q or %q", c.AuthType, authTypePassword, authTypeKerberos, authTypeLDAP)
+	}
+
+	return nil
+}
+
+// validateFailover checks that the failover credentials are complete and
+// usable with the auth_type
+func (c *db2Config) validateFailover() error {
+	if c.FailoverUsername == "" && c.FailoverPassword == "" {
+		return nil
+	}
+
+	switch {
+	case c.FailoverUsername == "" || c.FailoverPassword == "":
+		return fmt.Errorf("failover_username and failover_password must be set together")
+	case c.AuthType == authTypeKerberos:
+		return fmt.Errorf("failover_username cannot be used when auth_type is %q", authTypeKerberos)
+	case c.SelfManaged:
+		return fmt.Errorf("failover_username cannot be used with self_managed")
+	case strings.EqualFold(c.FailoverUsername, c.Username):
+		return fmt.Errorf("failover_username must differ from username")
+	}
+
+	if err := validateIdentifier(c.FailoverUsername); err != nil {
+		return fmt.Errorf("invalid failover_username: %w", err)
+	}
+	return nil
+}
+
+// validateLDAP checks the LDAP settings and fills in their defaults
+func (c *db2Config) validateLDAP() error {
+	c.LDAPBaseDN = strings.TrimSpace(c.LDAPBaseDN)
+	if c.LDAPBaseDN == "" {
+		return fmt.Errorf("ldap_base_dn is required when auth_type is %q", authTypeLDAP)
+	}
+	// The DN is substituted into the quoted literals of password statements
+	if !strings.Contains(c.LDAPBaseDN, "=") || strings.ContainsAny(c.LDAPBaseDN, "'\";{}") {
+		return fmt.Errorf("invalid ldap_base_dn %q", c.LDAPBaseDN)
+	}
+
+	if c.LDAPUserAttribute == "" {
+		c.LDAPUserAttribute = defaultLDAPUserAttribute
+	}
+	if !ldapAttributeRegex.MatchString(c.LDAPUserAttribute) {
+		return fmt.Errorf("invalid ldap_user_attribute %q", c.LDAPUserAttribute)
+	}
+
+	c.LDAPAuthentication = strings.ToUpper(c.LDAPAuthentication)
+	if c.LDAPAuthentication == "" {
+		c.LDAPAuthentication = defaultLDAPAuthentication
+	}
+	if _, ok := ldapAuthentications[c.LDAPAuthentication]; !ok {
+		return fmt.Errorf("invalid ldap_authentication %q: must be one of SERVER, SERVER_ENCRYPT, SERVER_ENCRYPT_AES, DATA_ENCRYPT", c.LDAPAuthentication)
+	}
+
+	// DB2 ships no procedure that changes a directory password, so there is
+	// no default password change statement in ldap mode
+	if len(c.ChangePasswordStatements) == 0 && c.ChangePasswordProcedure == "" {
+		return fmt.Errorf("change_password_statements or change_password_procedure is required when auth_type is %q", authTypeLDAP)
+	}
+
+	return nil
+}
+
+// validateSSL checks that the SSL settings are complete and consistent
+func (c *db2Config) validateSSL() error {
+	c.Security = strings.ToLower(c.Security)
+
+	keystore := c.SSLKeystore != "" || c.SSLStash != "" || c.SSLKeystorePassword != ""
+	if !c.SSL {
+		if c.Security != "" || c.SSLServerCertificate != "" || c.SSLCAFile != "" || c.SSLInsecureSkipVerify || keystore {
+			return fmt.Errorf("security, ssl_server_certificate, ssl_ca_file, ssl_keystore and ssl_insecure_skip_verify require ssl to be enabled")
+		}
+		return nil
+	}
+
+	if keystore {
+		if c.SSLKeystore == "" {
+			return fmt.Errorf("ssl_stash and ssl_keystore_password require ssl_keystore")
+		}
+		if (c.SSLStash == "") == (c.SSLKeystorePassword == "") {
+			return fmt.Errorf("ssl_keystore requires exactly one of ssl_stash or ssl_keystore_password")
+		}
+	}
+
+	if c.SSLServerCertificate != "" && c.SSLCAFile != "" {
+		return fmt.Errorf("ssl_server_certificate and ssl_ca_file cannot both be set")
+	}
+	if c.SSLServerCertificate == "" && c.SSLCAFile == "" && c.SSLKeystore == "" {
+		return fmt.Errorf("ssl_server_certificate, ssl_ca_file or ssl_keystore is required when ssl is enabled")
+	}
+
+	if _, ok := tlsVersions[c.Security]; !ok {
+		return fmt.Errorf("invalid security %q: must be one of ssl, tlsv12, tlsv13", c.Security)
+	}
+
+	return nil
+}
+
+// validatePingQuery defaults ping_query and ping_fallback_query and checks
+// that neither can write
+func (c *db2Config) validatePingQuery() error {
+	if strings.TrimSpace(c.PingQuery) == "" {
+		c.PingQuery = pingQuery
+	} else if err := validateReadOnlyQuery("ping_query", c.PingQuery); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(c.PingFallbackQuery) == "" {
+		c.PingFallbackQuery = pingFallbackQuery
+	} else if err := validateReadOnlyQuery("ping_fallback_query", c.PingFallbackQuery); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateApplicationName defaults application_name and checks that DB2 can
+// report it in full
+func (c *db2Config) validateApplicationName() error {
+	if c.ApplicationName == "" {
+		c.ApplicationName = defaultApplicationName
+		return nil
+	}
+
+	if len(c.ApplicationName) > maxApplicationNameLength {
+		return fmt.Errorf("application_name %q is %d bytes, exceeding the %d DB2 allows", c.ApplicationName, len(c.ApplicationName), maxApplicationNameLength)
+	}
+	for _, r := range c.ApplicationName {
+		if r < ' ' || r > '~' || strings.ContainsRune(";={}", r) {
+			return fmt.Errorf("application_name %q must be printable ASCII without ;, =, { or }", c.ApplicationName)
+		}
+	}
+
+	return nil
+}
+
+// validateReadOnlyQuery checks that the query set as key is a single SELECT
+// or VALUES statement that cannot write
+func validateReadOnlyQuery(key, query string) error {
+	if !pingQueryRegex.MatchString(query) || strings.Contains(query, ";") {
+		return fmt.Errorf("%s must be a single SELECT or VALUES statement", key)
+	}
+	if keyword := writeKeywordRegex.FindString(query); keyword != "" {
+		return fmt.Errorf("%s must be read-only, found %s", key, strings.ToUpper(keyword))
+	}
+
+	return nil
+}
+
+// validateInitSQL checks that each init_sql statement is a single SET
+// statement that changes no objects or privileges
+func validateInitSQL(statements []string) error {
+	for i, stmt := range statements {
+		switch {
+		case !initSQLRegex.MatchString(stmt) || strings.Contains(stmt, ";"):
+			return fmt.Errorf("init_sql statement %d must be a single SET statement", i+1)
+		case sessionUserRegex.MatchString(stmt):
+			return fmt.Errorf("init_sql statement %d cannot switch the session user", i+1)
+		}
+		if keyword := ddlKeywordRegex.FindString(stmt); keyword != "" {
+			return fmt.Errorf("init_sql statement %d cannot contain %s", i+1, strings.ToUpper(keyword))
+		}
+	}
+	return nil
+}
+
+// validateConnectionParams checks that connection_params can be written to
+// the connection string and do not set the credentials
+func (c *db2Config) validateConnectionParams() error {
+	for key, value := range c.ConnectionParams {
+		if key == "" || strings.ContainsAny(key, ";={} ") {
+			return fmt.Errorf("invalid connection_params key %q", key)
+		}
+		if _, ok := reservedConnectionParams[strings.ToUpper(key)]; ok {
+			return fmt.Errorf("connection_params cannot set %s, use the username and password fields", key)
+		}
+		if strings.ContainsAny(value, "{}") {
+			return fmt.Errorf("connection_params value for %s cannot contain braces", key)
+		}
+	}
+
+	return nil
+}
+
+// withDefaults returns a copy of conf with the effective value of each
+// defaulted setting filled in where conf leaves it unset, so it is visible
+// in the config Vault persists. Only non-secret settings are added.
+func (c db2Config) withDefaults(conf map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(conf))
+	for k, v := range conf {
+		result[k] = v
+	}
+
+	defaults := map[string]interface{}{
+		"platform":                  c.Platform,
+		"auth_type":                 c.AuthType,
+		"connect_timeout":           c.ConnectTimeout.String(),
+		"ping_query":                c.PingQuery,
+		"ping_fallback_query":       c.PingFallbackQuery,
+		"application_name":          c.ApplicationName,
+		"expiration_format":         c.ExpirationFormat,
+		"statement_timeout":         c.StatementTimeout.String(),
+		"max_connection_lifetime":   c.MaxConnectionLifetime.String(),
+		"rotation_max_retries":      c.RotationMaxRetries,
+		"rotation_retry_backoff":    c.RotationRetryBackoff.String(),
+		"rotation_retryable_errors": c.RotationRetryableErrors,
+	}
+	for k, v := range defaults {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+
+	return result
+}
+
+// validProcedureName reports whether name is an ordinary procedure name,
+// optionally qualified by its schema, once uppercased
+func validProcedureName(name string) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return false
+	}
+	for _, part := range parts {
+		if len(part) > maxSchemaLength || !schemaRegex.MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// producerConfig returns a copy of conf for the SQL connection producer with
+// the keys it would interpret differently removed, and the credentials
+// resolved as in config
+func producerConfig(conf map[string]interface{}, config db2Config) map[string]interface{} {
+	result := make(map[string]interface{}, len(conf))
+	for k, v := range conf {
+		result[k] = v
+	}
+	if _, ok := result["username"]; ok {
+		result["username"] = config.Username
+	}
+	if _, ok := result["password"]; ok || config.PasswordFile != "" {
+		result["password"] = config.Password
+	}
+
+	// The producer only accepts its own auth types, and its self-managed
+	// mode requires a templated connection_url this plugin does not use
+	delete(result, "auth_type")
+	delete(result, "self_managed")
+
+	return result
+}
+
+// resolveEnvReference returns the value of the environment variable an
+// env:NAME value for key refers to, or value unchanged if it is not a
+// reference. Only the resolved value is kept, so the secret itself need not
+// be stored in the config.
+func resolveEnvReference(key, value string) (string, error) {
+	name, ok := strings.CutPrefix(value, envReferencePrefix)
+	if !ok {
+		return value, nil
+	}
+	if name == "" {
+		return "", fmt.Errorf("%s references an environment variable without a name", key)
+	}
+
+	resolved, ok := os.LookupEnv(name)
+	if !ok || resolved == "" {
+		return "", fmt.Errorf("%s references environment variable %s, which is not set", key, name)
+	}
+	return resolved, nil
+}
+
+// durationHook decodes durations given either as Go duration strings or as a
+// number of seconds, matching how the SQL connection producer parses them
+func durationHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+
+	return parseutil.ParseDurationSecond(data)
+}
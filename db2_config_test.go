@@ -0,0 +1,638 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig_MaxConnectionLifetime(t *testing.T) {
+	tests := map[string]struct {
+		value    interface{}
+		expected time.Duration
+	}{
+		"unset":           {value: nil, expected: 0},
+		"duration string": {value: "5m", expected: 5 * time.Minute},
+		"seconds string":  {value: "30", expected: 30 * time.Second},
+		"seconds number":  {value: 45, expected: 45 * time.Second},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf := map[string]interface{}{}
+			if tc.value != nil {
+				conf["max_connection_lifetime"] = tc.value
+			}
+
+			config, err := parseConfig(conf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if config.MaxConnectionLifetime != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, config.MaxConnectionLifetime)
+			}
+		})
+	}
+}
+
+func TestParseConfig_InvalidMaxConnectionLifetime(t *testing.T) {
+	for _, value := range []interface{}{"not-a-duration", "-5s"} {
+		if _, err := parseConfig(map[string]interface{}{"max_connection_lifetime": value}); err == nil {
+			t.Errorf("expected error for max_connection_lifetime %v", value)
+		}
+	}
+}
+
+func TestParseConfig_AuthType(t *testing.T) {
+	tests := map[string]struct {
+		conf      map[string]interface{}
+		expectErr bool
+		expected  string
+	}{
+		"default password": {
+			conf:     map[string]interface{}{"password": "secret"},
+			expected: authTypePassword,
+		},
+		"password without password field": {
+			conf:     map[string]interface{}{"auth_type": "password"},
+			expected: authTypePassword,
+		},
+		"kerberos": {
+			conf: map[string]interface{}{
+				"auth_type":         "KERBEROS",
+				"service_principal": "db2/db2.example.com@EXAMPLE.COM",
+			},
+			expected: authTypeKerberos,
+		},
+		"kerberos without principal": {
+			conf:      map[string]interface{}{"auth_type": "kerberos"},
+			expectErr: true,
+		},
+		"kerberos with password": {
+			conf: map[string]interface{}{
+				"auth_type":         "kerberos",
+				"service_principal": "db2/db2.example.com@EXAMPLE.COM",
+				"password":          "secret",
+			},
+			expectErr: true,
+		},
+		"principal without kerberos": {
+			conf:      map[string]interface{}{"service_principal": "db2/db2.example.com@EXAMPLE.COM"},
+			expectErr: true,
+		},
+		"ldap": {
+			conf: map[string]interface{}{
+				"auth_type":                 "LDAP",
+				"ldap_base_dn":              "ou=db2users,dc=example,dc=com",
+				"change_password_procedure": "APP.SET_LDAP_PASSWORD",
+			},
+			expected: authTypeLDAP,
+		},
+		"unknown": {
+			conf:      map[string]interface{}{"auth_type": "ntlm"},
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(tc.conf)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.AuthType != tc.expected {
+				t.Errorf("expected auth_type %q, got %q", tc.expected, config.AuthType)
+			}
+		})
+	}
+}
+
+func TestParseConfig_Platform(t *testing.T) {
+	tests := map[string]struct {
+		value     string
+		expected  string
+		expectErr bool
+	}{
+		"default": {value: "", expected: platformLUW},
+		"luw":     {value: "LUW", expected: platformLUW},
+		"zos":     {value: "zos", expected: platformZOS},
+		"invalid": {value: "iseries", expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(map[string]interface{}{"platform": tc.value})
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.Platform != tc.expected {
+				t.Errorf("expected platform %q, got %q", tc.expected, config.Platform)
+			}
+		})
+	}
+}
+
+func TestParseConfig_Product(t *testing.T) {
+	tests := map[string]struct {
+		conf      map[string]interface{}
+		expected  string
+		expectErr bool
+	}{
+		"default":       {expected: productDB2},
+		"warehouse":     {conf: map[string]interface{}{"product": "Warehouse"}, expected: productWarehouse},
+		"warehouse zos": {conf: map[string]interface{}{"product": "warehouse", "platform": "zos"}, expectErr: true},
+		"invalid":       {conf: map[string]interface{}{"product": "netezza"}, expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(tc.conf)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.Product != tc.expected {
+				t.Errorf("expected product %q, got %q", tc.expected, config.Product)
+			}
+		})
+	}
+}
+
+func TestParseConfig_ChangePasswordProcedure(t *testing.T) {
+	tests := map[string]struct {
+		value     string
+		expected  string
+		expectErr bool
+	}{
+		"unset":          {},
+		"unqualified":    {value: "change_password", expected: "CHANGE_PASSWORD"},
+		"qualified":      {value: "Audit.Change_Password", expected: "AUDIT.CHANGE_PASSWORD"},
+		"too many parts": {value: "db.audit.change_password", expectErr: true},
+		"injection":      {value: "P(?, ?, ?); DROP TABLE T; CALL P", expectErr: true},
+		"empty part":     {value: "audit.", expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(map[string]interface{}{"change_password_procedure": tc.value})
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.ChangePasswordProcedure != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, config.ChangePasswordProcedure)
+			}
+		})
+	}
+}
+
+func TestParseConfig_CodePage(t *testing.T) {
+	tests := map[string]struct {
+		value     interface{}
+		expectErr bool
+	}{
+		"unset":    {value: 0},
+		"utf-8":    {value: 1208},
+		"ebcdic":   {value: "500"},
+		"unknown":  {value: 1234, expectErr: true},
+		"negative": {value: -1, expectErr: true},
+		"name":     {value: "utf-8", expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig(map[string]interface{}{"code_page": tc.value})
+			if tc.expectErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_ApplicationName(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ApplicationName != "vault-db2-plugin" {
+		t.Errorf("expected vault-db2-plugin by default, got %q", config.ApplicationName)
+	}
+
+	tests := map[string]struct {
+		value     string
+		expectErr bool
+	}{
+		"custom":     {value: "vault-prod"},
+		"max length": {value: strings.Repeat("v", 20)},
+		"too long":   {value: strings.Repeat("v", 21), expectErr: true},
+		"non-ascii":  {value: "vault-prüfung", expectErr: true},
+		"separator":  {value: "vault;UID=x", expectErr: true},
+		"control":    {value: "vault\n", expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(map[string]interface{}{"application_name": tc.value})
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.ApplicationName != tc.value {
+				t.Errorf("expected %q, got %q", tc.value, config.ApplicationName)
+			}
+		})
+	}
+}
+
+func TestParseConfig_Authentication(t *testing.T) {
+	tests := map[string]struct {
+		conf    map[string]interface{}
+		wantErr string
+	}{
+		"unset":          {},
+		"server_encrypt": {conf: map[string]interface{}{"authentication": "server_encrypt"}},
+		"data_encrypt":   {conf: map[string]interface{}{"authentication": "DATA_ENCRYPT"}},
+		"gssplugin":      {conf: map[string]interface{}{"authentication": "GSSPLUGIN"}},
+		"unknown":        {conf: map[string]interface{}{"authentication": "CLIENT"}, wantErr: `invalid authentication "CLIENT": must be one of`},
+		"with ldap":      {conf: map[string]interface{}{"authentication": "SERVER", "auth_type": "ldap", "ldap_base_dn": "ou=db2users,dc=example,dc=com"}, wantErr: "use ldap_authentication"},
+		"with kerberos":  {conf: map[string]interface{}{"authentication": "SERVER", "auth_type": "kerberos", "service_principal": "db2/host@EXAMPLE.COM"}, wantErr: "requires auth_type"},
+		"space":          {conf: map[string]interface{}{"authentication": "SERVER ENCRYPT"}, wantErr: "invalid authentication"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig(tc.conf)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_CurrentSchema(t *testing.T) {
+	for _, schema := range []string{"APP;DROP TABLE X", `"APP"`, "1APP", strings.Repeat("A", 129)} {
+		if _, err := parseConfig(map[string]interface{}{"current_schema": schema}); err == nil {
+			t.Errorf("expected error for current_schema %q", schema)
+		}
+	}
+}
+
+func TestParseConfig_SelfManagedKerberos(t *testing.T) {
+	_, err := parseConfig(map[string]interface{}{
+		"auth_type":         "kerberos",
+		"service_principal": "db2/host@EXAMPLE.COM",
+		"self_managed":      true,
+	})
+	if err == nil {
+		t.Fatal("expected error for self_managed with kerberos")
+	}
+}
+
+func TestParseConfig_Databases(t *testing.T) {
+	for _, database := range []string{"", "SALES;PWD=x", "{SALES}"} {
+		if _, err := parseConfig(map[string]interface{}{"databases": []interface{}{database}}); err == nil {
+			t.Errorf("expected error for database %q", database)
+		}
+	}
+}
+
+func TestParseConfig_PingQuery(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.PingQuery != "SELECT 1 FROM SYSIBM.SYSDUMMY1" {
+		t.Errorf("expected the SYSDUMMY1 query by default, got %q", config.PingQuery)
+	}
+	if config.PingFallbackQuery != "VALUES 1" {
+		t.Errorf("expected VALUES 1 as the fallback by default, got %q", config.PingFallbackQuery)
+	}
+
+	valid := []string{"select 1 from sysibm.sysdummy1", "VALUES 1", "SELECT CURRENT SERVER FROM SYSIBM.SYSDUMMY1"}
+	for _, query := range valid {
+		if _, err := parseConfig(map[string]interface{}{"ping_query": query}); err != nil {
+			t.Errorf("expected %q to be accepted, got: %v", query, err)
+		}
+	}
+
+	invalid := []string{
+		"DELETE FROM APP.ORDERS",
+		"UPDATE APP.ORDERS SET STATUS = 'X'",
+		"DROP TABLE APP.ORDERS",
+		"CALL SYSPROC.ADMIN_CMD('QUIESCE DATABASE')",
+		"SELECT 1 FROM SYSIBM.SYSDUMMY1; DROP TABLE APP.ORDERS",
+		"SELECT * FROM FINAL TABLE (INSERT INTO APP.LOG VALUES (1))",
+	}
+	for _, query := range invalid {
+		if _, err := parseConfig(map[string]interface{}{"ping_query": query}); err == nil {
+			t.Errorf("expected %q to be rejected", query)
+		}
+		if _, err := parseConfig(map[string]interface{}{"ping_fallback_query": query}); err == nil || !strings.Contains(err.Error(), "ping_fallback_query") {
+			t.Errorf("expected %q to be rejected as ping_fallback_query, got: %v", query, err)
+		}
+	}
+}
+
+func TestParseConfig_LDAP(t *testing.T) {
+	baseDN := "ou=db2users,dc=example,dc=com"
+	statements := []interface{}{`CALL APP.SET_LDAP_PASSWORD('{{user_dn}}', '{{password_escaped}}')`}
+
+	config, err := parseConfig(map[string]interface{}{"auth_type": "ldap", "ldap_base_dn": baseDN, "change_password_statements": statements})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.LDAPAuthentication != "SERVER_ENCRYPT" {
+		t.Errorf("expected SERVER_ENCRYPT by default, got %q", config.LDAPAuthentication)
+	}
+	if config.LDAPUserAttribute != "uid" {
+		t.Errorf("expected uid by default, got %q", config.LDAPUserAttribute)
+	}
+
+	config, err = parseConfig(map[string]interface{}{
+		"auth_type":                  "ldap",
+		"ldap_base_dn":               baseDN,
+		"ldap_user_attribute":        "cn",
+		"ldap_authentication":        "server_encrypt_aes",
+		"change_password_statements": statements,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.LDAPAuthentication != "SERVER_ENCRYPT_AES" || config.LDAPUserAttribute != "cn" {
+		t.Errorf("expected configured LDAP settings, got %q and %q", config.LDAPAuthentication, config.LDAPUserAttribute)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing base dn":        {"auth_type": "ldap"},
+		"blank base dn":          {"auth_type": "ldap", "ldap_base_dn": "  "},
+		"base dn not a dn":       {"auth_type": "ldap", "ldap_base_dn": "db2users"},
+		"base dn with quote":     {"auth_type": "ldap", "ldap_base_dn": "ou=o'brien,dc=example"},
+		"invalid attribute":      {"auth_type": "ldap", "ldap_base_dn": baseDN, "ldap_user_attribute": "user id"},
+		"invalid authentication": {"auth_type": "ldap", "ldap_base_dn": baseDN, "ldap_authentication": "KERBEROS"},
+		"base dn without ldap":   {"ldap_base_dn": baseDN},
+		"no statements":          {"auth_type": "ldap", "ldap_base_dn": baseDN},
+		"authentication without ldap": {
+			"ldap_authentication": "SERVER",
+		},
+		"principal with ldap": {
+			"auth_type":         "ldap",
+			"ldap_base_dn":      baseDN,
+			"service_principal": "db2/host@EXAMPLE.COM",
+		},
+	}
+	for name, conf := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(conf); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseConfig_ExpirationFormat(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ExpirationFormat != "2006-01-02-15.04.05.000000" {
+		t.Errorf("expected the DB2 timestamp format by default, got %q", config.ExpirationFormat)
+	}
+
+	for _, format := range []string{"2006-01-02", time.RFC3339, "2006-01-02-15.04.05"} {
+		if _, err := parseConfig(map[string]interface{}{"expiration_format": format}); err != nil {
+			t.Errorf("expected %q to be accepted, got: %v", format, err)
+		}
+	}
+
+	for _, format := range []string{"YYYY-MM-DD", "2006-01-02'); DROP TABLE T; --", `2006"01`} {
+		if _, err := parseConfig(map[string]interface{}{"expiration_format": format}); err == nil {
+			t.Errorf("expected %q to be rejected", format)
+		}
+	}
+}
+
+func TestParseConfig_PoolLimits(t *testing.T) {
+	tests := map[string]struct {
+		conf      map[string]interface{}
+		expectErr bool
+		exceeds   bool
+	}{
+		"idle within open": {
+			conf: map[string]interface{}{"max_open_connections": 5, "max_idle_connections": 5},
+		},
+		"idle over open": {
+			conf:    map[string]interface{}{"max_open_connections": 2, "max_idle_connections": 5},
+			exceeds: true,
+		},
+		"idle over default open": {
+			conf:    map[string]interface{}{"max_idle_connections": 5},
+			exceeds: true,
+		},
+		"unlimited open": {
+			conf: map[string]interface{}{"max_open_connections": -1, "max_idle_connections": 50},
+		},
+		"strict idle over open": {
+			conf:      map[string]interface{}{"max_open_connections": 2, "max_idle_connections": 5, "strict_pool_limits": true},
+			expectErr: true,
+		},
+		"strict idle within open": {
+			conf: map[string]interface{}{"max_open_connections": "10", "max_idle_connections": "5", "strict_pool_limits": true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config, err := parseConfig(tc.conf)
+			if tc.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "max_idle_connections (5) cannot exceed max_open_connections (2)") {
+					t.Fatalf("expected pool limits error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := config.idleExceedsOpen(); got != tc.exceeds {
+				t.Errorf("expected idleExceedsOpen %v, got %v", tc.exceeds, got)
+			}
+		})
+	}
+}
+
+func TestParseConfig_MaxPasswordLength(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"max_password_length": "14"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxPasswordLength != 14 {
+		t.Errorf("expected max_password_length 14, got %d", config.MaxPasswordLength)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"too short": {"max_password_length": 7},
+		"too long":  {"max_password_length": 101},
+		"negative":  {"max_password_length": -1},
+		"policy longer": {
+			"max_password_length": 14,
+			"password_policy":     map[string]interface{}{"length": 16},
+		},
+	}
+	for name, conf := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(conf); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseConfig_TargetMember(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"target_member": "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.TargetMember == nil || *config.TargetMember != 2 {
+		t.Errorf("expected target_member 2, got %v", config.TargetMember)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"negative": {"target_member": -1},
+		"too high": {"target_member": 1000},
+		"zos":      {"platform": "zos", "location": "DB2LOC1", "target_member": 1},
+	}
+	for name, conf := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(conf); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseConfig_ChangePasswordStatements(t *testing.T) {
+	_, err := parseConfig(map[string]interface{}{
+		"change_password_procedure":  "vault.change_password",
+		"change_password_statements": []interface{}{`ALTER USER "{{username}}" PASSWORD '{{password}}'`},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Errorf("expected the procedure and statements together to be rejected, got: %v", err)
+	}
+}
+
+func TestParseConfig_ChangePasswordProcedureArgs(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{
+		"change_password_procedure":      "vault.change_password",
+		"change_password_procedure_args": []interface{}{"STRICT", 90},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(config.ChangePasswordProcedureArgs, []string{"STRICT", "90"}) {
+		t.Errorf("expected the arguments as strings, got: %v", config.ChangePasswordProcedureArgs)
+	}
+
+	_, err = parseConfig(map[string]interface{}{"change_password_procedure_args": []interface{}{"STRICT"}})
+	if err == nil || !strings.Contains(err.Error(), "requires change_password_procedure") {
+		t.Errorf("expected arguments without a procedure to be rejected, got: %v", err)
+	}
+
+	_, err = parseConfig(map[string]interface{}{
+		"change_password_procedure":      "vault.change_password",
+		"change_password_procedure_args": make([]interface{}, maxProcedureArgs+1),
+	})
+	if err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("expected too many arguments to be rejected, got: %v", err)
+	}
+}
+
+func TestParseConfig_EnvReferences(t *testing.T) {
+	t.Setenv("DB2_TEST_USERNAME", "envadmin")
+	t.Setenv("DB2_TEST_PASSWORD", "envpass")
+
+	config, err := parseConfig(map[string]interface{}{
+		"username": "env:DB2_TEST_USERNAME",
+		"password": "env:DB2_TEST_PASSWORD",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Username != "envadmin" || config.Password != "envpass" {
+		t.Errorf("expected the credentials to be resolved, got %q and %q", config.Username, config.Password)
+	}
+
+	tests := map[string]struct {
+		conf    map[string]interface{}
+		wantErr string
+	}{
+		"unset": {
+			conf:    map[string]interface{}{"password": "env:DB2_TEST_UNSET"},
+			wantErr: "password references environment variable DB2_TEST_UNSET, which is not set",
+		},
+		"no name": {
+			conf:    map[string]interface{}{"username": "env:"},
+			wantErr: "username references an environment variable without a name",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(tc.conf); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_UsernameCollisionRetries(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"username_collision_retries": "3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.UsernameCollisionRetries != 3 {
+		t.Errorf("expected 3, got %d", config.UsernameCollisionRetries)
+	}
+
+	if _, err := parseConfig(map[string]interface{}{"username_collision_retries": -1}); err == nil || !strings.Contains(err.Error(), "username_collision_retries cannot be negative") {
+		t.Errorf("expected a negative value to be rejected, got: %v", err)
+	}
+}
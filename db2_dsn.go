@@ -0,0 +1,817 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tlsVersions maps the security config values to the TLSVersion keyword;
+// plain ssl leaves the version to the driver
+var tlsVersions = map[string]string{
+	"":       "",
+	"ssl":    "",
+	"tlsv12": "TLSV12",
+	"tlsv13": "TLSV13",
+}
+
+// reservedConnectionParams are the keywords connection_params cannot set
+var reservedConnectionParams = map[string]struct{}{
+	"UID": {},
+	"PWD": {},
+}
+
+// hostnameRegex matches DNS hostnames: dot-separated labels of letters,
+// digits, hyphens and underscores, not starting or ending with a hyphen
+var hostnameRegex = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?(\.[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?)*\.?$`)
+
+// ipv4Regex matches HOSTNAME values meant as an IPv4 address, which must
+// then parse as one
+var ipv4Regex = regexp.MustCompile(`^[0-9.]+$`)
+
+// maxHostnameLength is the longest DNS name
+const maxHostnameLength = 253
+
+// cloudPort is the SSL port Db2 on Cloud and Db2 Warehouse listen on
+const cloudPort = "50001"
+
+// cloudDomains are the hostname suffixes of Db2 on Cloud instances, current
+// and from its dashDB days
+var cloudDomains = []string{
+	".databases.appdomain.cloud",
+	".db2.cloud.ibm.com",
+	".services.dal.bluemix.net",
+}
+
+// redactedKeywords hold credentials or point at certificate material, and
+// are masked by RedactedDSN along with any keyword naming a password
+var redactedKeywords = map[string]struct{}{
+	"UID":                  {},
+	"PWD":                  {},
+	"SSLSERVERCERTIFICATE": {},
+	"SSLCLIENTKEYSTOREDB":  {},
+	"SSLCLIENTKEYSTASH":    {},
+}
+
+// RedactedDSN returns the connection string built by Initialize with the
+// credentials and certificate settings replaced by ***, for debugging
+func (c *db2ConnectionProducer) RedactedDSN() string {
+	c.Lock()
+	cs := parseConnectionString(c.ConnectionURL)
+	c.Unlock()
+
+	for _, key := range cs.keys {
+		if isRedactedKeyword(key) {
+			cs.set(key, "***")
+		}
+	}
+
+	return cs.String()
+}
+
+// isRedactedKeyword reports whether the connection string keyword key holds
+// a credential or certificate setting
+func isRedactedKeyword(key string) bool {
+	upper := strings.ToUpper(key)
+	_, ok := redactedKeywords[upper]
+	return ok || strings.Contains(upper, "PASSWORD") || strings.Contains(upper, "PWD")
+}
+
+// buildConnectionString adds the DB2-specific keywords derived from config to
+// the connection_url
+func (d *db2DB) buildConnectionString(base string, config db2Config) (string, error) {
+	if err := checkSyntax(base); err != nil {
+		return "", err
+	}
+	cs := parseConnectionString(base)
+	if config.URLEncoded {
+		if err := decodeValues(cs); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case config.DSNAlias != "":
+		if err := setDSNAlias(cs, config.DSNAlias); err != nil {
+			return "", err
+		}
+	case config.Platform == platformZOS:
+		if err := setLocation(cs, config.Location); err != nil {
+			return "", err
+		}
+	}
+	if config.TargetMember != nil {
+		cs.set("ConnectNode", strconv.Itoa(*config.TargetMember))
+	}
+	if config.CodePage != 0 {
+		cs.set("CODEPAGE", strconv.Itoa(config.CodePage))
+	}
+	// A catalogued alias takes its address from the catalog entry
+	if config.DSNAlias == "" {
+		if err := formatHostname(cs); err != nil {
+			return "", err
+		}
+		if isCloud(cs, config) || config.Product == productWarehouse {
+			// Db2 on Cloud and Db2 Warehouse listen for SSL connections on
+			// the same port, with certificates from a public CA on Db2 on
+			// Cloud. Settings in the connection_url take precedence.
+			if port, _ := cs.get("PORT"); port == "" {
+				cs.set("PORT", cloudPort)
+			}
+			if security, _ := cs.get("SECURITY"); security == "" {
+				cs.set("SECURITY", "SSL")
+			}
+		}
+		if err := checkAddress(cs); err != nil {
+			return "", err
+		}
+		if err := setAlternateHosts(cs, config.AlternateHosts); err != nil {
+			return "", err
+		}
+	}
+
+	if config.ApplicationName != "" {
+		cs.set("ProgramName", config.ApplicationName)
+	}
+
+	// ConnectTimeout is in whole seconds; round up so short timeouts are not
+	// disabled by a zero
+	seconds := int64((config.ConnectTimeout + time.Second - 1) / time.Second)
+	cs.set("ConnectTimeout", strconv.FormatInt(seconds, 10))
+
+	// Sorted so the connection string is stable across restarts
+	keys := make([]string, 0, len(config.ConnectionParams))
+	for key := range config.ConnectionParams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cs.set(key, config.ConnectionParams[key])
+	}
+
+	if config.AuthType == authTypeKerberos {
+		// Kerberos tickets replace any credentials in the connection_url
+		cs.delete("UID")
+		cs.delete("PWD")
+		cs.set("AUTHENTICATION", "KERBEROS")
+		cs.set("TargetPrincipal", config.ServicePrincipal)
+	} else {
+		// The username and password fields take precedence over any UID/PWD
+		// embedded in the connection_url
+		if config.Username != "" {
+			cs.set("UID", config.Username)
+		}
+		if config.Password != "" {
+			cs.set("PWD", config.Password)
+		}
+
+		switch {
+		case config.AuthType == authTypeLDAP:
+			cs.set("AUTHENTICATION", config.LDAPAuthentication)
+		case config.Authentication != "":
+			cs.set("AUTHENTICATION", config.Authentication)
+		}
+
+		// Self-managed connections authenticate with the credentials of the
+		// user being rotated, supplied with each request
+		uid, _ := cs.get("UID")
+		pwd, _ := cs.get("PWD")
+		if !config.SelfManaged && (uid == "" || pwd == "") {
+			return "", fmt.Errorf("username and password must be set, either as fields or as UID and PWD in connection_url")
+		}
+	}
+
+	if config.SSL {
+		var certPath string
+		var err error
+		switch {
+		case config.SSLCAFile != "":
+			certPath, err = d.caBundlePath(config.SSLCAFile)
+		case config.SSLServerCertificate != "":
+			certPath, err = d.certificatePath(config.SSLServerCertificate)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		cs.set("SECURITY", "SSL")
+		if certPath != "" {
+			cs.set("SSLServerCertificate", certPath)
+		}
+		if config.SSLKeystore != "" {
+			if err := setKeystore(cs, config); err != nil {
+				return "", err
+			}
+		}
+		if version := tlsVersions[config.Security]; version != "" {
+			cs.set("TLSVersion", version)
+		}
+		if config.SSLInsecureSkipVerify {
+			cs.set("SSLClientHostnameValidation", "OFF")
+		}
+	}
+
+	if len(config.InitSQL) > 0 {
+		d.Lock()
+		cs.set(sessionKeyword, d.sessionID)
+		d.Unlock()
+	}
+
+	return cs.String(), nil
+}
+
+// setKeystore points the driver at the GSKit keystore and what unlocks it,
+// after checking that the files exist
+func setKeystore(cs *connectionString, config db2Config) error {
+	if err := checkFile("ssl_keystore", config.SSLKeystore); err != nil {
+		return err
+	}
+	cs.set("SSLClientKeystoredb", config.SSLKeystore)
+
+	if config.SSLStash != "" {
+		if err := checkFile("ssl_stash", config.SSLStash); err != nil {
+			return err
+		}
+		cs.set("SSLClientKeystash", config.SSLStash)
+	} else {
+		cs.set("SSLClientKeystoreDBPassword", config.SSLKeystorePassword)
+	}
+	return nil
+}
+
+// checkFile checks that path, configured as key, is a regular file
+func checkFile(key, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("invalid %s: %s is not a regular file", key, path)
+	}
+	return nil
+}
+
+// decodeValues percent-decodes each value of cs. Values are decoded after
+// the connection string is split, so encoded semicolons, equals signs and
+// braces stay part of the value, and a plus sign is kept as is. The error
+// names the keyword but not its value, which may be a password.
+func decodeValues(cs *connectionString) error {
+	for _, key := range cs.keys {
+		value, _ := cs.get(key)
+		decoded, err := url.PathUnescape(value)
+		if err != nil {
+			return fmt.Errorf("connection_url keyword %s is not valid percent-encoding: each %% must be followed by two hexadecimal digits", key)
+		}
+		cs.set(key, decoded)
+	}
+	return nil
+}
+
+// setDSNAlias addresses the database by an alias in the DB2 client's
+// database directory, which supplies the host, port and database name, so the
+// connection string must not give them as well
+func setDSNAlias(cs *connectionString, alias string) error {
+	for _, key := range []string{"DATABASE", "HOSTNAME", "PORT"} {
+		if value, _ := cs.get(key); value != "" {
+			return fmt.Errorf("dsn_alias %q conflicts with %s=%s in connection_url; the catalog entry supplies it", alias, key, value)
+		}
+	}
+	if dsn, _ := cs.get("DSN"); dsn != "" && !strings.EqualFold(dsn, alias) {
+		return fmt.Errorf("dsn_alias %q conflicts with DSN=%s in connection_url", alias, dsn)
+	}
+
+	cs.set("DSN", alias)
+	return nil
+}
+
+// setLocation addresses a DB2 for z/OS subsystem by its location name, which
+// DRDA connections carry in the DATABASE keyword
+func setLocation(cs *connectionString, location string) error {
+	if location != "" {
+		if database, ok := cs.get("DATABASE"); ok && database != "" && !strings.EqualFold(database, location) {
+			return fmt.Errorf("location %q conflicts with DATABASE=%s in connection_url", location, database)
+		}
+		cs.set("DATABASE", location)
+	}
+
+	if database, _ := cs.get("DATABASE"); database == "" {
+		return fmt.Errorf("location is required for DB2 for z/OS unless connection_url includes DATABASE")
+	}
+
+	return nil
+}
+
+// isCloud reports whether the Db2 on Cloud defaults apply: as configured by
+// cloud, or otherwise if the HOSTNAME is in a Db2 on Cloud domain
+func isCloud(cs *connectionString, config db2Config) bool {
+	if config.Cloud != nil {
+		return *config.Cloud
+	}
+
+	host, _ := cs.get("HOSTNAME")
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range cloudDomains {
+		if strings.HasSuffix(host, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkSyntax checks that every segment of the connection string is a
+// KEY=value pair and that braces are balanced. Segments are identified by
+// position, since their content may be a fragment of a password.
+func checkSyntax(dsn string) error {
+	depth := 0
+	for _, r := range dsn {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("connection_url has an unterminated {")
+	}
+
+	for i, part := range splitConnectionString(dsn) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, _, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("connection_url segment %d is not a KEY=value pair", i+1)
+		}
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("connection_url segment %d has no key", i+1)
+		}
+	}
+
+	return nil
+}
+
+// formatHostname checks that HOSTNAME is a hostname, an IPv4 address or an
+// IPv6 address, and removes the brackets an IPv6 address is often written
+// with in URLs, since the driver expects it bare
+func formatHostname(cs *connectionString) error {
+	host, _ := cs.get("HOSTNAME")
+	if host == "" {
+		return nil
+	}
+
+	bare, bracketed := strings.CutPrefix(host, "[")
+	if bracketed {
+		var ok bool
+		if bare, ok = strings.CutSuffix(bare, "]"); !ok {
+			if strings.Contains(bare, "]:") {
+				return fmt.Errorf("connection_url HOSTNAME %q includes a port; give it separately as PORT", host)
+			}
+			return fmt.Errorf("connection_url HOSTNAME %q has an unterminated [", host)
+		}
+	}
+
+	switch {
+	case bracketed || strings.Contains(bare, ":"):
+		if addr, err := netip.ParseAddr(bare); err != nil || !addr.Is6() {
+			return fmt.Errorf("connection_url HOSTNAME %q is not a valid IPv6 address; give the port separately as PORT", host)
+		}
+		cs.set("HOSTNAME", bare)
+	case ipv4Regex.MatchString(host):
+		if _, err := netip.ParseAddr(host); err != nil {
+			return fmt.Errorf("connection_url HOSTNAME %q is not a valid IPv4 address", host)
+		}
+	case len(host) > maxHostnameLength || !hostnameRegex.MatchString(host):
+		return fmt.Errorf("connection_url HOSTNAME %q is not a valid hostname or IP address", host)
+	}
+
+	return nil
+}
+
+// validHost reports whether host is a hostname, an IPv4 address or a bare
+// IPv6 address
+func validHost(host string) bool {
+	switch {
+	case strings.Contains(host, ":"):
+		addr, err := netip.ParseAddr(host)
+		return err == nil && addr.Is6()
+	case ipv4Regex.MatchString(host):
+		_, err := netip.ParseAddr(host)
+		return err == nil
+	default:
+		return len(host) <= maxHostnameLength && hostnameRegex.MatchString(host)
+	}
+}
+
+// parseAlternateHost splits an alternate_hosts entry into its host and port,
+// e.g. db2-standby.example.com:50000 or [2001:db8::11]:50000
+func parseAlternateHost(entry string) (string, string, error) {
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid alternate_hosts entry %q: must be host:port", entry)
+	}
+	if !validHost(host) {
+		return "", "", fmt.Errorf("invalid alternate_hosts entry %q: %q is not a valid hostname or IP address", entry, host)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("invalid alternate_hosts entry %q: %q is not a valid port number", entry, port)
+	}
+	return host, port, nil
+}
+
+// setAlternateHosts lists the alternate_hosts as the servers the driver
+// reroutes connections to when the primary is unavailable, e.g. after an
+// HADR takeover
+func setAlternateHosts(cs *connectionString, entries []string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, len(entries))
+	ports := make([]string, len(entries))
+	for i, entry := range entries {
+		var err error
+		if hosts[i], ports[i], err = parseAlternateHost(entry); err != nil {
+			return err
+		}
+	}
+
+	cs.set("AlternateServerName", strings.Join(hosts, ","))
+	cs.set("AlternatePortNumber", strings.Join(ports, ","))
+	return nil
+}
+
+// checkAddress checks that the connection string names the database, host
+// and port, which the driver requires for a TCP/IP connection
+func checkAddress(cs *connectionString) error {
+	for _, key := range []string{"DATABASE", "HOSTNAME", "PORT"} {
+		if value, _ := cs.get(key); value == "" {
+			return fmt.Errorf("connection_url must include %s", key)
+		}
+	}
+
+	port, _ := cs.get("PORT")
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("connection_url PORT %q is not a valid port number", port)
+	}
+
+	return nil
+}
+
+// certificatePath returns a file path for cert, writing it to a temporary
+// file if it was given as inline PEM
+func (d *db2DB) certificatePath(cert string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(cert), "-----BEGIN") {
+		return cert, nil
+	}
+
+	path, err := d.writeTempFile([]byte(cert))
+	if err != nil {
+		return "", fmt.Errorf("failed to write ssl_server_certificate: %w", err)
+	}
+	return path, nil
+}
+
+// caBundlePath checks that the file at path is a PEM bundle of certificates
+// and rewrites it to a temporary file holding only those certificates, so
+// comments or stray text in the bundle cannot confuse the driver
+func (d *db2DB) caBundlePath(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read ssl_ca_file: %w", err)
+	}
+
+	var bundle []byte
+	for n := 1; ; n++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			// Decode skips text around blocks but also a block it cannot parse
+			if bytes.Contains(data, []byte("-----BEGIN")) {
+				return "", fmt.Errorf("invalid ssl_ca_file: block %d is not valid PEM", n)
+			}
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return "", fmt.Errorf("invalid ssl_ca_file: block %d is a %s, not a CERTIFICATE", n, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid ssl_ca_file: block %d: %w", n, err)
+		}
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+	if len(bundle) == 0 {
+		return "", fmt.Errorf("invalid ssl_ca_file: %s contains no PEM certificates", path)
+	}
+
+	certPath, err := d.writeTempFile(bundle)
+	if err != nil {
+		return "", fmt.Errorf("failed to write ssl_ca_file: %w", err)
+	}
+	return certPath, nil
+}
+
+// writeTempFile writes contents to a temporary file that is removed when the
+// connection is closed
+func (d *db2DB) writeTempFile(contents []byte) (string, error) {
+	f, err := os.CreateTemp("", "vault-db2-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	d.tempFiles = append(d.tempFiles, f.Name())
+	if _, err := f.Write(contents); err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// readConnectionURLFile returns the connection string stored in the file at
+// path, without surrounding whitespace such as a trailing newline
+func readConnectionURLFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read connection_url_file: %w", err)
+	}
+
+	url := strings.TrimSpace(string(data))
+	if url == "" {
+		return "", fmt.Errorf("connection_url_file %s is empty", path)
+	}
+	return url, nil
+}
+
+// readPasswordFile returns the password stored in the file at path, without
+// a trailing newline. Other whitespace is kept as part of the password.
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password_file: %w", err)
+	}
+
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password_file %s is empty", path)
+	}
+	return password, nil
+}
+
+// reloadCredentialFiles reads the connection_url_file and password_file
+// again and rebuilds the connection string from them. The pool must already
+// be closed.
+func (d *db2DB) reloadCredentialFiles(ctx context.Context) error {
+	config := d.config
+	if config.PasswordFile != "" {
+		password, err := readPasswordFile(config.PasswordFile)
+		if err != nil {
+			return err
+		}
+		config.Password = password
+	}
+
+	d.Lock()
+	raw := d.RawConfig
+	d.Unlock()
+	conf := producerConfig(raw, config)
+	if config.ConnectionURLFile != "" {
+		url, err := readConnectionURLFile(config.ConnectionURLFile)
+		if err != nil {
+			return err
+		}
+		conf["connection_url"] = url
+	}
+	url, _ := conf["connection_url"].(string)
+	if url == "" && config.DSNAlias != "" {
+		url = "DSN=" + config.DSNAlias
+		conf["connection_url"] = url
+	}
+	// Init replaces RawConfig, which must stay the plugin config, e.g. for
+	// root rotation to re-initialize with
+	_, err := d.db2ConnectionProducer.Init(ctx, conf, false)
+	d.Lock()
+	d.RawConfig = raw
+	d.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The files the old connection string refers to are removed once it has
+	// been replaced
+	oldFiles := d.tempFiles
+	d.tempFiles = nil
+	d.Lock()
+	base := d.ConnectionURL
+	d.Unlock()
+	dsn, err := d.buildConnectionString(base, config)
+	if err != nil {
+		d.tempFiles = append(oldFiles, d.tempFiles...)
+		return err
+	}
+
+	failoverDSN := failoverConnectionString(dsn, config)
+	d.urlSecrets = connectionSecrets(url, base, dsn, failoverDSN)
+	d.Lock()
+	d.ConnectionURL = dsn
+	d.failoverDSN, d.failoverActive = failoverDSN, false
+	d.Unlock()
+	d.updateSecrets()
+	d.clearServerVersion()
+
+	for _, path := range oldFiles {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// removeTempFiles deletes the files written by writeTempFile
+func (d *db2DB) removeTempFiles() {
+	for _, path := range d.tempFiles {
+		os.Remove(path)
+	}
+	d.tempFiles = nil
+}
+
+// redactURLPassword replaces a plaintext PWD in conf's connection_url with the
+// {{password}} template, since Vault returns connection_url as configured but
+// never the password field. The value moves to the password field unless one
+// is set, which takes precedence over it anyway; kerberos mode ignores it.
+func redactURLPassword(conf map[string]interface{}, config db2Config) {
+	rawURL, _ := conf["connection_url"].(string)
+	cs := parseConnectionString(rawURL)
+	pwd, ok := cs.get("PWD")
+	if !ok || pwd == "" || strings.Contains(pwd, "{{") {
+		return
+	}
+
+	if config.AuthType == authTypeKerberos {
+		cs.delete("PWD")
+	} else {
+		cs.set("PWD", "{{password}}")
+		if config.Password == "" {
+			conf["password"] = pwd
+		}
+	}
+	conf["connection_url"] = cs.String()
+}
+
+// failoverConnectionString returns dsn with the failover credentials in place
+// of the root credentials, or "" when none are configured
+func failoverConnectionString(dsn string, config db2Config) string {
+	if config.FailoverUsername == "" {
+		return ""
+	}
+
+	cs := parseConnectionString(dsn)
+	cs.set("UID", config.FailoverUsername)
+	cs.set("PWD", config.FailoverPassword)
+	return cs.String()
+}
+
+// connectionSecrets returns the given connection strings and the credential
+// and certificate settings embedded in them, such as UID, PWD or
+// SSLClientKeystoreDBPassword, mapped to their redacted form
+func connectionSecrets(dsns ...string) map[string]string {
+	secrets := map[string]string{}
+	for _, dsn := range dsns {
+		if dsn == "" {
+			continue
+		}
+		secrets[dsn] = "[connection_url]"
+
+		cs := parseConnectionString(dsn)
+		for _, key := range cs.keys {
+			value, _ := cs.get(key)
+			if value == "" || strings.Contains(value, "{{") || !isRedactedKeyword(key) {
+				continue
+			}
+
+			switch strings.ToUpper(key) {
+			case "UID":
+				secrets[value] = "[username]"
+			case "PWD":
+				secrets[value] = "[password]"
+			default:
+				secrets[value] = "[" + strings.ToLower(key) + "]"
+			}
+		}
+	}
+
+	return secrets
+}
+
+// connectionString is an ordered set of DB2 CLI connection string keywords,
+// e.g. DATABASE=mydb;HOSTNAME=host;PORT=50000. Keywords are matched
+// case-insensitively but keep the case they were first written with.
+type connectionString struct {
+	keys   []string
+	values map[string]string
+}
+
+// parseConnectionString splits a DB2 CLI connection string into its keywords.
+// Values wrapped in braces may contain semicolons.
+func parseConnectionString(dsn string) *connectionString {
+	cs := &connectionString{values: map[string]string{}}
+
+	for _, part := range splitConnectionString(dsn) {
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			value = value[1 : len(value)-1]
+		}
+		cs.set(key, value)
+	}
+
+	return cs
+}
+
+// splitConnectionString splits on semicolons that are not inside braces
+func splitConnectionString(dsn string) []string {
+	var parts []string
+	var current strings.Builder
+	depth := 0
+
+	for _, r := range dsn {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case r == ';' && depth == 0:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	parts = append(parts, current.String())
+
+	return parts
+}
+
+// get returns the value of key, matched case-insensitively
+func (cs *connectionString) get(key string) (string, bool) {
+	value, ok := cs.values[strings.ToUpper(key)]
+	return value, ok
+}
+
+// set adds key or replaces its value, keeping its original position
+func (cs *connectionString) set(key, value string) {
+	upper := strings.ToUpper(key)
+	if _, ok := cs.values[upper]; !ok {
+		cs.keys = append(cs.keys, key)
+	}
+	cs.values[upper] = value
+}
+
+// delete removes key if present
+func (cs *connectionString) delete(key string) {
+	upper := strings.ToUpper(key)
+	if _, ok := cs.values[upper]; !ok {
+		return
+	}
+	delete(cs.values, upper)
+
+	for i, k := range cs.keys {
+		if strings.ToUpper(k) == upper {
+			cs.keys = append(cs.keys[:i], cs.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// String renders the connection string, wrapping values that contain
+// semicolons or equals signs in braces
+func (cs *connectionString) String() string {
+	parts := make([]string, 0, len(cs.keys))
+	for _, key := range cs.keys {
+		value := cs.values[strings.ToUpper(key)]
+		if strings.ContainsAny(value, ";={}") {
+			value = "{" + value + "}"
+		}
+		parts = append(parts, key+"="+value)
+	}
+
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,295 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sqlStateAuthorizationNotHeld is returned when revoking a privilege the
+	// authorization name does not hold (SQL0556N), including when the user is gone
+	sqlStateAuthorizationNotHeld = "42504"
+
+	// sqlStateUndefinedName is returned when an object, such as a schema, is
+	// not defined (SQL0204N); sqlStateInvalidSchemaName is its standard
+	// counterpart
+	sqlStateUndefinedName     = "42704"
+	sqlStateInvalidSchemaName = "3F000"
+
+	// sqlStateInsufficientPrivilege is returned when the authorization ID
+	// lacks a privilege the statement requires (SQL0551N, SQL0552N)
+	sqlStateInsufficientPrivilege = "42501"
+
+	// sqlStateDuplicateName is returned when an object to be created, such
+	// as a role, already exists (SQL0601N)
+	sqlStateDuplicateName = "42710"
+
+	// sqlCodeSecurityFailure is returned when the server rejects the
+	// connection's credentials (SQL30082N)
+	sqlCodeSecurityFailure = -30082
+
+	// securityReasonPasswordExpired is the SQL30082N reason code for an
+	// expired password
+	securityReasonPasswordExpired = 1
+
+	// securityReasonAccountLocked is the SQL30082N reason code for a user ID
+	// that is disabled or revoked, e.g. locked after too many failed logins
+	securityReasonAccountLocked = 19
+)
+
+// ErrOperationNotSupported is wrapped by errors for operations the current
+// configuration cannot perform, such as password rotation in kerberos mode.
+// The error sanitizer that New wraps the plugin in flattens errors to their
+// text, so only callers of the unwrapped database can match it
+var ErrOperationNotSupported = errors.New("not supported")
+
+// errPasswordExpired is returned when the server rejects the connection
+// because the admin user's password has expired
+var errPasswordExpired = errors.New("admin password expired; rotate root credentials")
+
+// errAccountLocked is returned when the server rejects a login because the
+// account is locked, which no change of credentials in Vault can fix
+var errAccountLocked = errors.New("account locked; contact your DBA to unlock it")
+
+// securityReasonRegex matches the reason code of a SQL30082N message
+var securityReasonRegex = regexp.MustCompile(`\breason "?(\d+)"?`)
+
+// errStandby is returned when a password change reaches an HADR standby,
+// whose database is read-only
+var errStandby = errors.New("connected to a read-only HADR standby; password changes must run on the primary")
+
+// errProcedureFailed is returned when a change_password_procedure reports a
+// nonzero result code
+var errProcedureFailed = errors.New("password change procedure failed")
+
+// errVerifyFailed is returned when verify_after_rotation finds that a user
+// cannot connect with the password it was just given
+var errVerifyFailed = errors.New("new password failed verification")
+
+// errPostStatement is returned when a rotation_post_statements statement
+// fails, to tell it apart from a failed password change
+var errPostStatement = errors.New("rotation post-statement")
+
+// errInsufficientPrivilege is returned when the preflight check finds the
+// connection cannot run a password change statement
+var errInsufficientPrivilege = errors.New("insufficient privilege")
+
+// defaultRetryableErrors are treated as transient during rotation: the
+// SQL30081N communication error seen after a failover, and the CLI link
+// failure and statement completion unknown SQLSTATEs. SQLSTATE 08001 is not
+// included because authentication failures (SQL30082N) share it.
+var defaultRetryableErrors = []string{"-30081", "08S01", "40003"}
+
+// sqlCodeRegex matches the SQLCODE as it appears in DB2 messages, either as
+// the message identifier ("SQL30081N") or explicitly ("SQLCODE=-30081")
+var sqlCodeRegex = regexp.MustCompile(`\bSQL(?:CODE=(-?\d+)|(\d{4,5})[NWC]\b)`)
+
+// sqlStateRegex matches the SQLSTATE as it appears in DB2 messages
+// ("SQLSTATE=42501") and in go_ibm_db diagnostic records ("{42501}")
+var sqlStateRegex = regexp.MustCompile(`(?:SQLSTATE=|\{)([0-9A-Z]{5})\b`)
+
+// sqlState extracts the SQLSTATE from a DB2 driver error, or returns an empty
+// string if none is present
+func sqlState(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	m := sqlStateRegex.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
+
+// isAuthorizationNotHeld reports whether err indicates that the privilege or
+// authorization being revoked does not exist
+func isAuthorizationNotHeld(err error) bool {
+	return sqlState(err) == sqlStateAuthorizationNotHeld
+}
+
+// isUndefinedSchema reports whether err indicates that a schema does not exist
+func isUndefinedSchema(err error) bool {
+	state := sqlState(err)
+	return state == sqlStateUndefinedName || state == sqlStateInvalidSchemaName
+}
+
+// isDuplicateName reports whether err indicates that the object a statement
+// creates already exists
+func isDuplicateName(err error) bool {
+	return sqlState(err) == sqlStateDuplicateName || sqlCode(err) == -601
+}
+
+// isInsufficientPrivilege reports whether err indicates that the
+// authorization ID lacks a privilege the statement requires
+func isInsufficientPrivilege(err error) bool {
+	if sqlState(err) == sqlStateInsufficientPrivilege {
+		return true
+	}
+	code := sqlCode(err)
+	return code == -551 || code == -552
+}
+
+// isStandby reports whether err indicates the statement was rejected because
+// the database is an HADR standby (SQL1773N, SQL1776N)
+func isStandby(err error) bool {
+	code := sqlCode(err)
+	return code == -1773 || code == -1776
+}
+
+// lockTimeoutReasonRegex matches the reason code of a SQL0911N or SQL0913N
+// message for a lock timeout rather than a deadlock: 68 on LUW, 00C9008E on
+// z/OS
+var lockTimeoutReasonRegex = regexp.MustCompile(`(?i)\breason(?: code)?\s*"?(?:68|00C9008E)\b`)
+
+// isLockTimeout reports whether err indicates the statement was rolled back
+// after waiting longer than the lock timeout for a lock
+func isLockTimeout(err error) bool {
+	code := sqlCode(err)
+	return (code == -911 || code == -913) && lockTimeoutReasonRegex.MatchString(err.Error())
+}
+
+// connectError distinguishes a connect timeout, an expired password, a
+// locked account and other authentication failures in an error from
+// establishing a connection
+func connectError(err error, timeout time.Duration) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("timed out connecting after %s: %w", timeout, err)
+	case sqlCode(err) == sqlCodeSecurityFailure && securityReason(err) == securityReasonPasswordExpired:
+		return fmt.Errorf("%w: %w", errPasswordExpired, err)
+	}
+
+	return authError(err)
+}
+
+// authError tells a locked account apart from other authentication failures
+// (SQL30082N) in err, and returns any other error unchanged
+func authError(err error) error {
+	if sqlCode(err) != sqlCodeSecurityFailure {
+		return err
+	}
+	if securityReason(err) == securityReasonAccountLocked {
+		return fmt.Errorf("%w: %w", errAccountLocked, err)
+	}
+	return fmt.Errorf("authentication failed: %w", err)
+}
+
+// securityReason returns the reason code of a SQL30082N error, or 0 if none
+// is present. The chain is searched because describeError drops the driver
+// message, which carries the reason, from its own text.
+func securityReason(err error) int {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if m := securityReasonRegex.FindStringSubmatch(err.Error()); m != nil {
+			reason, _ := strconv.Atoi(m[1])
+			return reason
+		}
+	}
+
+	return 0
+}
+
+// sqlErrorHints describe common SQLCODEs in errors returned to Vault
+var sqlErrorHints = map[int]string{
+	-104:   "syntax error",
+	-204:   "undefined name",
+	-551:   "insufficient privilege",
+	-552:   "insufficient privilege",
+	-556:   "privilege not held",
+	-567:   "invalid authorization ID",
+	-911:   "deadlock or timeout",
+	-913:   "deadlock or timeout",
+	-1060:  "no CONNECT privilege",
+	-1773:  "HADR standby",
+	-1776:  "HADR standby",
+	-30081: "communication error",
+	-30082: "authentication failed",
+}
+
+// sqlError is a DB2 driver error reduced to its SQLCODE and SQLSTATE. The
+// driver message is left out because it may echo the failing statement,
+// including any password in it.
+type sqlError struct {
+	code  int
+	state string
+	err   error
+}
+
+func (e *sqlError) Error() string {
+	var parts []string
+	if e.code != 0 {
+		parts = append(parts, fmt.Sprintf("SQLCODE=%d", e.code))
+	}
+	if e.state != "" {
+		parts = append(parts, "SQLSTATE="+e.state)
+	}
+
+	msg := strings.Join(parts, " ")
+	if hint, ok := sqlErrorHints[e.code]; ok {
+		msg += " (" + hint + ")"
+	}
+	return msg
+}
+
+func (e *sqlError) Unwrap() error {
+	return e.err
+}
+
+// describeError returns err as a sqlError if it carries a SQLCODE or
+// SQLSTATE, and unchanged otherwise
+func describeError(err error) error {
+	code, state := sqlCode(err), sqlState(err)
+	if code == 0 && state == "" {
+		return err
+	}
+
+	return &sqlError{code: code, state: state, err: err}
+}
+
+// sqlCode extracts the SQLCODE from a DB2 driver error, returning 0 if none
+// is present. Message identifiers ending in N or C are errors and map to
+// negative codes.
+func sqlCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	m := sqlCodeRegex.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+
+	if m[1] != "" {
+		code, _ := strconv.Atoi(m[1])
+		return code
+	}
+
+	code, _ := strconv.Atoi(m[2])
+	if m[0][len(m[0])-1] != 'W' {
+		code = -code
+	}
+	return code
+}
+
+// isRetryable reports whether err carries one of the given SQLSTATEs or SQLCODEs
+func isRetryable(err error, retryable []string) bool {
+	if state := sqlState(err); state != "" && slices.Contains(retryable, state) {
+		return true
+	}
+
+	if code := sqlCode(err); code != 0 && slices.Contains(retryable, strconv.Itoa(code)) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,207 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLState(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"nil error": {
+			err:      nil,
+			expected: "",
+		},
+		"message format": {
+			err:      errors.New(`SQL0556N  An attempt to revoke a privilege from "APPUSER" was denied.  SQLSTATE=42504`),
+			expected: "42504",
+		},
+		"diagnostic record format": {
+			err:      errors.New(`SQLExecute: {42501} [IBM][CLI Driver][DB2/LINUXX8664] SQL0551N  ...`),
+			expected: "42501",
+		},
+		"no sqlstate": {
+			err:      errors.New("connection refused"),
+			expected: "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := sqlState(tc.err); got != tc.expected {
+				t.Errorf("expected SQLSTATE %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSQLCode(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected int
+	}{
+		"nil error": {
+			err:      nil,
+			expected: 0,
+		},
+		"error message identifier": {
+			err:      errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"),
+			expected: -30081,
+		},
+		"warning message identifier": {
+			err:      errors.New("SQL0100W  No row was found.  SQLSTATE=02000"),
+			expected: 100,
+		},
+		"explicit sqlcode": {
+			err:      errors.New("DSNT408I SQLCODE=-551, ERROR: ADMIN DOES NOT HAVE THE PRIVILEGE"),
+			expected: -551,
+		},
+		"no sqlcode": {
+			err:      errors.New("connection refused"),
+			expected: 0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := sqlCode(tc.err); got != tc.expected {
+				t.Errorf("expected SQLCODE %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	commErr := errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001")
+	authErr := errors.New("SQL30082N  Security processing failed.  SQLSTATE=08001")
+
+	if !isRetryable(commErr, defaultRetryableErrors) {
+		t.Error("expected communication failure to be retryable by default")
+	}
+	if !isRetryable(commErr, []string{"08001"}) {
+		t.Error("expected communication failure to be retryable by SQLSTATE")
+	}
+	if isRetryable(authErr, defaultRetryableErrors) {
+		t.Error("expected authentication failure not to be retryable by default")
+	}
+	if isRetryable(errors.New("SQL0104N  An unexpected token.  SQLSTATE=42601"), defaultRetryableErrors) {
+		t.Error("expected syntax error not to be retryable")
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"known code": {
+			err:      errors.New(`SQL0551N  "ADMIN" does not have the required authorization or privilege to perform operation "ALTER USER".  SQLSTATE=42501`),
+			expected: "SQLCODE=-551 SQLSTATE=42501 (insufficient privilege)",
+		},
+		"diagnostic record": {
+			err:      errors.New(`SQLExecDirect: {42601} [IBM][CLI Driver][DB2/LINUXX8664] SQL0104N  An unexpected token "'secret'" was found`),
+			expected: "SQLCODE=-104 SQLSTATE=42601 (syntax error)",
+		},
+		"unknown code": {
+			err:      errors.New("SQL0438N  Application raised error.  SQLSTATE=70001"),
+			expected: "SQLCODE=-438 SQLSTATE=70001",
+		},
+		"sqlstate only": {
+			err:      errors.New("{08S01} communication link failure"),
+			expected: "SQLSTATE=08S01",
+		},
+		"no codes": {
+			err:      errors.New("connection refused"),
+			expected: "connection refused",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := describeError(tc.err)
+			if err.Error() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, err.Error())
+			}
+			if !errors.Is(err, tc.err) {
+				t.Error("expected the driver error to remain in the chain")
+			}
+		})
+	}
+}
+
+func TestIsInsufficientPrivilege(t *testing.T) {
+	tests := map[string]bool{
+		`SQL0551N  "ADMIN" does not have the required authorization.  SQLSTATE=42501`:         true,
+		`SQL0552N  "ADMIN" does not have the privilege to perform operation.  SQLSTATE=42502`: true,
+		`SQL0204N  "APP.T" is an undefined name.  SQLSTATE=42704`:                             false,
+	}
+	for msg, expected := range tests {
+		if got := isInsufficientPrivilege(errors.New(msg)); got != expected {
+			t.Errorf("expected %v for %q, got %v", expected, msg, got)
+		}
+	}
+}
+
+func TestConnectError_PasswordExpired(t *testing.T) {
+	expired := describeError(errors.New(`SQL30082N  Security processing failed with reason "1" ("PASSWORD EXPIRED").  SQLSTATE=08001`))
+	if err := connectError(expired, time.Second); !errors.Is(err, errPasswordExpired) {
+		t.Errorf("expected password expired error, got: %v", err)
+	}
+
+	invalid := describeError(errors.New(`SQL30082N  Security processing failed with reason "24" ("USERNAME AND/OR PASSWORD INVALID").  SQLSTATE=08001`))
+	err := connectError(invalid, time.Second)
+	if errors.Is(err, errPasswordExpired) || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("expected a generic authentication failure, got: %v", err)
+	}
+}
+
+func TestConnectError_AccountLocked(t *testing.T) {
+	locked := describeError(errors.New(`SQL30082N  Security processing failed with reason "19" ("USERID DISABLED or RESTRICTED").  SQLSTATE=08001`))
+	err := connectError(locked, time.Second)
+	if !errors.Is(err, errAccountLocked) || errors.Is(err, errPasswordExpired) {
+		t.Errorf("expected account locked error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "SQLCODE=-30082") {
+		t.Errorf("expected the server error to be kept, got: %v", err)
+	}
+
+	other := errors.New(`SQL0551N  "ADMIN" does not have the privilege.  SQLSTATE=42501`)
+	if err := authError(other); err != other {
+		t.Errorf("expected other errors to be returned unchanged, got: %v", err)
+	}
+}
+
+func TestIsStandby(t *testing.T) {
+	tests := map[string]bool{
+		`SQL1773N  The statement or command requires functionality that is not supported on a read-enabled HADR standby database.  SQLSTATE=08004`: true,
+		`SQL1776N  The command cannot be issued on an HADR standby database.  Reason code = "1".`:                                                  true,
+		`SQL0551N  "ADMIN" does not have the privilege.  SQLSTATE=42501`:                                                                           false,
+	}
+	for msg, expected := range tests {
+		if got := isStandby(errors.New(msg)); got != expected {
+			t.Errorf("expected isStandby %v for %q", expected, msg)
+		}
+	}
+}
+
+func TestIsLockTimeout(t *testing.T) {
+	tests := map[string]bool{
+		`SQL0911N  The current transaction has been rolled back because of a deadlock or timeout.  Reason code "68".  SQLSTATE=40001`: true,
+		`SQL0911N  The current transaction has been rolled back because of a deadlock or timeout.  Reason code "2".  SQLSTATE=40001`:  false,
+		`SQLCODE=-911, SQLSTATE=40001, ROLLED BACK DUE TO DEADLOCK OR TIMEOUT. REASON 00C9008E`:                                       true,
+		`SQLCODE=-913, SQLSTATE=57033, UNSUCCESSFUL EXECUTION CAUSED BY DEADLOCK OR TIMEOUT. REASON CODE 00C90088`:                    false,
+		`SQL0551N  "ADMIN" does not have the privilege.  SQLSTATE=42501`:                                                              false,
+	}
+	for msg, expected := range tests {
+		if got := isLockTimeout(errors.New(msg)); got != expected {
+			t.Errorf("expected isLockTimeout %v for %q", expected, msg)
+		}
+	}
+}
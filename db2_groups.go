@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+const (
+	// userGroupsQuery returns the groups DB2 LUW's security plugin reports
+	// for an authorization ID, as used to resolve group privileges
+	userGroupsQuery = "SELECT T.GROUP FROM TABLE (SYSPROC.AUTH_LIST_GROUPS_FOR_AUTHID(?)) AS T"
+
+	// groupAuthoritiesQuery returns the database authorities an
+	// authorization ID holds through a group, directly or through a role
+	// granted to the group
+	groupAuthoritiesQuery = "SELECT T.AUTHORITY FROM TABLE (SYSPROC.AUTH_LIST_AUTHORITIES_FOR_AUTHID(?, 'U')) AS T WHERE T.D_GROUP = 'Y' OR T.ROLE_GROUP = 'Y'"
+)
+
+// userGroups returns the groups username belongs to
+func userGroups(ctx context.Context, q queryer, username string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, userGroupsQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, strings.TrimSpace(group))
+	}
+	return groups, rows.Err()
+}
+
+// revokeGroupPrivileges runs the revocation_group_statements for each group
+// username belongs to, within the revocation's transaction
+func (d *db2DB) revokeGroupPrivileges(ctx context.Context, tx *sql.Tx, username string) error {
+	groups, err := userGroups(ctx, tx, username)
+	if err != nil {
+		return fmt.Errorf("failed to list groups of user %s: %w", username, describeError(err))
+	}
+
+	for _, group := range groups {
+		// Group names come from the operating system or LDAP, which allow
+		// characters that could end a quoted identifier
+		if strings.ContainsAny(group, `"';`) {
+			return fmt.Errorf("group %q of user %s cannot be used in revocation_group_statements", group, username)
+		}
+
+		values := map[string]string{"username": username, "group": group}
+		if err := d.execRevocationStatements(ctx, tx, d.config.RevocationGroupStatements, values); err != nil {
+			return fmt.Errorf("failed to revoke group %s of user %s: %w", group, username, describeError(err))
+		}
+	}
+
+	return nil
+}
+
+// checkGroupAccess warns when username still holds database authorities
+// through a group once its own have been revoked. Revocation has already
+// succeeded, so a failed check is only logged too.
+func (d *db2DB) checkGroupAccess(ctx context.Context, q queryer, username string) {
+	rows, err := q.QueryContext(ctx, groupAuthoritiesQuery, username)
+	if err != nil {
+		d.log().Warn("failed to check for access through groups after revocation", "username", username, "error", d.sanitize(describeError(err)).Error())
+		return
+	}
+	defer rows.Close()
+
+	var authorities []string
+	for rows.Next() {
+		var authority string
+		if err := rows.Scan(&authority); err != nil {
+			d.log().Warn("failed to check for access through groups after revocation", "username", username, "error", d.sanitize(err).Error())
+			return
+		}
+		authorities = append(authorities, strings.TrimSpace(authority))
+	}
+	if err := rows.Err(); err != nil {
+		d.log().Warn("failed to check for access through groups after revocation", "username", username, "error", d.sanitize(describeError(err)).Error())
+		return
+	}
+
+	if len(authorities) > 0 {
+		groups, _ := userGroups(ctx, q, username)
+		d.log().Warn("user still has access through group membership after revocation",
+			"username", username, "authorities", strings.Join(authorities, ","), "groups", strings.Join(groups, ","))
+	}
+}
+
+// execRevocationStatements runs statements with values substituted, treating
+// privileges that are already gone as revoked
+func (d *db2DB) execRevocationStatements(ctx context.Context, tx *sql.Tx, statements []string, values map[string]string) error {
+	for _, stmt := range statements {
+		query := dbutil.QueryHelper(stmt, values)
+
+		stmtCtx, cancel := d.config.statementContext(ctx)
+		_, err := tx.ExecContext(stmtCtx, query)
+		cancel()
+		if err != nil && !isAuthorizationNotHeld(err) {
+			return err
+		}
+	}
+
+	return nil
+}
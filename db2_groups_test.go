@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestDeleteUser_RevocationGroupStatements(t *testing.T) {
+	conf := map[string]interface{}{
+		"revocation_statements":       []interface{}{`REVOKE CONNECT ON DATABASE FROM USER "{{username}}"`},
+		"revocation_group_statements": []interface{}{`REVOKE CONNECT ON DATABASE FROM GROUP "{{group}}"`},
+	}
+	req := dbplugin.DeleteUserRequest{Username: "V1AB2C3D"}
+
+	t.Run("revokes from each group", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.respond("AUTH_LIST_GROUPS_FOR_AUTHID", []driver.Value{"V1AB2C3D"}, []driver.Value{"APPUSERS "})
+
+		if _, err := db.DeleteUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			`REVOKE CONNECT ON DATABASE FROM USER "V1AB2C3D"`,
+			`REVOKE CONNECT ON DATABASE FROM GROUP "V1AB2C3D"`,
+			`REVOKE CONNECT ON DATABASE FROM GROUP "APPUSERS"`,
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("group privilege already gone", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.respond("AUTH_LIST_GROUPS_FOR_AUTHID", []driver.Value{"APPUSERS"})
+		srv.failOn("FROM GROUP", errors.New(`SQL0556N  An attempt to revoke a privilege, security label, exemption, or role from "APPUSERS" was denied because "APPUSERS" does not hold this privilege.  SQLSTATE=42504`))
+
+		if _, err := db.DeleteUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.respond("AUTH_LIST_GROUPS_FOR_AUTHID", []driver.Value{"APPUSERS"})
+		srv.failOn("FROM GROUP", errors.New(`SQL0551N  "ADMIN" does not have the privilege to perform operation "REVOKE".  SQLSTATE=42501`))
+
+		_, err := db.DeleteUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "failed to revoke group APPUSERS of user V1AB2C3D: SQLCODE=-551") {
+			t.Fatalf("expected group revocation error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected the revocation to be rolled back, got: %v", got)
+		}
+	})
+
+	t.Run("unsafe group name", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.respond("AUTH_LIST_GROUPS_FOR_AUTHID", []driver.Value{`APP"; DROP TABLE X; --`})
+
+		_, err := db.DeleteUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "cannot be used in revocation_group_statements") {
+			t.Fatalf("expected the group to be rejected, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to be applied, got: %v", got)
+		}
+	})
+}
+
+func TestDeleteUser_RevocationGroupCheck(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(srv *fakeServer)
+		expected []string
+	}{
+		"access through group": {
+			setup: func(srv *fakeServer) {
+				srv.respond("AUTH_LIST_AUTHORITIES_FOR_AUTHID", []driver.Value{"CONNECT"}, []driver.Value{"DATAACCESS"})
+				srv.respond("AUTH_LIST_GROUPS_FOR_AUTHID", []driver.Value{"APPUSERS"})
+			},
+			expected: []string{"user still has access through group membership after revocation", "CONNECT,DATAACCESS", "APPUSERS"},
+		},
+		"no access": {
+			setup: func(srv *fakeServer) {
+				srv.respond("AUTH_LIST_AUTHORITIES_FOR_AUTHID")
+			},
+		},
+		"check fails": {
+			setup: func(srv *fakeServer) {
+				srv.failOn("AUTH_LIST_AUTHORITIES_FOR_AUTHID", errors.New("SQL0440N  No authorized routine named \"AUTH_LIST_AUTHORITIES_FOR_AUTHID\" was found.  SQLSTATE=42884"))
+			},
+			expected: []string{"failed to check for access through groups after revocation", "SQLCODE=-440"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{"revocation_group_check": true})
+			var buf bytes.Buffer
+			db.logger = newTestLogger(&buf)
+			if tc.setup != nil {
+				tc.setup(srv)
+			}
+
+			if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "V1AB2C3D"}); err != nil {
+				t.Fatalf("expected revocation to succeed, got: %v", err)
+			}
+
+			logs := buf.String()
+			if len(tc.expected) == 0 && strings.Contains(logs, "[WARN]") {
+				t.Errorf("expected no warning, got:\n%s", logs)
+			}
+			for _, want := range tc.expected {
+				if !strings.Contains(logs, want) {
+					t.Errorf("expected logs to contain %q, got:\n%s", want, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfig_RevocationGroups(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"platform": "zos", "revocation_group_check": true},
+		{"platform": "zos", "revocation_group_statements": []interface{}{`REVOKE CONNECT ON DATABASE FROM GROUP "{{group}}"`}},
+	}
+	for _, conf := range invalid {
+		if _, err := parseConfig(conf); err == nil || !strings.Contains(err.Error(), `require platform "luw"`) {
+			t.Errorf("expected %v to be rejected, got: %v", conf, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// isolationLevels maps the DB2 isolation levels transaction_isolation
+// accepts to their database/sql equivalents
+var isolationLevels = map[string]sql.IsolationLevel{
+	"UR": sql.LevelReadUncommitted,
+	"CS": sql.LevelReadCommitted,
+	"RS": sql.LevelRepeatableRead,
+	"RR": sql.LevelSerializable,
+}
+
+const resetIsolationStatement = "SET CURRENT ISOLATION = RESET"
+
+// supportsTxOptions reports whether the driver connection behind conn takes
+// the isolation level from BeginTx. go_ibm_db's connections only implement
+// Begin, which database/sql refuses to call with a non-default level.
+func supportsTxOptions(conn *sql.Conn) bool {
+	var ok bool
+	conn.Raw(func(driverConn any) error {
+		_, ok = driverConn.(driver.ConnBeginTx)
+		return nil
+	})
+	return ok
+}
+
+// setIsolation sets CURRENT ISOLATION on conn to the transaction_isolation
+// for the password change transaction
+func (d *db2DB) setIsolation(ctx context.Context, config db2Config, conn *sql.Conn) error {
+	if err := d.execStatement(ctx, config, conn, "SET CURRENT ISOLATION = "+config.TransactionIsolation); err != nil {
+		return fmt.Errorf("failed to set transaction isolation: %w", describeError(err))
+	}
+	return nil
+}
+
+// resetIsolation restores the connection's isolation level before it returns
+// to the pool. As with resetLockTimeout, it runs even when ctx is done, and
+// the connection is discarded if it fails.
+func (d *db2DB) resetIsolation(config db2Config, conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := d.execStatement(ctx, config, conn, resetIsolationStatement); err != nil {
+		d.log().Warn("failed to reset the transaction isolation, discarding the connection", "error", d.sanitize(describeError(err)).Error())
+		discardConn(conn)
+	}
+}
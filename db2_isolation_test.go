@@ -0,0 +1,137 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// newTxTestDB2 is newTestDB2 with connections that take the isolation level
+// from BeginTx
+func newTxTestDB2(t *testing.T, conf map[string]interface{}) (*db2DB, *fakeServer) {
+	t.Helper()
+
+	srv, url := newFakeServer(t)
+	config := map[string]interface{}{
+		"connection_url": url,
+		"username":       "admin",
+		"password":       "adminpass",
+	}
+	for k, v := range conf {
+		config[k] = v
+	}
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeTxDriverName
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config}); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, srv
+}
+
+func TestUpdateUser_TransactionIsolation(t *testing.T) {
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	levels := map[string]sql.IsolationLevel{
+		"":   sql.LevelDefault,
+		"ur": sql.LevelReadUncommitted,
+		"CS": sql.LevelReadCommitted,
+		"RS": sql.LevelRepeatableRead,
+		"RR": sql.LevelSerializable,
+	}
+	for level, expected := range levels {
+		t.Run("BeginTx "+level, func(t *testing.T) {
+			db, srv := newTxTestDB2(t, map[string]interface{}{"platform": "zos", "transaction_isolation": level})
+
+			if _, err := db.UpdateUser(context.Background(), req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			opts := srv.beginTxOptions()
+			if len(opts) != 1 || opts[0].Isolation != driver.IsolationLevel(expected) {
+				t.Errorf("expected one transaction at isolation %s, got: %+v", expected, opts)
+			}
+			expectedStatements := []string{`ALTER USER "appuser" PASSWORD 'newpassword'`}
+			if got := srv.statements(); !reflect.DeepEqual(got, expectedStatements) {
+				t.Errorf("expected statements %v, got: %v", expectedStatements, got)
+			}
+		})
+	}
+
+	t.Run("set when BeginTx cannot take it", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "transaction_isolation": "cs"})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"SET CURRENT ISOLATION = CS",
+			`ALTER USER "appuser" PASSWORD 'newpassword'`,
+			"SET CURRENT ISOLATION = RESET",
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("set fails", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "transaction_isolation": "RR"})
+		srv.failOn("SET CURRENT ISOLATION", errors.New("SQL0104N  An unexpected token \"ISOLATION\" was found.  SQLSTATE=42601"))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "failed to set transaction isolation: SQLCODE=-104") {
+			t.Fatalf("expected an isolation error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to run, got: %v", got)
+		}
+	})
+}
+
+func TestParseConfig_TransactionIsolation(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"transaction_isolation": "rs"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.TransactionIsolation != "RS" {
+		t.Errorf("expected RS, got %q", config.TransactionIsolation)
+	}
+
+	tests := map[string]struct {
+		conf     map[string]interface{}
+		expected string
+	}{
+		"unknown level": {
+			conf:     map[string]interface{}{"transaction_isolation": "serializable"},
+			expected: `invalid transaction_isolation "SERIALIZABLE": must be UR, CS, RS or RR`,
+		},
+		"non-transactional": {
+			conf:     map[string]interface{}{"transaction_isolation": "CS", "rotation_non_transactional": true},
+			expected: "transaction_isolation cannot be used with rotation_non_transactional",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig(tc.conf)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected error containing %q, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	opRotateRoot   = "rotate_root"
+	opRollbackRoot = "rollback_root"
+)
+
+// log returns the plugin's logger, or a no-op logger if none is set
+func (d *db2DB) log() hclog.Logger {
+	if d.logger == nil {
+		return hclog.NewNullLogger()
+	}
+	return d.logger
+}
+
+// logOperation logs the outcome of operation for username at debug level.
+// Secret values are removed from err, along with any of the given passwords,
+// which the sanitizer does not know about.
+func (d *db2DB) logOperation(operation, username string, statements int, err error, passwords ...string) {
+	if err == nil {
+		d.log().Debug("operation succeeded", "operation", operation, "username", username, "statements", statements)
+		return
+	}
+
+	msg := maskPasswords(d.sanitize(err).Error(), passwords)
+
+	d.log().Debug("operation failed", "operation", operation, "username", username, "statements", statements, "error", msg)
+}
+
+// maskPasswords replaces each of passwords in msg, as given or as escaped
+// for a statement by {{password_escaped}}, with [password]
+func maskPasswords(msg string, passwords []string) string {
+	for _, password := range passwords {
+		if password != "" {
+			msg = strings.ReplaceAll(msg, db2EscapeLiteral(password), "[password]")
+			msg = strings.ReplaceAll(msg, password, "[password]")
+		}
+	}
+	return msg
+}
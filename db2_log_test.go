@@ -0,0 +1,179 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func newTestLogger(buf *bytes.Buffer) hclog.Logger {
+	return hclog.New(&hclog.LoggerOptions{
+		Level:  hclog.Debug,
+		Output: buf,
+	})
+}
+
+func TestLogging_UpdateUser(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	var buf bytes.Buffer
+	db.logger = newTestLogger(&buf)
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "s3cretnewpass"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An error echoing the statement must not leak the new password either
+	srv.failOn("ALTER USER", errors.New(`SQL0104N  An unexpected token "'s3cretnewpass'" was found.  SQLSTATE=42601`))
+	if _, err := db.UpdateUser(context.Background(), req); err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+
+	out := buf.String()
+	for _, expected := range []string{"operation succeeded", "operation failed", "operation=update_user", "username=appuser", "statements=1"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected log to contain %q, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "s3cretnewpass") {
+		t.Errorf("expected log not to contain the new password, got:\n%s", out)
+	}
+}
+
+func TestLogging_EscapedPassword(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	var buf bytes.Buffer
+	db.logger = newTestLogger(&buf)
+
+	// The statement holds the password with its quote doubled
+	srv.failOn("ALTER USER", errors.New(`SQL0104N  An unexpected token "'it''s-s3cret'" was found.  SQLSTATE=42601`))
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "it's-s3cret"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+
+	if out := buf.String(); strings.Contains(out, "s3cret") {
+		t.Errorf("expected log not to contain the escaped password, got:\n%s", out)
+	}
+}
+
+func TestLogging_UpdateUserConfirmation(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	var buf bytes.Buffer
+	db.logger = newTestLogger(&buf)
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "s3cretnewpass"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out := buf.String(); strings.Count(out, "password rotated") != 1 || !strings.Contains(out, "password rotated: username=appuser") {
+		t.Errorf("expected one confirmation naming the user, got:\n%s", out)
+	}
+
+	// Only completed rotations are confirmed
+	buf.Reset()
+	srv.failOn("ALTER USER", errors.New("SQL0551N  SQLSTATE=42501"))
+	if _, err := db.UpdateUser(context.Background(), req); err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+	if out := buf.String(); strings.Contains(out, "password rotated") {
+		t.Errorf("expected no confirmation for a failed rotation, got:\n%s", out)
+	}
+}
+
+func TestLogging_DeleteUser(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+	var buf bytes.Buffer
+	db.logger = newTestLogger(&buf)
+
+	if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if out := buf.String(); !strings.Contains(out, "operation=delete_user") || !strings.Contains(out, "username=VTEST") {
+		t.Errorf("expected revocation to be logged, got:\n%s", out)
+	}
+}
+
+func TestLogging_NilLogger(t *testing.T) {
+	db := newDB2()
+
+	// Without a logger, logs are discarded and must not panic
+	db.logOperation(opUpdateUser, "appuser", 1, errors.New("failed"))
+}
+
+func TestLogging_InitializeConnectionString(t *testing.T) {
+	_, url := newFakeServer(t)
+
+	var buf bytes.Buffer
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	db.logger = newTestLogger(&buf)
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, "built connection string") || !strings.Contains(logs, "PWD=***") {
+		t.Errorf("expected the redacted connection string to be logged, got: %s", logs)
+	}
+	if strings.Contains(logs, "adminpass") {
+		t.Errorf("expected the password not to be logged, got: %s", logs)
+	}
+}
+
+func TestLogging_PoolLimitsClamped(t *testing.T) {
+	_, url := newFakeServer(t)
+
+	var buf bytes.Buffer
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	db.logger = newTestLogger(&buf)
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url":       url,
+			"username":             "admin",
+			"password":             "adminpass",
+			"max_open_connections": 2,
+			"max_idle_connections": 5,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "max_idle_connections exceeds max_open_connections") {
+		t.Errorf("expected a warning about the clamped max_idle_connections, got: %s", buf.String())
+	}
+	if db.MaxIdleConnections != 2 {
+		t.Errorf("expected max_idle_connections to be clamped to 2, got %d", db.MaxIdleConnections)
+	}
+}
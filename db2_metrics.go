@@ -0,0 +1,51 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+const (
+	opNewUser    = "new_user"
+	opUpdateUser = "update_user"
+	opDeleteUser = "delete_user"
+)
+
+// metricsPrefix is the key prefix for the plugin's telemetry
+var metricsPrefix = []string{"database", "db2"}
+
+// metricsSink returns the sink telemetry is emitted to: the configured one,
+// or the go-metrics global, which discards metrics unless the plugin process
+// sets it up
+func (d *db2DB) metricsSink() metrics.MetricSink {
+	if d.metrics != nil {
+		return d.metrics
+	}
+	return metrics.Default()
+}
+
+// recordOperation counts a success or failure, labeled with the operation
+func (d *db2DB) recordOperation(operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+
+	labels := []metrics.Label{{Name: "operation", Value: operation}}
+	d.metricsSink().IncrCounterWithLabels(metricsKey(outcome), 1, labels)
+}
+
+// recordStatement records how long a statement took to execute, in milliseconds
+func (d *db2DB) recordStatement(start time.Time) {
+	elapsed := float32(d.since(start).Seconds() * 1000)
+	d.metricsSink().AddSampleWithLabels(metricsKey("statement", "duration"), elapsed, nil)
+}
+
+// metricsKey appends parts to metricsPrefix without sharing its backing array
+func metricsKey(parts ...string) []string {
+	return append(append([]string(nil), metricsPrefix...), parts...)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// fakeSink records the keys of the counters and samples emitted to it
+type fakeSink struct {
+	metrics.BlackholeSink
+
+	mu       sync.Mutex
+	counters map[string]float32
+	samples  map[string]int
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{counters: map[string]float32{}, samples: map[string]int{}}
+}
+
+func (s *fakeSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[flattenMetric(key, labels)] += val
+}
+
+func (s *fakeSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[flattenMetric(key, labels)]++
+}
+
+func flattenMetric(key []string, labels []metrics.Label) string {
+	name := strings.Join(key, ".")
+	for _, label := range labels {
+		name += ";" + label.Name + "=" + label.Value
+	}
+	return name
+}
+
+func TestMetrics_UpdateUser(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+	sink := newFakeSink()
+	db.metrics = sink
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv.failOn("ALTER USER", errors.New("SQL0551N  The statement failed.  SQLSTATE=42501"))
+	if _, err := db.UpdateUser(context.Background(), req); err == nil {
+		t.Fatal("expected error when the statement fails")
+	}
+
+	if got := sink.counters["database.db2.success;operation=update_user"]; got != 1 {
+		t.Errorf("expected 1 success, got %v: %v", got, sink.counters)
+	}
+	if got := sink.counters["database.db2.failure;operation=update_user"]; got != 1 {
+		t.Errorf("expected 1 failure, got %v: %v", got, sink.counters)
+	}
+	if got := sink.samples["database.db2.statement.duration"]; got != 2 {
+		t.Errorf("expected 2 statement duration samples, got %d: %v", got, sink.samples)
+	}
+}
+
+func TestMetrics_NewAndDeleteUser(t *testing.T) {
+	db, _ := newTestDB2(t, nil)
+	sink := newFakeSink()
+	db.metrics = sink
+
+	if _, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{}); err == nil {
+		t.Fatal("expected error for empty creation statements")
+	}
+	if _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "VTEST"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := sink.counters["database.db2.failure;operation=new_user"]; got != 1 {
+		t.Errorf("expected 1 new_user failure, got %v: %v", got, sink.counters)
+	}
+	if got := sink.counters["database.db2.success;operation=delete_user"]; got != 1 {
+		t.Errorf("expected 1 delete_user success, got %v: %v", got, sink.counters)
+	}
+}
+
+func TestMetrics_NilSink(t *testing.T) {
+	db := newDB2()
+
+	// Without a sink, telemetry goes to the go-metrics global and must not panic
+	db.recordOperation(opUpdateUser, nil)
+	db.recordStatement(time.Now())
+}
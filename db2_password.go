@@ -0,0 +1,173 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/database/helper/credsutil"
+)
+
+const (
+	// DB2 for z/OS password phrases are limited to 100 characters, and LUW
+	// operating system passwords are rarely allowed to be longer
+	minPasswordLength = 8
+	maxPasswordLength = 100
+
+	defaultPasswordLength = 20
+
+	// maxPasswordAttempts bounds how many candidates generatePassword tries
+	// before giving up on a policy it cannot satisfy
+	maxPasswordAttempts = 100
+
+	upperChars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerChars   = "abcdefghijklmnopqrstuvwxyz"
+	digitChars   = "0123456789"
+	specialChars = "!#$%&()*+,-./:<=>?@[]^_|~"
+)
+
+// disallowedPasswordChars break the quoted string literals of the password
+// change statements or the DB2 CLI connection string
+const disallowedPasswordChars = "'\";{}\\` \t\r\n"
+
+// passwordPolicy describes the passwords the plugin generates itself, e.g.
+// during root rotation
+type passwordPolicy struct {
+	Length       int    `mapstructure:"length"`
+	MinUppercase int    `mapstructure:"min_uppercase"`
+	MinLowercase int    `mapstructure:"min_lowercase"`
+	MinDigits    int    `mapstructure:"min_digits"`
+	MinSpecial   int    `mapstructure:"min_special"`
+	SpecialChars string `mapstructure:"special_chars"`
+}
+
+// validate checks that the policy can produce passwords DB2 accepts
+func (p *passwordPolicy) validate() error {
+	if p.Length == 0 {
+		p.Length = defaultPasswordLength
+	}
+	if p.Length < minPasswordLength || p.Length > maxPasswordLength {
+		return fmt.Errorf("password_policy length must be between %d and %d", minPasswordLength, maxPasswordLength)
+	}
+
+	if p.MinUppercase < 0 || p.MinLowercase < 0 || p.MinDigits < 0 || p.MinSpecial < 0 {
+		return fmt.Errorf("password_policy minimums cannot be negative")
+	}
+	if p.MinUppercase+p.MinLowercase+p.MinDigits+p.MinSpecial > p.Length {
+		return fmt.Errorf("password_policy minimums exceed length %d", p.Length)
+	}
+
+	if strings.ContainsAny(p.SpecialChars, disallowedPasswordChars) {
+		return fmt.Errorf("password_policy special_chars cannot contain quotes, semicolons, braces, backslashes or whitespace")
+	}
+	if p.MinSpecial > 0 && p.SpecialChars == "" {
+		p.SpecialChars = specialChars
+	}
+
+	return nil
+}
+
+// generate returns a random password that contains at least the policy's
+// minimum number of each character class
+func (p *passwordPolicy) generate() (string, error) {
+	var password []byte
+	for _, class := range []struct {
+		chars string
+		min   int
+	}{
+		{upperChars, p.MinUppercase},
+		{lowerChars, p.MinLowercase},
+		{digitChars, p.MinDigits},
+		{p.SpecialChars, p.MinSpecial},
+	} {
+		chars, err := randomString(class.chars, class.min)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, chars...)
+	}
+
+	rest, err := randomString(upperChars+lowerChars+digitChars+p.SpecialChars, p.Length-len(password))
+	if err != nil {
+		return "", err
+	}
+	password = append(password, rest...)
+
+	// Shuffle so the required characters are not always at the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+// generatePassword returns a random password for the plugin's own use,
+// following the password_policy if one is configured. Candidates that break
+// DB2's constraints are regenerated.
+func (d *db2DB) generatePassword(ctx context.Context) (string, error) {
+	generate := func() (string, error) {
+		return credsutil.RandomAlphaNumeric(defaultPasswordLength, true)
+	}
+	if max := d.config.MaxPasswordLength; max > 0 && max < defaultPasswordLength {
+		// Keep the mix of the default format at the shorter length
+		capped := &passwordPolicy{Length: max, MinUppercase: 1, MinLowercase: 1, MinDigits: 1}
+		generate = capped.generate
+	}
+	if policy := d.config.PasswordPolicy; policy != nil {
+		generate = policy.generate
+	}
+
+	for attempt := 0; attempt < maxPasswordAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		password, err := generate()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+
+		if validatePassword(password) == nil {
+			return password, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a valid DB2 password after %d attempts", maxPasswordAttempts)
+}
+
+// validatePassword checks password against the limits DB2 places on
+// passwords and on the statements they are substituted into
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	if strings.ContainsAny(password, disallowedPasswordChars) {
+		return fmt.Errorf("password contains a character DB2 statements cannot quote")
+	}
+
+	return nil
+}
+
+// randomString returns length characters drawn uniformly from charset
+func randomString(charset string, length int) ([]byte, error) {
+	result := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = charset[n.Int64()]
+	}
+
+	return result, nil
+}
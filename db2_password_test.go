@@ -0,0 +1,197 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword_Default(t *testing.T) {
+	db := newDB2()
+
+	password, err := db.generatePassword(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(password) != defaultPasswordLength {
+		t.Errorf("expected %d characters, got %d", defaultPasswordLength, len(password))
+	}
+	if err := validatePassword(password); err != nil {
+		t.Errorf("expected a valid DB2 password, got: %v", err)
+	}
+}
+
+func TestGeneratePassword_Policy(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{
+		"password_policy": map[string]interface{}{
+			"length":        12,
+			"min_uppercase": 2,
+			"min_lowercase": 2,
+			"min_digits":    "3",
+			"min_special":   2,
+			"special_chars": "#@",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	db := newDB2()
+	db.config = config
+
+	for i := 0; i < 50; i++ {
+		password, err := db.generatePassword(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(password) != 12 {
+			t.Fatalf("expected 12 characters, got %q", password)
+		}
+		if strings.Trim(password, upperChars+lowerChars+digitChars+"#@") != "" {
+			t.Fatalf("expected only policy characters, got %q", password)
+		}
+		if countChars(password, upperChars) < 2 || countChars(password, lowerChars) < 2 ||
+			countChars(password, digitChars) < 3 || countChars(password, "#@") < 2 {
+			t.Fatalf("expected %q to satisfy the policy minimums", password)
+		}
+	}
+}
+
+func TestGeneratePassword_Unsatisfiable(t *testing.T) {
+	db := newDB2()
+	// Every candidate contains a quote, so each is rejected and regenerated
+	db.config.PasswordPolicy = &passwordPolicy{Length: 8, MinSpecial: 1, SpecialChars: "'"}
+
+	if _, err := db.generatePassword(context.Background()); err == nil {
+		t.Fatal("expected error when no candidate meets DB2's constraints")
+	}
+}
+
+func TestGeneratePassword_ContextCanceled(t *testing.T) {
+	db := newDB2()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.generatePassword(ctx); err != context.Canceled {
+		t.Fatalf("expected context canceled, got: %v", err)
+	}
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	tests := map[string]struct {
+		policy  passwordPolicy
+		wantErr bool
+	}{
+		"defaults":          {policy: passwordPolicy{}},
+		"too short":         {policy: passwordPolicy{Length: 4}, wantErr: true},
+		"too long":          {policy: passwordPolicy{Length: 101}, wantErr: true},
+		"negative minimum":  {policy: passwordPolicy{MinDigits: -1}, wantErr: true},
+		"minimums exceed":   {policy: passwordPolicy{Length: 8, MinUppercase: 5, MinDigits: 5}, wantErr: true},
+		"quote in specials": {policy: passwordPolicy{SpecialChars: "#'"}, wantErr: true},
+		"semicolon":         {policy: passwordPolicy{SpecialChars: ";"}, wantErr: true},
+		"valid specials":    {policy: passwordPolicy{MinSpecial: 1, SpecialChars: "#$@"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.policy.validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_DefaultSpecialChars(t *testing.T) {
+	policy := passwordPolicy{MinSpecial: 1}
+	if err := policy.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if policy.Length != defaultPasswordLength {
+		t.Errorf("expected default length %d, got %d", defaultPasswordLength, policy.Length)
+	}
+	if policy.SpecialChars != specialChars {
+		t.Errorf("expected default special characters, got %q", policy.SpecialChars)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := map[string]bool{
+		"Abcdef12":                 true,
+		"short1":                   false,
+		strings.Repeat("a", 101):   false,
+		"has'quote1":               false,
+		`has"quote1`:               false,
+		"semi;colon1":              false,
+		"brace{d}12":               false,
+		"with space1":              false,
+		"Symbols#$@-_!1":           true,
+		strings.Repeat("Ab1#", 25): true,
+	}
+
+	for password, valid := range tests {
+		err := validatePassword(password)
+		if valid && err != nil {
+			t.Errorf("expected %q to be valid, got: %v", password, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %q to be rejected", password)
+		}
+	}
+}
+
+func TestRotateRootCredentials_PasswordPolicy(t *testing.T) {
+	db, _ := newTestDB2(t, map[string]interface{}{
+		"platform": "zos",
+		"password_policy": map[string]interface{}{
+			"length":     10,
+			"min_digits": 2,
+		},
+	})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+
+	password := newConf["password"].(string)
+	if len(password) != 10 {
+		t.Errorf("expected a 10 character password, got %q", password)
+	}
+	if strings.Trim(password, upperChars+lowerChars+digitChars) != "" {
+		t.Errorf("expected an alphanumeric password, got %q", password)
+	}
+}
+
+func TestRotateRootCredentials_MaxPasswordLength(t *testing.T) {
+	db, _ := newTestDB2(t, map[string]interface{}{"platform": "zos", "max_password_length": 8})
+
+	newConf, err := db.RotateRootCredentials(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error rotating root credentials: %v", err)
+	}
+
+	if password := newConf["password"].(string); len(password) != 8 {
+		t.Errorf("expected an 8 character password, got %q", password)
+	}
+}
+
+func countChars(s, chars string) int {
+	n := 0
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			n++
+		}
+	}
+	return n
+}
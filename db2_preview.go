@@ -0,0 +1,123 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+// previewPassword stands in for the new password in PreviewStatements
+const previewPassword = "[REDACTED]"
+
+// PreviewStatements returns the SQL UpdateUser would run for req, in order,
+// without running it, for change review. The statements are chosen as by
+// UpdateUser and rendered with the new password replaced by [REDACTED]; the
+// password in req is never used. With use_bind_params the statements are
+// shown with their ? markers. A transaction_isolation is shown as the SET
+// CURRENT ISOLATION statements UpdateUser runs when the driver cannot take it
+// from BeginTx, as go_ibm_db cannot. Nothing is run on the server; a pooled
+// connection is only taken to check what its driver supports.
+func (d *db2DB) PreviewStatements(ctx context.Context, req dbplugin.UpdateUserRequest) ([]string, error) {
+	if !d.initialized() {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	if err := d.beginOperation(); err != nil {
+		return nil, err
+	}
+	defer d.endOperation()
+
+	username := req.Username
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if err := validateIdentifier(username); err != nil {
+		return nil, err
+	}
+	if d.config.AuthType == authTypeKerberos {
+		return nil, fmt.Errorf("password rotation %w in kerberos mode", ErrOperationNotSupported)
+	}
+
+	var statements []string
+	if req.Password != nil {
+		statements = req.Password.Statements.Commands
+	}
+	if len(statements) == 0 {
+		statements = d.config.ChangePasswordStatements
+	}
+
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statements, err = d.passwordStatements(d.config, username, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	setIsolation, err := d.previewSetsIsolation(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var preview []string
+	asUser := d.config.TrustedContext != ""
+	if asUser {
+		preview = append(preview, dbutil.QueryHelper(d.config.quoteIdentifiers(setSessionUserStatement), map[string]string{"username": username}))
+	}
+	if d.config.LockTimeout > 0 {
+		preview = append(preview, d.config.lockTimeoutStatement())
+	}
+	if setIsolation {
+		preview = append(preview, "SET CURRENT ISOLATION = "+d.config.TransactionIsolation)
+	}
+	if d.config.CurrentSchema != "" {
+		preview = append(preview, "SET CURRENT SCHEMA "+d.config.CurrentSchema)
+	}
+
+	if len(statements) == 0 {
+		preview = append(preview, procedureCall(d.config.ChangePasswordProcedure, len(d.config.ChangePasswordProcedureArgs)))
+	} else {
+		queries, _ := d.config.renderPasswordStatements(username, previewPassword, statements)
+		preview = append(preview, queries...)
+	}
+
+	for _, stmt := range d.config.RotationPostStatements {
+		preview = append(preview, dbutil.QueryHelper(stmt, map[string]string{"username": username}))
+	}
+	if setIsolation {
+		preview = append(preview, resetIsolationStatement)
+	}
+	if d.config.LockTimeout > 0 {
+		preview = append(preview, resetLockTimeoutStatement)
+	}
+	if asUser {
+		preview = append(preview, resetSessionUserStatement)
+	}
+
+	return preview, nil
+}
+
+// previewSetsIsolation reports whether UpdateUser would set the
+// transaction_isolation with SET CURRENT ISOLATION on a connection from db
+// rather than pass it to BeginTx
+func (d *db2DB) previewSetsIsolation(ctx context.Context, db *sql.DB) (bool, error) {
+	if d.config.TransactionIsolation == "" {
+		return false, nil
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	return !supportsTxOptions(conn), nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+func TestPreviewStatements(t *testing.T) {
+	password := "S3cret'Passw0rd"
+
+	tests := map[string]struct {
+		conf       map[string]interface{}
+		statements []string
+		expected   []string
+	}{
+		"default statement": {
+			conf:     map[string]interface{}{"platform": "zos"},
+			expected: []string{`ALTER USER "appuser" PASSWORD '[REDACTED]'`},
+		},
+		"request statements": {
+			conf:       map[string]interface{}{"platform": "zos", "change_password_statements": []interface{}{`ALTER USER "{{username}}" PASSWORD '{{password}}' ACCOUNT UNLOCK`}},
+			statements: []string{`ALTER USER "{{username}}" PASSWORD '{{password_quoted}}'`, `GRANT CONNECT ON DATABASE TO USER "{{username}}"`},
+			expected: []string{
+				`ALTER USER "appuser" PASSWORD '[REDACTED]'`,
+				`GRANT CONNECT ON DATABASE TO USER "appuser"`,
+			},
+		},
+		"configured statements": {
+			conf:     map[string]interface{}{"change_password_statements": []interface{}{`ALTER USER "{{username}}" PASSWORD '{{password}}' ACCOUNT UNLOCK`}},
+			expected: []string{`ALTER USER "appuser" PASSWORD '[REDACTED]' ACCOUNT UNLOCK`},
+		},
+		"session and post statements": {
+			conf: map[string]interface{}{
+				"platform":                 "zos",
+				"trusted_context":          "vault_ctx",
+				"current_schema":           "app",
+				"rotation_post_statements": []interface{}{`GRANT SELECT ON TABLE APP.ORDERS TO USER "{{username}}"`},
+			},
+			expected: []string{
+				`SET SESSION AUTHORIZATION "appuser"`,
+				"SET CURRENT SCHEMA APP",
+				`ALTER USER "appuser" PASSWORD '[REDACTED]'`,
+				`GRANT SELECT ON TABLE APP.ORDERS TO USER "appuser"`,
+				"SET SESSION AUTHORIZATION SYSTEM_USER",
+			},
+		},
+		"lock timeout": {
+			conf:     map[string]interface{}{"platform": "zos", "lock_timeout": "5s", "current_schema": "app"},
+			expected: []string{"SET CURRENT LOCK TIMEOUT 5", "SET CURRENT SCHEMA APP", `ALTER USER "appuser" PASSWORD '[REDACTED]'`, "SET CURRENT LOCK TIMEOUT NULL"},
+		},
+		"transaction isolation": {
+			conf: map[string]interface{}{"platform": "zos", "lock_timeout": "5s", "transaction_isolation": "rs"},
+			expected: []string{
+				"SET CURRENT LOCK TIMEOUT 5",
+				"SET CURRENT ISOLATION = RS",
+				`ALTER USER "appuser" PASSWORD '[REDACTED]'`,
+				"SET CURRENT ISOLATION = RESET",
+				"SET CURRENT LOCK TIMEOUT NULL",
+			},
+		},
+		"bind params": {
+			conf:     map[string]interface{}{"use_bind_params": true, "change_password_statements": []interface{}{"CALL APP.SET_PASSWORD({{username}}, {{password}})"}},
+			expected: []string{"CALL APP.SET_PASSWORD(?, ?)"},
+		},
+		"procedure": {
+			conf:     map[string]interface{}{"change_password_procedure": "vault.change_password"},
+			expected: []string{"CALL VAULT.CHANGE_PASSWORD(?, ?, ?)"},
+		},
+		"procedure with arguments": {
+			conf:     map[string]interface{}{"change_password_procedure": "vault.change_password", "change_password_procedure_args": []interface{}{"STRICT"}},
+			expected: []string{"CALL VAULT.CHANGE_PASSWORD(?, ?, ?, ?)"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, tc.conf)
+
+			preview, err := db.PreviewStatements(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{
+					NewPassword: password,
+					Statements:  dbplugin.Statements{Commands: tc.statements},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(preview, tc.expected) {
+				t.Errorf("expected statements %v, got: %v", tc.expected, preview)
+			}
+			for _, stmt := range preview {
+				if strings.Contains(stmt, "S3cret") {
+					t.Errorf("expected the password to be redacted, got %q", stmt)
+				}
+			}
+			if got := srv.statements(); len(got) != 0 {
+				t.Errorf("expected nothing to run, got: %v", got)
+			}
+			if got := srv.boundArgs(); len(got) != 0 {
+				t.Errorf("expected nothing to be bound, got: %v", got)
+			}
+		})
+	}
+}
+
+func TestPreviewStatements_TransactionIsolationBeginTx(t *testing.T) {
+	db, _ := newTxTestDB2(t, map[string]interface{}{"platform": "zos", "transaction_isolation": "RS"})
+
+	preview, err := db.PreviewStatements(context.Background(), dbplugin.UpdateUserRequest{Username: "appuser"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The level is passed to BeginTx, so no statement sets it
+	expected := []string{`ALTER USER "appuser" PASSWORD '[REDACTED]'`}
+	if !reflect.DeepEqual(preview, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, preview)
+	}
+}
+
+func TestPreviewStatements_NoDefaultStatement(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.1.4.7"})
+
+	_, err := db.PreviewStatements(context.Background(), dbplugin.UpdateUserRequest{Username: "appuser"})
+	if !errors.Is(err, dbutil.ErrEmptyRotationStatement) {
+		t.Errorf("expected ErrEmptyRotationStatement, got: %v", err)
+	}
+}
+
+func TestPreviewStatements_Invalid(t *testing.T) {
+	if _, err := newDB2().PreviewStatements(context.Background(), dbplugin.UpdateUserRequest{Username: "appuser"}); !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got: %v", err)
+	}
+
+	db, _ := newTestDB2(t, nil)
+	for _, username := range []string{"", `app"user`} {
+		if _, err := db.PreviewStatements(context.Background(), dbplugin.UpdateUserRequest{Username: username}); err == nil {
+			t.Errorf("expected username %q to be rejected", username)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"time"
+)
+
+// credentialFiles returns the files reload_on_change watches
+func (c db2Config) credentialFiles() []string {
+	var paths []string
+	for _, path := range []string{c.ConnectionURLFile, c.PasswordFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// fileSum returns the SHA-256 of the contents of the file at path
+func fileSum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// startReloadWatcher reads paths every interval and calls Reset when the
+// contents of any of them change, so the next connection uses the new
+// credentials. The contents are compared rather than the modification time,
+// which a secret mount replacing the file through a symlink need not change.
+// It runs until stopReloadWatcher is called.
+func (d *db2DB) startReloadWatcher(paths []string, interval time.Duration) {
+	sums := make([][sha256.Size]byte, len(paths))
+	for i, path := range paths {
+		// A file that cannot be read yet is reloaded once it can
+		sums[i], _ = fileSum(path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.reloadCancel, d.reloadDone = cancel, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			var changed []string
+			for i, path := range paths {
+				sum, err := fileSum(path)
+				if err != nil {
+					// The file may be between being removed and replaced
+					d.log().Debug("failed to read credential file", "path", path, "error", err.Error())
+					continue
+				}
+				if sum != sums[i] {
+					sums[i] = sum
+					changed = append(changed, path)
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+
+			d.log().Info("credential file changed, resetting the connection pool", "paths", changed)
+			if err := d.Reset(ctx); err != nil && ctx.Err() == nil && !errors.Is(err, errClosing) {
+				d.log().Warn("failed to reload credentials", "error", d.sanitize(err).Error())
+			}
+		}
+	}()
+}
+
+// stopReloadWatcher stops the reload_on_change watcher, if running, and
+// waits for it to exit
+func (d *db2DB) stopReloadWatcher() {
+	if d.reloadCancel == nil {
+		return
+	}
+
+	d.reloadCancel()
+	<-d.reloadDone
+	d.reloadCancel, d.reloadDone = nil, nil
+}
@@ -0,0 +1,246 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// connectedWith reports whether any connection to srv used password
+func connectedWith(srv *fakeServer, password string) bool {
+	for _, dsn := range srv.connections() {
+		if pwd, _ := parseConnectionString(dsn).get("PWD"); pwd == password {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInitialize_PasswordFile(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.setPassword("admin", "filepass")
+	path := filepath.Join(t.TempDir(), "password")
+	writeFile(t, path, "filepass\n")
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	resp, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password_file":  path,
+		},
+		VerifyConnection: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := resp.Config["password"]; ok {
+		t.Error("expected the password read from the file not to be returned in the config")
+	}
+	if _, ok := db.secretValues()["filepass"]; !ok {
+		t.Error("expected the password to be in secret values")
+	}
+
+	// Reset picks up a rewritten file
+	srv.setPassword("admin", "newpass")
+	writeFile(t, path, "newpass")
+	if err := db.Reset(context.Background()); err != nil {
+		t.Fatalf("unexpected error resetting: %v", err)
+	}
+	if !connectedWith(srv, "newpass") {
+		t.Error("expected Reset to connect with the rewritten password")
+	}
+	if _, ok := db.secretValues()["newpass"]; !ok {
+		t.Error("expected the reloaded password to be in secret values")
+	}
+
+	// Vault cannot store a rotated password in the file
+	_, err = db.RotateRootCredentials(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "update the file instead") {
+		t.Errorf("expected root rotation to be rejected, got: %v", err)
+	}
+}
+
+func TestParseConfig_PasswordFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	writeFile(t, path, " pass word \r\n")
+	empty := filepath.Join(dir, "empty")
+	writeFile(t, empty, "\n")
+
+	config, err := parseConfig(map[string]interface{}{"password_file": path, "reload_on_change": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Password != " pass word " {
+		t.Errorf("expected only the trailing newline to be removed, got %q", config.Password)
+	}
+	if config.ReloadInterval != defaultReloadInterval {
+		t.Errorf("expected the default reload_interval, got %s", config.ReloadInterval)
+	}
+
+	tests := map[string]struct {
+		conf     map[string]interface{}
+		expected string
+	}{
+		"both set": {
+			conf:     map[string]interface{}{"password": "adminpass", "password_file": path},
+			expected: "password and password_file cannot both be set",
+		},
+		"missing file": {
+			conf:     map[string]interface{}{"password_file": filepath.Join(dir, "missing")},
+			expected: "failed to read password_file",
+		},
+		"empty file": {
+			conf:     map[string]interface{}{"password_file": empty},
+			expected: "is empty",
+		},
+		"nothing to watch": {
+			conf:     map[string]interface{}{"password": "adminpass", "reload_on_change": true},
+			expected: "reload_on_change requires connection_url_file or password_file",
+		},
+		"negative interval": {
+			conf:     map[string]interface{}{"password_file": path, "reload_interval": "-1s"},
+			expected: "reload_interval cannot be negative",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig(tc.conf)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected error containing %q, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.setPassword("admin", "first")
+	path := filepath.Join(t.TempDir(), "password")
+	writeFile(t, path, "first")
+
+	conf := map[string]interface{}{
+		"connection_url":   url,
+		"username":         "admin",
+		"password_file":    path,
+		"platform":         "zos",
+		"reload_on_change": true,
+		"reload_interval":  "10ms",
+	}
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf}); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The admin password changes outside Vault, then in the file
+	srv.setPassword("admin", "second")
+	writeFile(t, path, "second")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !connectedWith(srv, "second") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pool to reconnect with the rewritten password")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := db.UpdateUser(context.Background(), req); err != nil {
+		t.Fatalf("expected the reloaded password to be used, got: %v", err)
+	}
+
+	t.Run("stopped by Initialize", func(t *testing.T) {
+		plain := map[string]interface{}{}
+		for k, v := range conf {
+			plain[k] = v
+		}
+		plain["reload_on_change"] = false
+		if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: plain}); err != nil {
+			t.Fatalf("failed to re-initialize: %v", err)
+		}
+		if db.reloadCancel != nil {
+			t.Error("expected the watcher to be stopped")
+		}
+	})
+
+	t.Run("stopped by Close", func(t *testing.T) {
+		if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf}); err != nil {
+			t.Fatalf("failed to re-initialize: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+		if db.reloadCancel != nil {
+			t.Fatal("expected the watcher to be stopped")
+		}
+
+		writeFile(t, path, "third")
+		time.Sleep(50 * time.Millisecond)
+		if connectedWith(srv, "third") {
+			t.Error("expected no reload after Close")
+		}
+	})
+}
+
+func TestReloadOnChange_ConnectionURLFile(t *testing.T) {
+	srv, url := newFakeServer(t)
+	path := filepath.Join(t.TempDir(), "connection_url")
+	writeFile(t, path, url+";PWD=adminpass\n")
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url_file": path,
+			"username":            "admin",
+			"reload_on_change":    true,
+			"reload_interval":     "10ms",
+		},
+		VerifyConnection: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	writeFile(t, path, url+";PWD=rotated\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for !connectedWith(srv, "rotated") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pool to reconnect with the rewritten connection_url")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := db.secretValues()["rotated"]; !ok {
+		t.Error("expected the reloaded password to be in secret values")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+// errPasswordReturnDisabled is returned by RotatePassword unless
+// allow_password_return is set
+var errPasswordReturnDisabled = errors.New("returning rotated passwords is disabled; set allow_password_return to enable it")
+
+// RotatePassword generates a new password, following the password_policy if
+// one is configured, changes username's password to it as UpdateUser would,
+// and returns it, for flows that hand the credential to another system.
+// Since the plaintext leaves the plugin, it requires allow_password_return.
+// statements and selfManagedPassword are used as in an UpdateUserRequest.
+func (d *db2DB) RotatePassword(ctx context.Context, username string, statements []string, selfManagedPassword string) (string, error) {
+	if !d.initialized() {
+		return "", connutil.ErrNotInitialized
+	}
+
+	d.initLock.RLock()
+	if !d.config.AllowPasswordReturn {
+		d.initLock.RUnlock()
+		return "", errPasswordReturnDisabled
+	}
+	password, err := d.generatePassword(ctx)
+	d.initLock.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = d.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+		Username: username,
+		Password: &dbplugin.ChangePassword{
+			NewPassword: password,
+			Statements:  dbplugin.Statements{Commands: statements},
+		},
+		SelfManagedPassword: selfManagedPassword,
+	})
+	if err != nil {
+		return "", d.sanitize(err)
+	}
+
+	return password, nil
+}
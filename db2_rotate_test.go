@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+func TestRotatePassword(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{
+		"platform":              "zos",
+		"allow_password_return": true,
+		"password_policy":       map[string]interface{}{"length": 20, "min_digits": 2},
+	})
+
+	password, err := db.RotatePassword(context.Background(), "appuser", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(password) != 20 {
+		t.Errorf("expected a password following the policy, got %q", password)
+	}
+
+	// The returned password is the one applied
+	expected := []string{`ALTER USER "appuser" PASSWORD '` + password + `'`}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+
+	again, err := db.RotatePassword(context.Background(), "appuser", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again == password {
+		t.Error("expected a new password on each rotation")
+	}
+}
+
+func TestRotatePassword_Statements(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"allow_password_return": true})
+
+	password, err := db.RotatePassword(context.Background(), "appuser", []string{`CALL APP.SET_PASSWORD('{{username}}', '{{password_escaped}}')`}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{`CALL APP.SET_PASSWORD('appuser', '` + password + `')`}
+	if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected statements %v, got: %v", expected, got)
+	}
+}
+
+func TestRotatePassword_Failure(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "allow_password_return": true})
+	srv.failOn("ALTER USER", errors.New("SQL30082N  Security processing failed for user admin with password adminpass.  SQLSTATE=08001"))
+
+	password, err := db.RotatePassword(context.Background(), "appuser", nil, "")
+	if err == nil || password != "" {
+		t.Fatalf("expected an error and no password, got %q, %v", password, err)
+	}
+	if strings.Contains(err.Error(), "adminpass") {
+		t.Errorf("expected a sanitized error, got: %v", err)
+	}
+}
+
+func TestRotatePassword_Disabled(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+
+	if _, err := db.RotatePassword(context.Background(), "appuser", nil, ""); !errors.Is(err, errPasswordReturnDisabled) {
+		t.Fatalf("expected the opt-in to be required, got: %v", err)
+	}
+	if got := srv.statements(); len(got) != 0 {
+		t.Errorf("expected no statements to run, got: %v", got)
+	}
+}
+
+func TestRotatePassword_NotInitialized(t *testing.T) {
+	if _, err := newDB2().RotatePassword(context.Background(), "appuser", nil, ""); !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+// SelfTestResult reports the checks run by SelfTest. Checks that depend on
+// the connection are reported as failed when it could not be opened.
+type SelfTestResult struct {
+	// Connected reports whether a connection to the server was opened
+	Connected bool
+
+	// PingOK reports whether the ping_query succeeded
+	PingOK bool
+
+	// ServerVersion is the server's version string, empty if it could not be
+	// read
+	ServerVersion string
+
+	// Statement is the default password change statement for this config,
+	// empty if there is none, e.g. on DB2 LUW or in kerberos mode. StatementPrepares reports whether it prepared.
+	Statement         string
+	StatementPrepares bool
+
+	// Errors describes each failed check, with secret values removed
+	Errors []string
+}
+
+// OK reports whether every check passed
+func (r SelfTestResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// SelfTest validates the config end to end: it connects, runs the
+// ping_query, reads the server version and prepares the default password
+// change statement, without executing it or changing any credentials. Failed
+// checks are reported in the result; the error is for a plugin that cannot
+// run them at all.
+func (d *db2DB) SelfTest(ctx context.Context) (SelfTestResult, error) {
+	if !d.initialized() {
+		return SelfTestResult{}, connutil.ErrNotInitialized
+	}
+
+	if err := d.beginOperation(); err != nil {
+		return SelfTestResult{}, err
+	}
+	defer d.endOperation()
+
+	var result SelfTestResult
+	fail := func(check string, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", check, d.sanitize(err)))
+	}
+
+	db, err := d.getConnection(ctx)
+	if err == nil {
+		err = db.PingContext(ctx)
+	}
+	if err != nil {
+		fail("connect", connectError(describeError(err), d.config.ConnectTimeout))
+		return result, nil
+	}
+	result.Connected = true
+
+	if err := d.verifyConnection(ctx); err != nil {
+		fail("ping", err)
+	} else {
+		result.PingOK = true
+	}
+
+	if result.ServerVersion, err = d.serverVersion(ctx, d.config, db); err != nil {
+		fail("server version", err)
+	}
+
+	if d.config.AuthType == authTypeKerberos {
+		return result, nil
+	}
+	stmt, ok := d.defaultPasswordStatement(d.config)
+	if !ok {
+		return result, nil
+	}
+	result.Statement = stmt
+
+	if err := d.ValidateStatements(ctx, []string{stmt}); err != nil {
+		fail("default password change statement", err)
+	} else {
+		result.StatementPrepares = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+func TestSelfTest(t *testing.T) {
+	statement := `ALTER USER "vault_validate" PASSWORD 'Validate-Passw0rd'`
+
+	tests := map[string]struct {
+		setup       func(srv *fakeServer)
+		pingOK      bool
+		version     string
+		prepares    bool
+		errContains string
+	}{
+		"healthy": {
+			pingOK:   true,
+			version:  "DSN12015",
+			prepares: true,
+		},
+		"ping fails": {
+			setup: func(srv *fakeServer) {
+				srv.failOn(pingQuery, errors.New("SQL30081N  A communication error has been detected.  SQLSTATE=08001"))
+			},
+			version:     "DSN12015",
+			prepares:    true,
+			errContains: "ping: ping query failed: SQLCODE=-30081",
+		},
+		"version unavailable": {
+			setup: func(srv *fakeServer) {
+				srv.failOn("SYSIBM.VERSION", errors.New("SQL0204N  SQLSTATE=42704"))
+			},
+			pingOK:      true,
+			prepares:    true,
+			errContains: "server version: failed to query server version",
+		},
+		"statement fails to prepare": {
+			setup: func(srv *fakeServer) {
+				srv.failPrepareOn("ALTER USER", errors.New(`SQL0104N  An unexpected token "PASSWORD" was found.  SQLSTATE=42601`))
+			},
+			pingOK:      true,
+			version:     "DSN12015",
+			errContains: "default password change statement: statement 1 failed to prepare: SQLCODE=-104",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos"})
+			srv.respond("SYSIBM.VERSION", []driver.Value{"DSN12015"})
+			if tc.setup != nil {
+				tc.setup(srv)
+			}
+
+			result, err := db.SelfTest(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !result.Connected || result.PingOK != tc.pingOK || result.ServerVersion != tc.version || result.StatementPrepares != tc.prepares {
+				t.Errorf("unexpected result: %+v", result)
+			}
+			if result.Statement != `ALTER USER "{{username}}" PASSWORD '{{password_escaped}}'` {
+				t.Errorf("expected the default statement, got %q", result.Statement)
+			}
+			if tc.errContains == "" {
+				if !result.OK() {
+					t.Errorf("expected no errors, got: %v", result.Errors)
+				}
+			} else if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], tc.errContains) {
+				t.Errorf("expected an error containing %q, got: %v", tc.errContains, result.Errors)
+			}
+
+			// Nothing is executed against the server
+			if got := srv.statements(); len(got) != 0 {
+				t.Errorf("expected no statements to run, got: %v", got)
+			}
+			for _, query := range srv.queryLog() {
+				if strings.Contains(query, statement) {
+					t.Errorf("expected the statement only to be prepared, got query %q", query)
+				}
+			}
+		})
+	}
+}
+
+func TestSelfTest_NoDefaultStatement(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.1.4.7"})
+
+	result, err := db.SelfTest(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Roles must supply statements on DB2 LUW, which is not a failure of the
+	// config
+	if !result.OK() || result.Statement != "" || result.StatementPrepares {
+		t.Errorf("expected no default statement and no errors, got: %+v", result)
+	}
+}
+
+func TestSelfTest_ConnectFailure(t *testing.T) {
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: map[string]interface{}{
+		"connection_url": "DATABASE=MISSING;HOSTNAME=localhost;PORT=50000",
+		"username":       "admin",
+		"password":       "adminpass",
+	}})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	result, err := db.SelfTest(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Connected || result.PingOK || result.OK() {
+		t.Errorf("expected the connection check to fail, got: %+v", result)
+	}
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0], "connect: ") {
+		t.Errorf("expected a single connect error, got: %v", result.Errors)
+	}
+	if strings.Contains(strings.Join(result.Errors, " "), "adminpass") {
+		t.Errorf("expected errors to be sanitized, got: %v", result.Errors)
+	}
+}
+
+func TestSelfTest_NotInitialized(t *testing.T) {
+	if _, err := newDB2().SelfTest(context.Background()); !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// sessionDriverName is the database/sql driver that runs the init_sql on
+	// each connection it opens through the driver the plugin would otherwise
+	// use
+	sessionDriverName = "db2-session"
+
+	// sessionKeyword is added to the connection string to name the init_sql
+	// of the plugin instance, and removed before the connection string
+	// reaches the DB2 driver. Multiplexed instances share the process, so
+	// the script cannot be looked up by connection string alone.
+	sessionKeyword = "VaultSession"
+)
+
+func init() {
+	sql.Register(sessionDriverName, sessionDriver{})
+}
+
+// sessionScript is the init_sql of one plugin instance and the driver its
+// connections are opened with
+type sessionScript struct {
+	driverName string
+	statements []string
+}
+
+var (
+	sessionsLock sync.Mutex
+	sessions     = map[string]sessionScript{}
+
+	lastSessionID atomic.Int64
+)
+
+// registerSession routes new connections through the session driver, which
+// runs statements on each, or, with no statements, back to the driver they
+// were opened with before. Existing connections keep their session state,
+// so the pool must be closed first.
+func (d *db2DB) registerSession(statements []string) {
+	d.Lock()
+	defer d.Unlock()
+
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	driverName := d.db2ConnectionProducer.Type
+	if driverName == sessionDriverName {
+		driverName = sessions[d.sessionID].driverName
+	}
+
+	if len(statements) == 0 {
+		delete(sessions, d.sessionID)
+		d.db2ConnectionProducer.Type = driverName
+		return
+	}
+
+	if d.sessionID == "" {
+		d.sessionID = strconv.FormatInt(lastSessionID.Add(1), 10)
+	}
+	sessions[d.sessionID] = sessionScript{driverName: driverName, statements: statements}
+	d.db2ConnectionProducer.Type = sessionDriverName
+}
+
+// sessionDriver opens connections with the driver registered for the
+// connection string's sessionKeyword and runs its init_sql on each
+type sessionDriver struct{}
+
+func (sessionDriver) Open(dsn string) (driver.Conn, error) {
+	cs := parseConnectionString(dsn)
+	id, _ := cs.get(sessionKeyword)
+	cs.delete(sessionKeyword)
+
+	sessionsLock.Lock()
+	script, ok := sessions[id]
+	sessionsLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no init_sql is registered for the connection")
+	}
+
+	drv, err := lookupDriver(script.driverName)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := drv.Open(cs.String())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, stmt := range script.statements {
+		if err := execConn(conn, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init_sql statement %d failed: %w", i+1, describeError(err))
+		}
+	}
+	return conn, nil
+}
+
+// lookupDriver returns the database/sql driver registered as name
+func lookupDriver(name string) (driver.Driver, error) {
+	db, err := sql.Open(name, "")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.Driver(), nil
+}
+
+// execConn runs query on a driver connection before database/sql manages it
+func execConn(conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(context.Background(), query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if execer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = execer.ExecContext(context.Background(), nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
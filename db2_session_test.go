@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestInitSQL(t *testing.T) {
+	initSQL := []interface{}{"SET CURRENT DEGREE = 'ANY'", "SET CURRENT ISOLATION = CS"}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("runs on a fresh connection", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "init_sql": initSQL})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{"SET CURRENT DEGREE = 'ANY'", "SET CURRENT ISOLATION = CS", `ALTER USER "appuser" PASSWORD 'newpassword'`}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+
+		// The pooled connection is reused without running them again
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := srv.countStatements("SET CURRENT DEGREE"); n != 1 {
+			t.Errorf("expected init_sql to run once, got %d", n)
+		}
+
+		for _, dsn := range srv.connections() {
+			if strings.Contains(dsn, sessionKeyword) {
+				t.Errorf("expected %s to be removed before connecting, got %q", sessionKeyword, dsn)
+			}
+		}
+	})
+
+	t.Run("runs on each new connection", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "init_sql": initSQL, "max_concurrent_rotations": 3})
+		srv.delayOn("ALTER USER", 20*time.Millisecond)
+
+		if _, err := db.BulkUpdatePasswords(context.Background(), bulkRequests("u1", "u2", "u3")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		conns := len(srv.connections())
+		if conns < 2 {
+			t.Fatalf("expected several connections, got %d", conns)
+		}
+		if n := srv.countStatements("SET CURRENT DEGREE"); n != conns {
+			t.Errorf("expected init_sql to run on each of %d connections, got %d", conns, n)
+		}
+	})
+
+	t.Run("failure fails the connection", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "init_sql": initSQL})
+		srv.failOn("SET CURRENT ISOLATION", errors.New("SQL0104N  An unexpected token \"CS\" was found.  SQLSTATE=42601"))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "init_sql statement 2 failed: SQLCODE=-104") {
+			t.Fatalf("expected the init_sql failure, got: %v", err)
+		}
+		for _, stmt := range srv.statements() {
+			if strings.Contains(stmt, "ALTER USER") {
+				t.Errorf("expected no password change, got %q", stmt)
+			}
+		}
+	})
+
+	t.Run("removed by Initialize without it", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "init_sql": initSQL})
+
+		conf := map[string]interface{}{}
+		for k, v := range db.RawConfig {
+			conf[k] = v
+		}
+		delete(conf, "init_sql")
+		if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: conf}); err != nil {
+			t.Fatalf("failed to initialize: %v", err)
+		}
+		if db.db2ConnectionProducer.Type != fakeDriverName || strings.Contains(db.ConnectionURL, sessionKeyword) {
+			t.Fatalf("expected connections to be opened directly, got %s with %q", db.db2ConnectionProducer.Type, db.ConnectionURL)
+		}
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := srv.countStatements("SET CURRENT"); n != 0 {
+			t.Errorf("expected no init_sql, got %d statements", n)
+		}
+	})
+
+	t.Run("unregistered on Close", func(t *testing.T) {
+		db, _ := newTestDB2(t, map[string]interface{}{"init_sql": initSQL})
+		id := db.sessionID
+
+		if err := db.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+		sessionsLock.Lock()
+		_, ok := sessions[id]
+		sessionsLock.Unlock()
+		if ok || db.db2ConnectionProducer.Type != fakeDriverName {
+			t.Errorf("expected the init_sql to be unregistered, got driver %s", db.db2ConnectionProducer.Type)
+		}
+	})
+}
+
+func TestParseConfig_InitSQL(t *testing.T) {
+	if _, err := parseConfig(map[string]interface{}{"init_sql": []interface{}{"SET CURRENT DEGREE = 'ANY'", "set current query optimization = 5"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		stmt    string
+		wantErr string
+	}{
+		"not a SET":         {stmt: "SELECT 1 FROM SYSIBM.SYSDUMMY1", wantErr: "must be a single SET statement"},
+		"DDL":               {stmt: "CREATE TABLE T (C INT)", wantErr: "must be a single SET statement"},
+		"several":           {stmt: "SET CURRENT DEGREE = 'ANY'; DROP TABLE T", wantErr: "must be a single SET statement"},
+		"DDL in SET":        {stmt: "SET CURRENT DEGREE = (SELECT 'ANY' FROM T) GRANT", wantErr: "cannot contain GRANT"},
+		"session user":      {stmt: `SET SESSION AUTHORIZATION "APPUSER"`, wantErr: "cannot switch the session user"},
+		"session user name": {stmt: "SET SESSION_USER = APPUSER", wantErr: "cannot switch the session user"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig(map[string]interface{}{"init_sql": []interface{}{"SET CURRENT DEGREE = 'ANY'", tc.stmt}})
+			if err == nil || !strings.Contains(err.Error(), "init_sql statement 2 "+tc.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+// trustedContextQueries return whether the named trusted context is enabled,
+// 'Y' or 'N', per platform
+var trustedContextQueries = map[string]string{
+	platformLUW: "SELECT ENABLED FROM SYSCAT.CONTEXTS WHERE CONTEXTNAME = ?",
+	platformZOS: "SELECT ENABLED FROM SYSIBM.SYSCONTEXT WHERE NAME = ?",
+}
+
+const (
+	setSessionUserStatement   = `SET SESSION AUTHORIZATION "{{username}}"`
+	resetSessionUserStatement = "SET SESSION AUTHORIZATION SYSTEM_USER"
+)
+
+// checkTrustedContext checks that the configured trusted_context exists and
+// is enabled, so a misconfigured one is reported at Initialize rather than by
+// the first rotation
+func (d *db2DB) checkTrustedContext(ctx context.Context) error {
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	var enabled string
+	err = db.QueryRowContext(ctx, trustedContextQueries[d.config.Platform], d.config.TrustedContext).Scan(&enabled)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("trusted context %s does not exist", d.config.TrustedContext)
+	case err != nil:
+		return fmt.Errorf("failed to look up trusted context %s: %w", d.config.TrustedContext, describeError(err))
+	case enabled != "Y":
+		return fmt.Errorf("trusted context %s is disabled", d.config.TrustedContext)
+	}
+
+	return nil
+}
+
+// setSessionUser switches conn to act as username through the trusted
+// context
+func (d *db2DB) setSessionUser(ctx context.Context, config db2Config, conn *sql.Conn, username string) error {
+	query := dbutil.QueryHelper(config.quoteIdentifiers(setSessionUserStatement), map[string]string{"username": username})
+	if err := d.execStatement(ctx, config, conn, query); err != nil {
+		return fmt.Errorf("failed to switch to user %s through trusted context %s: %w", username, config.TrustedContext, describeError(err))
+	}
+	return nil
+}
+
+// resetSessionUser switches conn back to the admin user before it returns to
+// the pool. It runs even when ctx is done, and if it fails the connection is
+// discarded rather than reused as username.
+func (d *db2DB) resetSessionUser(config db2Config, conn *sql.Conn, username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := d.execStatement(ctx, config, conn, resetSessionUserStatement); err != nil {
+		d.log().Warn("failed to switch back from the rotated user, discarding the connection", "username", username, "error", d.sanitize(describeError(err)).Error())
+		discardConn(conn)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestUpdateUser_TrustedContext(t *testing.T) {
+	conf := map[string]interface{}{"platform": "zos", "trusted_context": "vault_ctx"}
+	req := dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	}
+
+	t.Run("switches to the user and back", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			`SET SESSION AUTHORIZATION "appuser"`,
+			`ALTER USER "appuser" PASSWORD 'newpassword'`,
+			"SET SESSION AUTHORIZATION SYSTEM_USER",
+		}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("switches back after a failure", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("ALTER USER", errors.New("SQL0551N  SQLSTATE=42501"))
+
+		if _, err := db.UpdateUser(context.Background(), req); err == nil {
+			t.Fatal("expected error when the password change fails")
+		}
+
+		expected := []string{`SET SESSION AUTHORIZATION "appuser"`, "SET SESSION AUTHORIZATION SYSTEM_USER"}
+		if got := srv.statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected statements %v, got: %v", expected, got)
+		}
+	})
+
+	t.Run("switch fails", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failOn("SET SESSION AUTHORIZATION \"", errors.New("SQL20361N  The switch user request using authorization ID \"appuser\" within trusted context \"VAULT_CTX\" failed with reason code \"1\".  SQLSTATE=42517"))
+
+		_, err := db.UpdateUser(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "failed to switch to user appuser through trusted context VAULT_CTX") {
+			t.Fatalf("expected switch error, got: %v", err)
+		}
+		if got := srv.statements(); len(got) != 0 {
+			t.Errorf("expected no statements to run, got: %v", got)
+		}
+	})
+
+	t.Run("discards the connection when switching back fails", func(t *testing.T) {
+		db, srv := newTestDB2(t, conf)
+		srv.failTimes("SYSTEM_USER", 1, errors.New("SQL30081N  SQLSTATE=08001"))
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("expected the committed password change to succeed, got: %v", err)
+		}
+		opened := len(srv.connections())
+
+		// The next rotation must not reuse the connection left as appuser
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := len(srv.connections()); got != opened+1 {
+			t.Errorf("expected a new connection, got %d connections after %d", got, opened)
+		}
+	})
+
+	t.Run("identifier_quoting none", func(t *testing.T) {
+		db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "trusted_context": "vault_ctx", "identifier_quoting": "none"})
+
+		if _, err := db.UpdateUser(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := srv.statements(); len(got) == 0 || got[0] != "SET SESSION AUTHORIZATION appuser" {
+			t.Errorf("expected an unquoted switch, got: %v", got)
+		}
+	})
+}
+
+func TestRotateRootCredentials_TrustedContext(t *testing.T) {
+	db, srv := newTestDB2(t, map[string]interface{}{"platform": "zos", "trusted_context": "vault_ctx"})
+
+	if _, err := db.RotateRootCredentials(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The admin changes its own password without switching users
+	for _, stmt := range srv.statements() {
+		if strings.Contains(stmt, "SESSION AUTHORIZATION") {
+			t.Errorf("expected no session switch, got %q", stmt)
+		}
+	}
+}
+
+func TestInitialize_TrustedContext(t *testing.T) {
+	tests := map[string]struct {
+		rows    [][]driver.Value
+		fail    error
+		wantErr string
+	}{
+		"enabled":  {rows: [][]driver.Value{{"Y"}}},
+		"disabled": {rows: [][]driver.Value{{"N"}}, wantErr: "trusted context VAULT_CTX is disabled"},
+		"missing":  {rows: [][]driver.Value{}, wantErr: "trusted context VAULT_CTX does not exist"},
+		"error":    {fail: errors.New("SQL0551N  SQLSTATE=42501"), wantErr: "failed to look up trusted context VAULT_CTX: SQLCODE=-551"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, url := newFakeServer(t)
+			srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.5.8.0"})
+			srv.respond("SYSCAT.CONTEXTS", tc.rows...)
+			if tc.fail != nil {
+				srv.failOn("SYSCAT.CONTEXTS", tc.fail)
+			}
+
+			db := newDB2()
+			db.db2ConnectionProducer.Type = fakeDriverName
+			defer db.Close()
+
+			_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+				Config: map[string]interface{}{
+					"connection_url":  url,
+					"username":        "admin",
+					"password":        "adminpass",
+					"trusted_context": "vault_ctx",
+				},
+				VerifyConnection: true,
+			})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_TrustedContext(t *testing.T) {
+	config, err := parseConfig(map[string]interface{}{"trusted_context": "vault_ctx"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.TrustedContext != "VAULT_CTX" {
+		t.Errorf("expected VAULT_CTX, got %q", config.TrustedContext)
+	}
+
+	invalid := []map[string]interface{}{
+		{"trusted_context": "vault ctx; DROP"},
+		{"trusted_context": "vault_ctx", "self_managed": true},
+	}
+	for _, conf := range invalid {
+		if _, err := parseConfig(conf); err == nil {
+			t.Errorf("expected %v to be rejected", conf)
+		}
+	}
+}
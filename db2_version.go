@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+)
+
+// serverVersionQueries return the server's version string per platform: the
+// service level on LUW (e.g. "DB2 v11.5.8.0") and the DSNvvrrm product
+// level on z/OS (e.g. "DSN12015")
+var serverVersionQueries = map[string]string{
+	platformLUW: "SELECT SERVICE_LEVEL FROM SYSIBMADM.ENV_INST_INFO",
+	platformZOS: "SELECT GETVARIABLE('SYSIBM.VERSION') FROM SYSIBM.SYSDUMMY1",
+}
+
+// defaultChangePasswordStatements holds the default password change
+// statement per platform. It does not depend on the server's version: DB2
+// for z/OS changes passwords with ALTER USER on every supported version, and
+// DB2 LUW has none on any version because its passwords are managed by the
+// operating system or a security plugin rather than through SQL.
+var defaultChangePasswordStatements = map[string]string{
+	platformZOS: `ALTER USER "{{username}}" PASSWORD '{{password_escaped}}'`,
+}
+
+// defaultChangePasswordStatement returns the default password change
+// statement for config's platform
+func (d *db2DB) defaultChangePasswordStatement(config db2Config) (string, bool) {
+	stmt := defaultChangePasswordStatements[config.Platform]
+	d.log().Debug("selected default password change statement", "platform", config.Platform, "statement", stmt)
+	return stmt, stmt != ""
+}
+
+// ServerVersion returns the version string of the DB2 server the plugin is
+// connected to, such as "DB2 v11.5.8.0" on LUW or "DSN12015" on z/OS. It is
+// fetched once per connection and cached until the next Initialize or Close.
+func (d *db2DB) ServerVersion(ctx context.Context) (string, error) {
+	if !d.initialized() {
+		return "", connutil.ErrNotInitialized
+	}
+
+	if err := d.beginOperation(); err != nil {
+		return "", err
+	}
+	defer d.endOperation()
+
+	db, err := d.getConnection(ctx)
+	if err != nil {
+		return "", d.sanitize(err)
+	}
+
+	version, err := d.serverVersion(ctx, d.config, db)
+	return version, d.sanitize(err)
+}
+
+// serverVersion returns the cached server version, querying db for it on
+// first use
+func (d *db2DB) serverVersion(ctx context.Context, config db2Config, db *sql.DB) (string, error) {
+	d.versionLock.Lock()
+	defer d.versionLock.Unlock()
+
+	if d.cachedVersion != "" {
+		return d.cachedVersion, nil
+	}
+
+	var version sql.NullString
+	if err := db.QueryRowContext(ctx, serverVersionQueries[config.Platform]).Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to query server version: %w", describeError(err))
+	}
+	if !version.Valid || version.String == "" {
+		return "", fmt.Errorf("server returned no version")
+	}
+
+	d.cachedVersion = version.String
+	return d.cachedVersion, nil
+}
+
+// clearServerVersion forgets the cached version, e.g. when the connection
+// may now reach a different server
+func (d *db2DB) clearServerVersion() {
+	d.versionLock.Lock()
+	d.cachedVersion = ""
+	d.versionLock.Unlock()
+}
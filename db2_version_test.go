@@ -0,0 +1,175 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/database/helper/connutil"
+	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
+)
+
+func TestServerVersion(t *testing.T) {
+	tests := map[string]struct {
+		platform string
+		query    string
+		version  string
+	}{
+		"luw": {platform: "luw", query: "SYSIBMADM.ENV_INST_INFO", version: "DB2 v11.5.8.0"},
+		"zos": {platform: "zos", query: "GETVARIABLE('SYSIBM.VERSION')", version: "DSN12015"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{"platform": tc.platform})
+			srv.respond(tc.query, []driver.Value{tc.version})
+
+			for i := 0; i < 2; i++ {
+				version, err := db.ServerVersion(context.Background())
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if version != tc.version {
+					t.Errorf("expected version %q, got %q", tc.version, version)
+				}
+			}
+
+			if n := srv.countQueries(tc.query); n != 1 {
+				t.Errorf("expected the version to be queried once, got %d", n)
+			}
+		})
+	}
+}
+
+func TestServerVersion_ClearedOnClose(t *testing.T) {
+	db, srv := newTestDB2(t, nil)
+	srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v11.5.8.0"})
+
+	if _, err := db.ServerVersion(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Initialize closes the previous connection, which may have reached a
+	// different server
+	_, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: map[string]interface{}{
+		"connection_url": db.RawConfig["connection_url"],
+		"username":       "admin",
+		"password":       "adminpass",
+	}})
+	if err != nil {
+		t.Fatalf("failed to re-initialize: %v", err)
+	}
+	srv.respond("ENV_INST_INFO", []driver.Value{"DB2 v12.1.0.0"})
+
+	version, err := db.ServerVersion(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != "DB2 v12.1.0.0" {
+		t.Errorf("expected the version to be queried again, got %q", version)
+	}
+}
+
+func TestServerVersion_Errors(t *testing.T) {
+	if _, err := newDB2().ServerVersion(context.Background()); !errors.Is(err, connutil.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got: %v", err)
+	}
+
+	db, srv := newTestDB2(t, nil)
+	srv.failOn("ENV_INST_INFO", errors.New(`SQL0551N  "ADMIN" does not have the privilege.  SQLSTATE=42501`))
+
+	_, err := db.ServerVersion(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to query server version: SQLCODE=-551") {
+		t.Errorf("expected query error, got: %v", err)
+	}
+}
+
+func TestUpdateUser_DefaultStatementIgnoresVersion(t *testing.T) {
+	tests := map[string]struct {
+		platform string
+		version  string
+		expected string
+	}{
+		"luw 11.5": {platform: "luw", version: "DB2 v11.5.8.0"},
+		"luw 12.1": {platform: "luw", version: "DB2 v12.1.0.0"},
+		"zos 12":   {platform: "zos", version: "DSN12015", expected: `ALTER USER "appuser" PASSWORD 'newpassword'`},
+		"zos 13":   {platform: "zos", version: "DSN13010", expected: `ALTER USER "appuser" PASSWORD 'newpassword'`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, srv := newTestDB2(t, map[string]interface{}{"platform": tc.platform})
+			srv.respond(serverVersionQueries[tc.platform], []driver.Value{tc.version})
+			var buf bytes.Buffer
+			db.logger = newTestLogger(&buf)
+
+			_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+				Username: "appuser",
+				Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+			})
+			if tc.expected == "" {
+				if !errors.Is(err, dbutil.ErrEmptyRotationStatement) || !strings.Contains(err.Error(), "supply password change statements for appuser") {
+					t.Fatalf("expected no default statement, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := srv.statements(); len(got) != 1 || got[0] != tc.expected {
+				t.Errorf("expected %q to run, got: %v", tc.expected, got)
+			}
+			if out := buf.String(); !strings.Contains(out, "selected default password change statement") {
+				t.Errorf("expected the chosen default to be logged, got:\n%s", out)
+			}
+			// The default does not depend on the version, so it is not looked up
+			if n := srv.countQueries(serverVersionQueries[tc.platform]); n != 0 {
+				t.Errorf("expected no server version query, got %d", n)
+			}
+		})
+	}
+}
+
+func TestInitialize_DefaultRotationStatement(t *testing.T) {
+	srv, url := newFakeServer(t)
+	srv.respond("SYSIBM.VERSION", []driver.Value{"DSN12015"})
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	defer db.Close()
+
+	config := map[string]interface{}{
+		"connection_url": url,
+		"username":       "admin",
+		"password":       "adminpass",
+		"platform":       "zos",
+	}
+	resp, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config, VerifyConnection: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `ALTER USER "{{username}}" PASSWORD '{{password_escaped}}'`
+	if got := resp.Config[defaultStatementConfigKey]; got != expected {
+		t.Errorf("expected %s %q, got %v", defaultStatementConfigKey, expected, got)
+	}
+
+	// Vault saves the response config, so the value comes back on the next
+	// Initialize, where it must not outlive the server it described
+	resp.Config["platform"] = "luw"
+	resp, err = db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: resp.Config, VerifyConnection: true})
+	if err != nil {
+		t.Fatalf("unexpected error re-initializing: %v", err)
+	}
+	if got, ok := resp.Config[defaultStatementConfigKey]; ok {
+		t.Errorf("expected no %s for a server without a default, got %v", defaultStatementConfigKey, got)
+	}
+}
@@ -0,0 +1,622 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// fakeDriverName is the database/sql driver name the tests use in place of
+// go_ibm_db, which requires the IBM CLI libraries and a live server.
+const (
+	fakeDriverName = "db2fake"
+
+	// fakeTxDriverName opens the same fake databases with connections that
+	// take the isolation level from BeginTx, which go_ibm_db's do not
+	fakeTxDriverName = "db2fake-tx"
+)
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+	sql.Register(fakeTxDriverName, fakeTxDriver{})
+}
+
+var fakeServers sync.Map
+
+// fakeServer records the statements executed against a fake DB2 database and
+// allows tests to script failures.
+type fakeServer struct {
+	mu        sync.Mutex
+	applied   []string
+	queries   []string
+	failures  map[string]error
+	failCount map[string]int
+	delays    map[string]time.Duration
+	results   map[string][][]driver.Value
+	rollbacks int
+
+	prepared        []string
+	prepareFailures map[string]error
+
+	dsns []string
+
+	// maxConns, when set, is how many connections can be opened before
+	// further attempts are refused
+	maxConns int
+
+	// rejected holds the UIDs whose logins fail, as for a locked account
+	rejected map[string]bool
+
+	// passwords holds the only password each UID can log in with; UIDs
+	// without one log in with any
+	passwords map[string]string
+
+	// generation is bumped by restart; connections opened before it fail
+	generation int
+
+	// bound holds the arguments of each statement executed with any
+	bound [][]driver.Value
+
+	// active and peak count the delayed statements running at once
+	active, peak int
+
+	// hooks run after a statement containing their key executes
+	hooks map[string]func()
+
+	// outputs are assigned to the OUT parameters of a statement containing
+	// their key
+	outputs map[string][]driver.Value
+
+	// txOptions holds the options of each transaction begun through
+	// fakeTxDriverName
+	txOptions []driver.TxOptions
+}
+
+// newFakeServer registers a fake database named after the test and returns it
+// along with a connection URL that resolves to it.
+func newFakeServer(t *testing.T) (*fakeServer, string) {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	return newNamedFakeServer(t, name), fmt.Sprintf("DATABASE=%s;HOSTNAME=localhost;PORT=50000", name)
+}
+
+// newNamedFakeServer registers a fake database that connection strings with
+// DATABASE=name resolve to.
+func newNamedFakeServer(t *testing.T, name string) *fakeServer {
+	t.Helper()
+
+	srv := &fakeServer{
+		failures:  map[string]error{},
+		failCount: map[string]int{},
+		delays:    map[string]time.Duration{},
+		results:   map[string][][]driver.Value{},
+
+		prepareFailures: map[string]error{},
+		hooks:           map[string]func(){},
+		outputs:         map[string][]driver.Value{},
+	}
+	fakeServers.Store(name, srv)
+	t.Cleanup(func() { fakeServers.Delete(name) })
+
+	return srv
+}
+
+// failOn makes any statement containing substr fail with err.
+func (s *fakeServer) failOn(substr string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[substr] = err
+}
+
+// failTimes makes the next n statements containing substr fail with err.
+func (s *fakeServer) failTimes(substr string, n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[substr] = err
+	s.failCount[substr] = n
+}
+
+// failPrepareOn makes preparing any statement containing substr fail with err.
+func (s *fakeServer) failPrepareOn(substr string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prepareFailures[substr] = err
+}
+
+// preparedStatements returns the statements that were prepared.
+func (s *fakeServer) preparedStatements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.prepared...)
+}
+
+// connections returns the connection strings used to open connections.
+func (s *fakeServer) connections() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dsns...)
+}
+
+// rejectLogin fails connections that log in as uid with SQL30082N, as the
+// server does for a locked account or a wrong password
+func (s *fakeServer) rejectLogin(uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rejected == nil {
+		s.rejected = map[string]bool{}
+	}
+	s.rejected[strings.ToUpper(uid)] = true
+}
+
+// setPassword makes logins as uid fail with SQL30082N unless they use
+// password, which password change statements do not update.
+func (s *fakeServer) setPassword(uid, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.passwords == nil {
+		s.passwords = map[string]string{}
+	}
+	s.passwords[strings.ToUpper(uid)] = password
+}
+
+// limitConnections refuses connections once n have been opened, as a server
+// at its maxappls limit does.
+func (s *fakeServer) limitConnections(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxConns = n
+}
+
+// restart simulates a server restart: connections opened before it still
+// answer pings but fail every statement, as dropped DB2 connections can.
+func (s *fakeServer) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+}
+
+// boundArgs returns the arguments bound to each statement executed with any.
+func (s *fakeServer) boundArgs() [][]driver.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]driver.Value(nil), s.bound...)
+}
+
+// beginTxOptions returns the options of each transaction begun through
+// fakeTxDriverName.
+func (s *fakeServer) beginTxOptions() []driver.TxOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]driver.TxOptions(nil), s.txOptions...)
+}
+
+// afterExec calls fn after each statement containing substr executes.
+func (s *fakeServer) afterExec(substr string, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks[substr] = fn
+}
+
+// setOutputs makes any statement containing substr assign values to its OUT
+// parameters, in order.
+func (s *fakeServer) setOutputs(substr string, values ...driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs[substr] = values
+}
+
+// delayOn makes any statement containing substr block for d, or until its
+// context is done.
+func (s *fakeServer) delayOn(substr string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[substr] = d
+}
+
+// respond makes any query containing substr return rows. Unscripted queries
+// return a single row containing 1.
+func (s *fakeServer) respond(substr string, rows ...[]driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[substr] = rows
+}
+
+// queryLog returns the queries that were issued.
+func (s *fakeServer) queryLog() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// statements returns the statements that were committed or auto-committed.
+func (s *fakeServer) statements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.applied...)
+}
+
+// countQueries returns how many issued queries contain substr.
+func (s *fakeServer) countQueries(substr string) int {
+	return countContaining(s.queryLog(), substr)
+}
+
+// countStatements returns how many applied statements contain substr.
+func (s *fakeServer) countStatements(substr string) int {
+	return countContaining(s.statements(), substr)
+}
+
+func countContaining(list []string, substr string) int {
+	n := 0
+	for _, item := range list {
+		if strings.Contains(item, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeServer) rollbackCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rollbacks
+}
+
+// wait applies any scripted delay for query, returning early if ctx is done.
+func (s *fakeServer) wait(ctx context.Context, query string) error {
+	s.mu.Lock()
+	var delay time.Duration
+	for substr, d := range s.delays {
+		if strings.Contains(query, substr) {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		s.active++
+		if s.active > s.peak {
+			s.peak = s.active
+		}
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}
+	return ctx.Err()
+}
+
+// peakConcurrency returns the most delayed statements that ran at once.
+func (s *fakeServer) peakConcurrency() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+func (s *fakeServer) exec(query string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for substr, err := range s.failures {
+		if !strings.Contains(query, substr) {
+			continue
+		}
+		if n, limited := s.failCount[substr]; limited {
+			if n == 0 {
+				continue
+			}
+			s.failCount[substr] = n - 1
+		}
+		return err
+	}
+	return nil
+}
+
+// assignOutputs scans the values scripted by setOutputs into the OUT
+// parameters of query.
+func (s *fakeServer) assignOutputs(query string, args []driver.NamedValue) error {
+	s.mu.Lock()
+	var values []driver.Value
+	for substr, v := range s.outputs {
+		if strings.Contains(query, substr) {
+			values = v
+		}
+	}
+	s.mu.Unlock()
+
+	for _, arg := range args {
+		out, ok := arg.Value.(sql.Out)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		scanner, ok := out.Dest.(sql.Scanner)
+		if !ok {
+			return fmt.Errorf("unsupported OUT parameter %T", out.Dest)
+		}
+		if err := scanner.Scan(values[0]); err != nil {
+			return err
+		}
+		values = values[1:]
+	}
+	return nil
+}
+
+// newTestDB2 returns a db2DB initialized against a fake server.
+func newTestDB2(t *testing.T, conf map[string]interface{}) (*db2DB, *fakeServer) {
+	t.Helper()
+
+	srv, url := newFakeServer(t)
+	config := map[string]interface{}{
+		"connection_url": url,
+		"username":       "admin",
+		"password":       "adminpass",
+	}
+	for k, v := range conf {
+		config[k] = v
+	}
+
+	db := newDB2()
+	db.db2ConnectionProducer.Type = fakeDriverName
+	if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config}); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, srv
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	for _, part := range strings.Split(dsn, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		if strings.EqualFold(key, "DATABASE") || strings.EqualFold(key, "DSN") {
+			if srv, ok := fakeServers.Load(value); ok {
+				s := srv.(*fakeServer)
+				s.mu.Lock()
+				if s.maxConns > 0 && len(s.dsns) >= s.maxConns {
+					s.mu.Unlock()
+					return nil, fmt.Errorf("SQL1040N  The maximum number of applications is already connected to the database.  SQLSTATE=57030")
+				}
+				cs := parseConnectionString(dsn)
+				uid, _ := cs.get("UID")
+				if s.rejected[strings.ToUpper(uid)] {
+					s.mu.Unlock()
+					return nil, fmt.Errorf(`SQL30082N  Security processing failed with reason "19" ("USERID DISABLED or RESTRICTED").  SQLSTATE=08001`)
+				}
+				if want, ok := s.passwords[strings.ToUpper(uid)]; ok {
+					if pwd, _ := cs.get("PWD"); pwd != want {
+						s.mu.Unlock()
+						return nil, fmt.Errorf(`SQL30082N  Security processing failed with reason "24" ("USERNAME AND/OR PASSWORD INVALID").  SQLSTATE=08001`)
+					}
+				}
+				s.dsns = append(s.dsns, dsn)
+				generation := s.generation
+				s.mu.Unlock()
+				return &fakeConn{srv: s, generation: generation}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("SQL1013N The database alias name or database name could not be found")
+}
+
+type fakeTxDriver struct{}
+
+func (fakeTxDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := fakeDriver{}.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeTxConn{conn.(*fakeConn)}, nil
+}
+
+// fakeTxConn is a fakeConn that records the options transactions are begun
+// with
+type fakeTxConn struct {
+	*fakeConn
+}
+
+func (c *fakeTxConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.srv.mu.Lock()
+	c.srv.txOptions = append(c.srv.txOptions, opts)
+	c.srv.mu.Unlock()
+	return c.Begin()
+}
+
+type fakeConn struct {
+	srv        *fakeServer
+	pending    []string
+	inTx       bool
+	generation int
+}
+
+// stale fails connections opened before the last restart.
+func (c *fakeConn) stale() error {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	if c.generation != c.srv.generation {
+		return fmt.Errorf("SQL30081N  A communication error has been detected.  SQLSTATE=08001")
+	}
+	return nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	for substr, err := range c.srv.prepareFailures {
+		if strings.Contains(query, substr) {
+			return nil, err
+		}
+	}
+	c.srv.prepared = append(c.srv.prepared, query)
+
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	if err := c.stale(); err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error { return nil }
+
+// CheckNamedValue accepts sql.Out parameters, leaving others to the default
+// conversion.
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(sql.Out); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.stale(); err != nil {
+		return nil, err
+	}
+	if err := c.srv.wait(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := c.srv.exec(query); err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		c.srv.mu.Lock()
+		c.srv.bound = append(c.srv.bound, values)
+		c.srv.mu.Unlock()
+	}
+	if err := c.srv.assignOutputs(query, args); err != nil {
+		return nil, err
+	}
+	if c.inTx {
+		c.pending = append(c.pending, query)
+	} else {
+		c.srv.mu.Lock()
+		c.srv.applied = append(c.srv.applied, query)
+		c.srv.mu.Unlock()
+	}
+
+	c.srv.mu.Lock()
+	var hooks []func()
+	for substr, fn := range c.srv.hooks {
+		if strings.Contains(query, substr) {
+			hooks = append(hooks, fn)
+		}
+	}
+	c.srv.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.stale(); err != nil {
+		return nil, err
+	}
+	if err := c.srv.wait(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := c.srv.exec(query); err != nil {
+		return nil, err
+	}
+
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	c.srv.queries = append(c.srv.queries, query)
+
+	rows := [][]driver.Value{{int64(1)}}
+	for substr, result := range c.srv.results {
+		if strings.Contains(query, substr) {
+			rows = result
+		}
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.srv.mu.Lock()
+	c.srv.applied = append(c.srv.applied, c.pending...)
+	c.srv.mu.Unlock()
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.srv.mu.Lock()
+	c.srv.rollbacks++
+	c.srv.mu.Unlock()
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"1"}
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("%d", i+1)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -4,15 +4,85 @@
 package db2
 
 import (
+	"os"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 )
 
+// debugEnv must be set in the plugin's environment for the
+// disable_error_sanitization config to be accepted
+const debugEnv = "VAULT_DB2_DEBUG"
+
+// Option configures a plugin instance created by NewWithOptions
+type Option func(*db2DB)
+
+// WithLogger sets the logger operations are logged to, in place of JSON
+// logs on stderr; nil discards them
+func WithLogger(logger hclog.Logger) Option {
+	return func(d *db2DB) {
+		d.logger = logger
+	}
+}
+
+// WithMetricsSink sets the sink telemetry is emitted to, in place of the
+// go-metrics global
+func WithMetricsSink(sink metrics.MetricSink) Option {
+	return func(d *db2DB) {
+		d.metrics = sink
+	}
+}
+
+// WithDriver sets the name of the registered database/sql driver
+// connections are opened with, in place of the IBM DB2 driver, e.g. to run
+// the plugin against a fake server in tests
+func WithDriver(name string) Option {
+	return func(d *db2DB) {
+		d.db2ConnectionProducer.Type = name
+	}
+}
+
+// WithClock sets the plugin's time source, in place of real time
+func WithClock(clock Clock) Option {
+	return func(d *db2DB) {
+		d.clock = clock
+	}
+}
+
 // New creates a new instance of the DB2 database plugin
 func New() (interface{}, error) {
+	return NewWithOptions()
+}
+
+// NewWithOptions creates a new instance of the DB2 database plugin
+// configured by opts
+func NewWithOptions(opts ...Option) (interface{}, error) {
 	db := newDB2()
 
-	// Wrap with error sanitization middleware
-	dbType := dbplugin.NewDatabaseErrorSanitizerMiddleware(db, db.secretValues)
+	// The plugin harness forwards JSON logs written to stderr to Vault's
+	// logger, which applies its own level
+	db.logger = hclog.New(&hclog.LoggerOptions{
+		Level:      hclog.Trace,
+		Output:     os.Stderr,
+		JSONFormat: true,
+	})
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	return sanitized(db), nil
+}
+
+// sanitized wraps db with the error sanitization middleware. Only when the
+// plugin runs with VAULT_DB2_DEBUG set can disable_error_sanitization switch
+// it off.
+func sanitized(db *db2DB) dbplugin.Database {
+	secretsFn := db.secretValues
+	if db.debug {
+		secretsFn = db.sanitizerSecrets
+	}
 
-	return dbType, nil
+	return dbplugin.NewDatabaseErrorSanitizerMiddleware(db, secretsFn)
 }
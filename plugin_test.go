@@ -0,0 +1,146 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package db2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestNew_Sanitized(t *testing.T) {
+	plugin, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error creating plugin: %v", err)
+	}
+	if _, ok := plugin.(dbplugin.DatabaseErrorSanitizerMiddleware); !ok {
+		t.Errorf("expected the plugin to be wrapped with the error sanitizer, got %T", plugin)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	srv, url := newFakeServer(t)
+	var buf bytes.Buffer
+	sink := newFakeSink()
+
+	plugin, err := NewWithOptions(WithLogger(newTestLogger(&buf)), WithMetricsSink(sink), WithDriver(fakeDriverName))
+	if err != nil {
+		t.Fatalf("unexpected error creating plugin: %v", err)
+	}
+	db, ok := plugin.(dbplugin.Database)
+	if !ok {
+		t.Fatalf("expected a dbplugin.Database, got %T", plugin)
+	}
+	defer db.Close()
+
+	_, err = db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: map[string]interface{}{
+		"connection_url": url,
+		"username":       "admin",
+		"password":       "adminpass",
+		"platform":       "zos",
+	}})
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username: "appuser",
+		Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error updating user: %v", err)
+	}
+
+	// The injected driver ran the statement, and the operation reached the
+	// injected logger and sink
+	if got := srv.statements(); len(got) != 1 || !strings.Contains(got[0], `ALTER USER "appuser"`) {
+		t.Errorf("expected the password change on the fake server, got: %v", got)
+	}
+	if !strings.Contains(buf.String(), "username=appuser") {
+		t.Errorf("expected the operation to be logged, got: %s", buf.String())
+	}
+	if sink.counters["database.db2.success;operation=update_user"] != 1 {
+		t.Errorf("expected a success to be counted, got: %v", sink.counters)
+	}
+}
+
+func TestDisableErrorSanitization(t *testing.T) {
+	// initialize returns the sanitized plugin against a fake server whose
+	// password change statements fail with a message echoing the password.
+	// Without a SQLCODE the message reaches the sanitizer intact.
+	initialize := func(t *testing.T, conf map[string]interface{}) (dbplugin.Database, error) {
+		srv, url := newFakeServer(t)
+		srv.failOn("ALTER USER", errors.New(`driver: statement rejected for admin/adminpass`))
+
+		db := newDB2()
+		db.db2ConnectionProducer.Type = fakeDriverName
+		plugin := sanitized(db)
+		t.Cleanup(func() { plugin.Close() })
+
+		config := map[string]interface{}{
+			"connection_url": url,
+			"username":       "admin",
+			"password":       "adminpass",
+			"platform":       "zos",
+		}
+		for k, v := range conf {
+			config[k] = v
+		}
+		_, err := plugin.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config})
+		return plugin, err
+	}
+
+	rotate := func(plugin dbplugin.Database) error {
+		_, err := plugin.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+			Username: "admin",
+			Password: &dbplugin.ChangePassword{NewPassword: "newpassword"},
+		})
+		return err
+	}
+
+	t.Run("without debug flag", func(t *testing.T) {
+		t.Setenv(debugEnv, "")
+
+		_, err := initialize(t, map[string]interface{}{"disable_error_sanitization": true})
+		if err == nil || !strings.Contains(err.Error(), debugEnv) {
+			t.Fatalf("expected disable_error_sanitization to require %s, got: %v", debugEnv, err)
+		}
+
+		plugin, err := initialize(t, nil)
+		if err != nil {
+			t.Fatalf("unexpected error initializing: %v", err)
+		}
+		if err := rotate(plugin); err == nil || strings.Contains(err.Error(), "adminpass") {
+			t.Errorf("expected a sanitized error, got: %v", err)
+		}
+	})
+
+	t.Run("with debug flag", func(t *testing.T) {
+		t.Setenv(debugEnv, "1")
+
+		plugin, err := initialize(t, map[string]interface{}{"disable_error_sanitization": true})
+		if err != nil {
+			t.Fatalf("unexpected error initializing: %v", err)
+		}
+		if err := rotate(plugin); err == nil || !strings.Contains(err.Error(), "admin/adminpass") {
+			t.Errorf("expected the full error, got: %v", err)
+		}
+	})
+
+	t.Run("debug flag alone", func(t *testing.T) {
+		t.Setenv(debugEnv, "1")
+
+		plugin, err := initialize(t, nil)
+		if err != nil {
+			t.Fatalf("unexpected error initializing: %v", err)
+		}
+		if err := rotate(plugin); err == nil || strings.Contains(err.Error(), "adminpass") {
+			t.Errorf("expected errors to stay sanitized, got: %v", err)
+		}
+	})
+}